@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/kardianos/service"
@@ -20,7 +21,14 @@ var rootDir string
 
 func main() {
 	serviceFlag := flag.String("service", "", `control FLibGoLite system service`)
-	reindexFlag := flag.Bool("reindex", false, `empty book stock database and then scan book stock directory to add books to database`)
+	reindexFlag := flag.Bool("reindex", false, `rebuild book stock database from scratch while the server keeps serving the old one`)
+	inpxFlag := flag.String("inpx", "", `import books from INPX catalog file and exit`)
+	exportFlag := flag.String("export-inpx", "", `export book stock index to INPX catalog file and exit`)
+	reconcileFlag := flag.Bool("reconcile", false, `remove deleted and reindex replaced book stock files and exit`)
+	statusFlag := flag.String("status", "", `report files rejected by indexer with the state and exit`)
+	requeueFlag := flag.String("requeue", "", `forget files rejected by indexer with the state to process them again and exit`)
+	rulesFlag := flag.Bool("dry-run-rules", false, `list indexed books the metadata normalization rules would change and exit`)
+	mergeFlag := flag.String("merge-authors", "", `merge author into canonical author given as "author:canonical" and exit`)
 	configFlag := flag.Bool("config", false, `create default config file in ./config folder for customization and exit`)
 	helpFlag := flag.Bool("help", false, `display extended command help and exit`)
 	versionFlag := flag.Bool("version", false, `output version information and exit`)
@@ -47,6 +55,20 @@ func main() {
 		defaultConfig()
 	case *reindexFlag:
 		reindexStock()
+	case *reconcileFlag:
+		reconcileStock()
+	case *statusFlag != "":
+		ingestReport(*statusFlag)
+	case *requeueFlag != "":
+		requeueFiles(*requeueFlag)
+	case *rulesFlag:
+		rulesReport()
+	case *mergeFlag != "":
+		mergeAuthors(*mergeFlag)
+	case *inpxFlag != "":
+		importINPX(*inpxFlag)
+	case *exportFlag != "":
+		exportINPX(*exportFlag)
 	case *serviceFlag != "":
 		controlService(*serviceFlag)
 	default:
@@ -69,7 +91,21 @@ Caution: Only one OPTION can be used at a time
 OPTION should be one of:
   -service [action]     control FLibGoLite system service
 	  where action is one of: install, start, stop, restart, uninstall, status 
-  -reindex              empty book stock index and then scan book stock folder to add books to index (database)
+  -reindex              rebuild book stock index (database) from scratch, running server keeps serving the old index until it is done
+  -reconcile            remove index records of deleted book stock files and reindex replaced ones
+  -status [state]       report files rejected by indexer, state is one of: all, duplicate-crc32, duplicate-title-plot,
+	  empty-file, parse-error, language-not-accepted, bad-archive, unsupported-format, open-failed, not-regular-file,
+	  duplicate-sha256, rejected-by-rule
+  -requeue [state]      forget files rejected by indexer with the state, so they are processed again by the next scan
+	  files moved to the trash folder have to be moved back to the new acquisitions or stock folder
+  -dry-run-rules        list indexed books each metadata normalization rule from rules file would change,
+	  run -reindex to apply the changed rules to the indexed books
+  -merge-authors [author:canonical]
+	  merge books of author into canonical author, authors are given by ids or full names,
+	  author name is kept as an alias so new books of the author are indexed with canonical author
+  -inpx [file]          import books from INPX catalog, archives are looked for next to the catalog file in book stock folder
+	  books are added to the library which stock folder contains the catalog file
+  -export-inpx [file]   export books from book stock archives to INPX catalog, e.g. to the book stock folder
   -config               create default config file in ./config folder for customization
   -help                 display this help
   -version              output version information
@@ -103,6 +139,30 @@ func defaultConfig() {
 }
 
 func reindexStock() {
+	appInstance := app.New(nil)
+	cfg := appInstance.InitConfig(rootDir)
+	appInstance.InitLocales(cfg)
+
+	stockLog, _ := appInstance.InitLogs(cfg, false)
+	defer stockLog.Close()
+
+	start := time.Now()
+	stockLog.S.Println(">>> Book stock reindex started  >>>>>>>>>>>>>>>>>>>>>>>>>>>")
+
+	genresTree := appInstance.InitGenres(cfg)
+	ingestRules := appInstance.InitRules(cfg)
+	if err := appInstance.Reindex(cfg, genresTree, ingestRules, stockLog); err != nil {
+		stockLog.E.Println(err)
+		log.Fatal(err)
+	}
+
+	stockLog.S.Println("<<< Book stock reindex finished <<<<<<<<<<<<<<<<<<<<<<<<<<<")
+	stockLog.S.Println("Time elapsed: ", time.Since(start))
+
+	os.Exit(0)
+}
+
+func reconcileStock() {
 	svc := initService()
 	runningService := false
 	svcStatus, err := svc.Status()
@@ -113,45 +173,234 @@ func reindexStock() {
 
 	appInstance := app.New(nil)
 	cfg := appInstance.InitConfig(rootDir)
-	os.Remove(cfg.Database.DSN)
+	appInstance.InitLocales(cfg)
+
+	stockLog, _ := appInstance.InitLogs(cfg, false)
+	defer stockLog.Close()
+
+	start := time.Now()
+	stockLog.S.Println(">>> Book stock reconciliation started  >>>>>>>>>>>>>>>>>>>>")
+
+	db, err := appInstance.InitDatabase(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	genresTree := appInstance.InitGenres(cfg)
+	ingestRules := appInstance.InitRules(cfg)
+	for _, stockHandler := range appInstance.InitReconcilerOnce(cfg, db, genresTree, ingestRules, stockLog) {
+		stockHandler.StopDB <- struct{}{}
+		<-stockHandler.StopDB
+		close(stockHandler.StopDB)
+		close(stockHandler.StopScan)
+		close(stockHandler.StopWorkers)
+	}
+
+	stockLog.S.Println("<<< Book stock reconciliation finished <<<<<<<<<<<<<<<<<<<<")
+	stockLog.S.Println("Time elapsed: ", time.Since(start))
 
 	if runningService {
 		svc.Start()
-		os.Exit(0)
+	}
+	os.Exit(0)
+}
+
+func importINPX(inpxFile string) {
+	inpxPath, err := filepath.Abs(inpxFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	svc := initService()
+	runningService := false
+	svcStatus, err := svc.Status()
+	if err == nil && svcStatus == service.StatusRunning {
+		svc.Stop()
+		runningService = true
 	}
 
+	appInstance := app.New(nil)
+	cfg := appInstance.InitConfig(rootDir)
 	appInstance.InitLocales(cfg)
 
 	stockLog, _ := appInstance.InitLogs(cfg, false)
 	defer stockLog.Close()
 
 	start := time.Now()
-	stockLog.S.Println(">>> Book stock reindex started  >>>>>>>>>>>>>>>>>>>>>>>>>>>")
+	stockLog.S.Println(">>> INPX catalog import started  >>>>>>>>>>>>>>>>>>>>>>>>>>")
 
 	db, err := appInstance.InitDatabase(cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer db.Close()
-	ready, err := db.IsReady()
+
+	genresTree := appInstance.InitGenres(cfg)
+	ingestRules := appInstance.InitRules(cfg)
+	stockHandler := appInstance.InitImporter(cfg, cfg.LibraryOf(inpxPath), db, genresTree, ingestRules, stockLog)
+	if err := stockHandler.ImportINPX(inpxPath); err != nil {
+		stockLog.E.Println(err)
+		fmt.Println(err)
+	}
+
+	stockLog.S.Println("<<< INPX catalog import finished <<<<<<<<<<<<<<<<<<<<<<<<<<")
+	stockLog.S.Println("Time elapsed: ", time.Since(start))
+
+	if runningService {
+		svc.Start()
+	}
+	os.Exit(0)
+}
+
+func ingestReport(state string) {
+	appInstance := app.New(nil)
+	cfg := appInstance.InitConfig(rootDir)
+	appInstance.InitLocales(cfg)
+
+	stockLog, _ := appInstance.InitLogs(cfg, false)
+	defer stockLog.Close()
+
+	db, err := appInstance.InitDatabase(cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
-	if !ready {
-		stockLog.S.Println("Book stock was inited. Tables were created in empty database")
+	defer db.Close()
+
+	genresTree := appInstance.InitGenres(cfg)
+	ingestRules := appInstance.InitRules(cfg)
+	for _, lib := range cfg.Libraries {
+		if len(cfg.Libraries) > 1 {
+			fmt.Printf("Library %s:\n", lib.TITLE)
+		}
+		stockHandler := appInstance.InitImporter(cfg, lib, db, genresTree, ingestRules, stockLog)
+		if err := stockHandler.IngestReport(os.Stdout, state); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	os.Exit(0)
+}
+
+func rulesReport() {
+	appInstance := app.New(nil)
+	cfg := appInstance.InitConfig(rootDir)
+	appInstance.InitLocales(cfg)
+
+	stockLog, _ := appInstance.InitLogs(cfg, false)
+	defer stockLog.Close()
+
+	db, err := appInstance.InitDatabase(cfg)
+	if err != nil {
+		log.Fatal(err)
 	}
+	defer db.Close()
 
 	genresTree := appInstance.InitGenres(cfg)
-	stockHandler := appInstance.InitIndexerOnce(cfg, db, genresTree, stockLog)
-	defer close(stockHandler.StopDB)
-	defer close(stockHandler.StopScan)
+	ingestRules := appInstance.InitRules(cfg)
+	for _, lib := range cfg.Libraries {
+		if len(cfg.Libraries) > 1 {
+			fmt.Printf("Library %s:\n", lib.TITLE)
+		}
+		stockHandler := appInstance.InitImporter(cfg, lib, db, genresTree, ingestRules, stockLog)
+		if err := stockHandler.RulesReport(os.Stdout); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	os.Exit(0)
+}
 
-	stockHandler.StopDB <- struct{}{}
-	<-stockHandler.StopDB
+func mergeAuthors(authors string) {
+	author, canonical, ok := strings.Cut(authors, ":")
+	if !ok {
+		fmt.Println(`Error: authors must be given as "author:canonical"`)
+		os.Exit(1)
+	}
+	appInstance := app.New(nil)
+	cfg := appInstance.InitConfig(rootDir)
+	appInstance.InitLocales(cfg)
 
-	stockLog.S.Println("<<< Book stock reindex finished <<<<<<<<<<<<<<<<<<<<<<<<<<<")
-	stockLog.S.Println("Time elapsed: ", time.Since(start))
+	stockLog, _ := appInstance.InitLogs(cfg, false)
+	defer stockLog.Close()
+
+	db, err := appInstance.InitDatabase(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	genresTree := appInstance.InitGenres(cfg)
+	ingestRules := appInstance.InitRules(cfg)
+	stockHandler := appInstance.InitImporter(cfg, cfg.Library, db, genresTree, ingestRules, stockLog)
+	moved, err := stockHandler.MergeAuthors(strings.TrimSpace(author), strings.TrimSpace(canonical))
+	if err != nil {
+		stockLog.E.Println(err)
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("%d books were moved to %s\n", moved, strings.TrimSpace(canonical))
+	os.Exit(0)
+}
 
+func requeueFiles(state string) {
+	appInstance := app.New(nil)
+	cfg := appInstance.InitConfig(rootDir)
+	appInstance.InitLocales(cfg)
+
+	stockLog, _ := appInstance.InitLogs(cfg, false)
+	defer stockLog.Close()
+
+	db, err := appInstance.InitDatabase(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	genresTree := appInstance.InitGenres(cfg)
+	ingestRules := appInstance.InitRules(cfg)
+	var n int64
+	for _, lib := range cfg.Libraries {
+		stockHandler := appInstance.InitImporter(cfg, lib, db, genresTree, ingestRules, stockLog)
+		requeued, err := stockHandler.Requeue(state)
+		if err != nil {
+			stockLog.E.Println(err)
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		n += requeued
+	}
+	stockLog.S.Printf("%d rejected files were requeued\n", n)
+	fmt.Printf("%d rejected files will be processed again by the next scan\n", n)
+	os.Exit(0)
+}
+
+func exportINPX(inpxFile string) {
+	inpxPath, err := filepath.Abs(inpxFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	appInstance := app.New(nil)
+	cfg := appInstance.InitConfig(rootDir)
+	appInstance.InitLocales(cfg)
+
+	stockLog, _ := appInstance.InitLogs(cfg, false)
+	defer stockLog.Close()
+
+	db, err := appInstance.InitDatabase(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	genresTree := appInstance.InitGenres(cfg)
+	ingestRules := appInstance.InitRules(cfg)
+	stockHandler := appInstance.InitImporter(cfg, cfg.LibraryOf(inpxPath), db, genresTree, ingestRules, stockLog)
+	if err := stockHandler.ExportINPX(inpxPath); err != nil {
+		stockLog.E.Println(err)
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("INPX catalog %s was created\n", inpxPath)
 	os.Exit(0)
 }
 
@@ -179,6 +428,7 @@ func run() {
 	}
 
 	genresTree := appInstance.InitGenres(cfg)
+	ingestRules := appInstance.InitRules(cfg)
 
 	// Starting OPDS
 	opdsHandler, server := appInstance.InitOPDS(cfg, db, genresTree, opdsLog)
@@ -192,12 +442,15 @@ func run() {
 	opdsHandler.LOG.S.Printf("Server started listening at http://localhost:%d \n", cfg.OPDS.PORT)
 
 	// Starting book stock
-	stockHandler := appInstance.InitIndexer(cfg, db, genresTree, stockLog)
-	defer close(stockHandler.StopDB)
-	defer close(stockHandler.StopScan)
+	stockHandlers := appInstance.InitIndexer(cfg, db, genresTree, ingestRules, stockLog)
+	for _, stockHandler := range stockHandlers {
+		defer close(stockHandler.StopDB)
+		defer close(stockHandler.StopScan)
+		defer close(stockHandler.StopWorkers)
+	}
 
-	stockHandler.LOG.S.Printf("Book cache warming started...\n")
-	stockHandler.LOG.S.Printf("New acquisitions scanning started...\n")
+	stockLog.S.Printf("Book cache warming started...\n")
+	stockLog.S.Printf("New acquisitions scanning started...\n")
 
 	// <<<<<<<<<<<<<<<<<- Wait for shutdown
 	<-doShutdown
@@ -205,14 +458,18 @@ func run() {
 	opdsHandler.LOG.S.Printf("Shutdown started...\n")
 
 	// Stop scanning for new acquisitions and wait for completion
-	stockHandler.StopScan <- struct{}{}
-	<-stockHandler.StopScan
-	stockHandler.LOG.S.Printf("New acquisitions scanning was stoped correctly\n")
+	for _, stockHandler := range stockHandlers {
+		stockHandler.StopScan <- struct{}{}
+		<-stockHandler.StopScan
+	}
+	stockLog.S.Printf("New acquisitions scanning was stoped correctly\n")
 
 	// Stop addind new acquisitions to index and wait for completion
-	stockHandler.StopDB <- struct{}{}
-	<-stockHandler.StopDB
-	stockHandler.LOG.S.Printf("New acquisitions adding was stoped correctly\n")
+	for _, stockHandler := range stockHandlers {
+		stockHandler.StopDB <- struct{}{}
+		<-stockHandler.StopDB
+	}
+	stockLog.S.Printf("New acquisitions adding was stoped correctly\n")
 
 	// Shutdown OPDS server
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
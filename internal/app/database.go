@@ -1,11 +1,14 @@
 package app
 
 import (
+	"log"
+
 	"github.com/vinser/flibgolite/internal/core/config"
+	"github.com/vinser/flibgolite/internal/covers"
 	"github.com/vinser/flibgolite/internal/store"
 )
 
-// InitDatabase initializes database connection and schema.
+// InitDatabase initializes database connection and schema and resolves database ids of the libraries.
 func (a *App) InitDatabase(cfg *config.Config) (*store.DB, error) {
 	db, err := store.NewDB(cfg.Database.DSN)
 	if err != nil {
@@ -17,6 +20,28 @@ func (a *App) InitDatabase(cfg *config.Config) (*store.DB, error) {
 	}
 	if !ready {
 		db.InitDB()
+	} else if err := db.UpgradeDB(); err != nil {
+		return nil, err
+	}
+	for i := range cfg.Libraries {
+		if cfg.Libraries[i].ID, err = db.LibraryID(cfg.Libraries[i].NAME); err != nil {
+			return nil, err
+		}
+	}
+	cfg.Library = cfg.Libraries[0]
+	// books indexed before libraries were named belong to the unnamed library 0, the first named library takes them
+	if cfg.Library.ID != 0 {
+		n, err := db.MoveLibrary(0, cfg.Library.ID)
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			log.Printf("%d books indexed before libraries were named were moved to library %q\n", n, cfg.Library.NAME)
+		}
+	}
+	// covers cached for other index, e.g. one deleted with its database file, have wrong book ids
+	if err := covers.NewCache(cfg.Covers.CACHE_DIR, cfg.Covers.THUMBNAIL_SIZES).ForIndex(db.CoversID()).Prune(); err != nil {
+		return nil, err
 	}
 	return db, nil
 }
@@ -5,79 +5,145 @@ import (
 
 	"github.com/vinser/flibgolite/internal/core/config"
 	"github.com/vinser/flibgolite/internal/core/model"
+	"github.com/vinser/flibgolite/internal/covers"
 	"github.com/vinser/flibgolite/internal/genres"
 	"github.com/vinser/flibgolite/internal/hash"
 	"github.com/vinser/flibgolite/internal/index"
 	"github.com/vinser/flibgolite/internal/rlog"
+	"github.com/vinser/flibgolite/internal/rules"
 	"github.com/vinser/flibgolite/internal/store"
 )
 
-// InitIndexerOnce initializes the indexer for one-time scanning.
-func (a *App) InitIndexerOnce(cfg *config.Config, db *store.DB, genresTree *genres.GenresTree, stockLog *rlog.Log) *index.Handler {
-	bookQueue := make(chan model.Book, cfg.Database.BOOK_QUEUE_SIZE)
-	fileQueue := make(chan index.File, cfg.Database.FILE_QUEUE_SIZE)
-
-	stockHandler := &index.Handler{
-		CFG:       cfg,
-		LOG:       stockLog,
-		DB:        db,
-		GT:        genresTree,
-		BookQueue: bookQueue,
-		FileQueue: fileQueue,
+// InitIndexerOnce initializes the indexers of all libraries for one-time scanning.
+func (a *App) InitIndexerOnce(cfg *config.Config, db *store.DB, genresTree *genres.GenresTree, ingestRules *rules.Rules, stockLog *rlog.Log) []*index.Handler {
+	stockHandlers := make([]*index.Handler, 0, len(cfg.Libraries))
+	for _, lib := range cfg.Libraries {
+		stockHandlers = append(stockHandlers, a.initLibraryIndexerOnce(cfg.ForLibrary(lib), db.ForLibrary(lib.ID), genresTree, ingestRules, stockLog))
 	}
+	return stockHandlers
+}
 
-	stockHandler.StopDB = make(chan struct{})
-	stockHandler.StopScan = make(chan struct{})
-	stockHandler.Hashes = hash.InitHashes(db.DB)
-
-	stockHandler.InitStockFolders()
-
-	go stockHandler.AddBooksToIndex()
-	for i := 0; i < cfg.Database.MAX_SCAN_THREADS; i++ {
-		go stockHandler.ParseFB2Queue()
-	}
+func (a *App) initLibraryIndexerOnce(cfg *config.Config, db *store.DB, genresTree *genres.GenresTree, ingestRules *rules.Rules, stockLog *rlog.Log) *index.Handler {
+	stockHandler := newLibraryHandler(cfg, db, covers.NewCache(cfg.Covers.CACHE_DIR, cfg.Covers.THUMBNAIL_SIZES), genresTree, ingestRules, stockLog)
 
 	dir := cfg.Library.STOCK_DIR
 	if len(cfg.Library.NEW_DIR) > 0 {
 		dir = cfg.Library.NEW_DIR
 	}
 	stockHandler.ScanDir(dir)
+	for !stockHandler.Idle() {
+		time.Sleep(time.Second)
+	}
 
 	return stockHandler
 }
 
-// InitIndexer initializes the indexer with background scanning.
-func (a *App) InitIndexer(cfg *config.Config, db *store.DB, genresTree *genres.GenresTree, stockLog *rlog.Log) *index.Handler {
-	bookQueue := make(chan model.Book, cfg.Database.BOOK_QUEUE_SIZE)
-	fileQueue := make(chan index.File, cfg.Database.FILE_QUEUE_SIZE)
+// InitReconcilerOnce initializes the indexers of all libraries for one-time stock reconciliation.
+func (a *App) InitReconcilerOnce(cfg *config.Config, db *store.DB, genresTree *genres.GenresTree, ingestRules *rules.Rules, stockLog *rlog.Log) []*index.Handler {
+	stockHandlers := make([]*index.Handler, 0, len(cfg.Libraries))
+	for _, lib := range cfg.Libraries {
+		stockHandlers = append(stockHandlers, a.initLibraryReconcilerOnce(cfg.ForLibrary(lib), db.ForLibrary(lib.ID), genresTree, ingestRules, stockLog))
+	}
+	return stockHandlers
+}
 
-	stockHandler := &index.Handler{
-		CFG:       cfg,
-		LOG:       stockLog,
-		DB:        db,
-		GT:        genresTree,
-		BookQueue: bookQueue,
-		FileQueue: fileQueue,
+func (a *App) initLibraryReconcilerOnce(cfg *config.Config, db *store.DB, genresTree *genres.GenresTree, ingestRules *rules.Rules, stockLog *rlog.Log) *index.Handler {
+	stockHandler := newLibraryHandler(cfg, db, covers.NewCache(cfg.Covers.CACHE_DIR, cfg.Covers.THUMBNAIL_SIZES), genresTree, ingestRules, stockLog)
+
+	stockHandler.Reconcile()
+	for !stockHandler.Idle() {
+		time.Sleep(time.Second)
 	}
 
-	stockHandler.StopDB = make(chan struct{})
-	stockHandler.StopScan = make(chan struct{})
-	stockHandler.Hashes = hash.InitHashes(db.DB)
+	return stockHandler
+}
+
+// newLibraryHandler creates the indexer of the library with its queues and starts the routines adding books to index,
+// parsing files, reading zip archives and caching covers, cache may be nil
+func newLibraryHandler(cfg *config.Config, db *store.DB, cache *covers.Cache, genresTree *genres.GenresTree, ingestRules *rules.Rules, stockLog *rlog.Log) *index.Handler {
+	stockHandler := &index.Handler{
+		CFG:         cfg,
+		LOG:         stockLog,
+		DB:          db,
+		GT:          genresTree,
+		Rules:       ingestRules,
+		Covers:      cache,
+		BookQueue:   make(chan model.Book, cfg.Database.BOOK_QUEUE_SIZE),
+		FileQueue:   make(chan index.File, cfg.Database.FILE_QUEUE_SIZE),
+		ZipQueue:    make(chan index.Zip, cfg.Database.MAX_ZIP_THREADS),
+		CoverQueue:  make(chan index.Cover, cfg.Database.BOOK_QUEUE_SIZE),
+		StopDB:      make(chan struct{}),
+		HashReload:  make(chan chan struct{}),
+		StopScan:    make(chan struct{}),
+		StopWorkers: make(chan struct{}),
+	}
+	stockHandler.Hashes = hash.InitHashes(db.DB, db.Library, cfg.Database.HASHES)
 
 	stockHandler.InitStockFolders()
 
 	go stockHandler.AddBooksToIndex()
 	for i := 0; i < cfg.Database.MAX_SCAN_THREADS; i++ {
-		go stockHandler.ParseFB2Queue()
+		go stockHandler.ParseFileQueue()
+		go stockHandler.CacheCovers()
+	}
+	for i := 0; i < cfg.Database.MAX_ZIP_THREADS; i++ {
+		go stockHandler.ReadZipQueue()
+	}
+
+	return stockHandler
+}
+
+// InitImporter initializes the indexer of the library for catalog import and export, no scanning is started.
+func (a *App) InitImporter(cfg *config.Config, lib config.Library, db *store.DB, genresTree *genres.GenresTree, ingestRules *rules.Rules, stockLog *rlog.Log) *index.Handler {
+	cfg, db = cfg.ForLibrary(lib), db.ForLibrary(lib.ID)
+	stockHandler := &index.Handler{
+		CFG:   cfg,
+		LOG:   stockLog,
+		DB:    db,
+		GT:    genresTree,
+		Rules: ingestRules,
+	}
+	stockHandler.Hashes = hash.InitHashes(db.DB, db.Library, cfg.Database.HASHES)
+	stockHandler.InitStockFolders()
+
+	return stockHandler
+}
+
+// InitIndexer initializes the indexers of all libraries with background scanning.
+func (a *App) InitIndexer(cfg *config.Config, db *store.DB, genresTree *genres.GenresTree, ingestRules *rules.Rules, stockLog *rlog.Log) []*index.Handler {
+	stockHandlers := make([]*index.Handler, 0, len(cfg.Libraries))
+	for _, lib := range cfg.Libraries {
+		stockHandlers = append(stockHandlers, a.initLibraryIndexer(cfg.ForLibrary(lib), db.ForLibrary(lib.ID), genresTree, ingestRules, stockLog))
+	}
+	return stockHandlers
+}
+
+func (a *App) initLibraryIndexer(cfg *config.Config, db *store.DB, genresTree *genres.GenresTree, ingestRules *rules.Rules, stockLog *rlog.Log) *index.Handler {
+	stockHandler := newLibraryHandler(cfg, db, covers.NewCache(cfg.Covers.CACHE_DIR, cfg.Covers.THUMBNAIL_SIZES), genresTree, ingestRules, stockLog)
+	stockHandler.BuildID = db.BuildID()
+	go stockHandler.BackfillSHA256()
+	go stockHandler.LoadLazyBooks()
+
+	dir := cfg.Library.STOCK_DIR
+	if len(cfg.Library.NEW_DIR) > 0 {
+		dir = cfg.Library.NEW_DIR
+	}
+
+	if cfg.Database.SCAN_MODE == "watch" {
+		watcher, err := stockHandler.NewDirWatcher(dir)
+		if err == nil {
+			go watchNewAcquisitions(cfg, stockHandler, watcher, dir)
+			return stockHandler
+		}
+		stockLog.W.Printf("Folder watching is not available, polling is used instead: %v\n", err)
 	}
 
 	go func() {
 		defer func() { stockHandler.StopScan <- struct{}{} }()
-		dir := cfg.Library.STOCK_DIR
-		if len(cfg.Library.NEW_DIR) > 0 {
-			dir = cfg.Library.NEW_DIR
-		}
+		lastReconcile := time.Time{}
 		for {
+			reloadAfterReindex(cfg, stockHandler, dir)
+			reconcileStock(cfg, stockHandler, &lastReconcile)
 			stockHandler.ScanDir(dir)
 			time.Sleep(time.Duration(cfg.Database.POLL_DELAY) * time.Second)
 			select {
@@ -91,3 +157,49 @@ func (a *App) InitIndexer(cfg *config.Config, db *store.DB, genresTree *genres.G
 
 	return stockHandler
 }
+
+// watchNewAcquisitions processes files as soon as watcher reports them and runs full scan every POLL_DELAY seconds
+func watchNewAcquisitions(cfg *config.Config, stockHandler *index.Handler, watcher *index.Watcher, dir string) {
+	defer func() { stockHandler.StopScan <- struct{}{} }()
+	defer watcher.Close()
+	lastReconcile := time.Time{}
+	reconcileStock(cfg, stockHandler, &lastReconcile)
+	stockHandler.ScanDir(dir)
+	fullScan := time.NewTicker(time.Duration(cfg.Database.POLL_DELAY) * time.Second)
+	defer fullScan.Stop()
+	for {
+		select {
+		case path, ok := <-watcher.Events:
+			if !ok {
+				stockHandler.LOG.E.Println("Folder watcher was stopped, polling is used instead")
+				watcher.Events = nil
+				continue
+			}
+			stockHandler.ScanFile(dir, path)
+		case err := <-watcher.Errors:
+			stockHandler.LOG.W.Println(err)
+		case <-fullScan.C:
+			reloadAfterReindex(cfg, stockHandler, dir)
+			reconcileStock(cfg, stockHandler, &lastReconcile)
+			stockHandler.ScanDir(dir)
+		case <-stockHandler.StopScan:
+			return
+		}
+	}
+}
+
+// reconcileStock runs stock reconciliation when RECONCILE_DELAY seconds have passed since the last one
+func reconcileStock(cfg *config.Config, stockHandler *index.Handler, last *time.Time) {
+	if cfg.Database.RECONCILE_DELAY <= 0 || time.Since(*last) < time.Duration(cfg.Database.RECONCILE_DELAY)*time.Second {
+		return
+	}
+	stockHandler.Reconcile()
+	*last = time.Now()
+}
+
+// reloadAfterReindex reloads book hashes after the index was rebuilt and adds stock files the rebuild could miss
+func reloadAfterReindex(cfg *config.Config, stockHandler *index.Handler, dir string) {
+	if stockHandler.ReloadHashes() && dir != cfg.Library.STOCK_DIR {
+		stockHandler.ScanDir(cfg.Library.STOCK_DIR)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/vinser/flibgolite/internal/core/config"
+	"github.com/vinser/flibgolite/internal/covers"
 	"github.com/vinser/flibgolite/internal/genres"
 	"github.com/vinser/flibgolite/internal/opds"
 	"github.com/vinser/flibgolite/internal/rlog"
@@ -20,6 +21,8 @@ func (a *App) InitOPDS(cfg *config.Config, db *store.DB, genresTree *genres.Genr
 		DB:  db,
 		GT:  genresTree,
 		MP:  make(map[string]*message.Printer, len(cfg.Locales.Languages)),
+
+		Covers: covers.NewCache(cfg.Covers.CACHE_DIR, cfg.Covers.THUMBNAIL_SIZES),
 	}
 
 	for k, v := range cfg.Locales.Languages {
@@ -0,0 +1,78 @@
+package app
+
+import (
+	"time"
+
+	"github.com/vinser/flibgolite/internal/core/config"
+	"github.com/vinser/flibgolite/internal/covers"
+	"github.com/vinser/flibgolite/internal/genres"
+	"github.com/vinser/flibgolite/internal/rlog"
+	"github.com/vinser/flibgolite/internal/rules"
+	"github.com/vinser/flibgolite/internal/store"
+)
+
+// Reindex builds a fresh index of the book stock in a temporary database and then replaces the index content with it.
+// OPDS server keeps serving the old index until the build is finished and reloads book hashes afterwards.
+// Covers are cached by new book ids in the folder of the rebuilt index cover cache id, so the restored index
+// switches to its covers at once, covers of the old index are pruned afterwards.
+func (a *App) Reindex(cfg *config.Config, genresTree *genres.GenresTree, ingestRules *rules.Rules, stockLog *rlog.Log) error {
+	tmpDSN := cfg.Database.DSN + ".reindex"
+	store.RemoveFiles(tmpDSN)
+	defer store.RemoveFiles(tmpDSN)
+	tmp, err := store.NewDB(tmpDSN)
+	if err != nil {
+		return err
+	}
+	tmp.InitDB()
+	cache := covers.NewCache(cfg.Covers.CACHE_DIR, cfg.Covers.THUMBNAIL_SIZES)
+
+	// library ids of the rebuilt index must be the same the server uses
+	db, err := a.InitDatabase(cfg)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	defer db.Close()
+	// covers of the index that is not served after all are removed
+	defer func() { cache.ForIndex(db.CoversID()).Prune() }()
+	// merged authors must be merged in the rebuilt index too
+	aliases, err := db.AuthorAliases()
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	for alias, a := range aliases {
+		if err := tmp.AddAuthorAlias(alias, a); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	for _, lib := range cfg.Libraries {
+		if err := tmp.SetLibraryID(lib.ID, lib.NAME); err != nil {
+			tmp.Close()
+			return err
+		}
+		a.reindexLibrary(cfg.ForLibrary(lib), tmp.ForLibrary(lib.ID), cache, genresTree, ingestRules, stockLog)
+	}
+
+	err = tmp.SetBuildID()
+	tmp.Close()
+	if err != nil {
+		return err
+	}
+	stockLog.S.Println("Book stock was indexed, index content is being replaced...")
+
+	return db.Restore(tmpDSN)
+}
+
+// reindexLibrary indexes the library stock to the database and the cover cache and waits until all books are added
+func (a *App) reindexLibrary(cfg *config.Config, db *store.DB, cache *covers.Cache, genresTree *genres.GenresTree, ingestRules *rules.Rules, stockLog *rlog.Log) {
+	stockHandler := newLibraryHandler(cfg, db, cache, genresTree, ingestRules, stockLog)
+	stockHandler.ScanDir(cfg.Library.STOCK_DIR)
+	for !stockHandler.Idle() {
+		time.Sleep(time.Second)
+	}
+	stockHandler.StopDB <- struct{}{}
+	<-stockHandler.StopDB
+	close(stockHandler.StopWorkers)
+}
@@ -0,0 +1,17 @@
+package app
+
+import (
+	"log"
+
+	"github.com/vinser/flibgolite/internal/core/config"
+	"github.com/vinser/flibgolite/internal/rules"
+)
+
+// InitRules loads the metadata normalization rules.
+func (a *App) InitRules(cfg *config.Config) *rules.Rules {
+	ingestRules, err := rules.LoadRules(cfg.Rules.FILE)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return ingestRules
+}
@@ -6,6 +6,8 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 
 	"github.com/vinser/flibgolite/internal/locales"
 	"github.com/vinser/flibgolite/internal/rlog"
@@ -17,22 +19,42 @@ import (
 // See config.yml for comments about this struct
 
 type Library struct {
-	STOCK_DIR string `yaml:"STOCK"`
-	TRASH_DIR string `yaml:"TRASH"`
-	NEW_DIR   string `yaml:"NEW"`
+	NAME              string `yaml:"NAME"`
+	TITLE             string `yaml:"TITLE"`
+	STOCK_DIR         string `yaml:"STOCK"`
+	TRASH_DIR         string `yaml:"TRASH"`
+	NEW_DIR           string `yaml:"NEW"`
+	ACCEPTED          string `yaml:"ACCEPTED"`
+	DEDUPLICATE_LEVEL string `yaml:"DEDUPLICATE_LEVEL"`
+	ID                int64  `yaml:"-"` // database id of the library
 }
 type Database struct {
-	DSN               string `yaml:"DSN"`
-	POLL_DELAY        int    `yaml:"POLL_DELAY"`
-	MAX_SCAN_THREADS  int    `yaml:"MAX_SCAN_THREADS"`
-	BOOK_QUEUE_SIZE   int    `yaml:"BOOK_QUEUE_SIZE"`
-	FILE_QUEUE_SIZE   int    `yaml:"FILE_QUEUE_SIZE"`
-	MAX_BOOKS_IN_TX   int    `yaml:"MAX_BOOKS_IN_TX"`
-	DEDUPLICATE_LEVEL string `yaml:"DEDUPLICATE_LEVEL"`
+	DSN                 string  `yaml:"DSN"`
+	POLL_DELAY          int     `yaml:"POLL_DELAY"`
+	SCAN_MODE           string  `yaml:"SCAN_MODE"`
+	RECONCILE_DELAY     int     `yaml:"RECONCILE_DELAY"`
+	MAX_SCAN_THREADS    int     `yaml:"MAX_SCAN_THREADS"`
+	MAX_ZIP_THREADS     int     `yaml:"MAX_ZIP_THREADS"`
+	BOOK_QUEUE_SIZE     int     `yaml:"BOOK_QUEUE_SIZE"`
+	FILE_QUEUE_SIZE     int     `yaml:"FILE_QUEUE_SIZE"`
+	MAX_BOOKS_IN_TX     int     `yaml:"MAX_BOOKS_IN_TX"`
+	HASHES              string  `yaml:"HASHES"`
+	LANGUAGE_CONFIDENCE float64 `yaml:"LANGUAGE_CONFIDENCE"`
+	DEDUPLICATE_LEVEL   string  `yaml:"DEDUPLICATE_LEVEL"`
+	VERSION_SIMILARITY  float64 `yaml:"VERSION_SIMILARITY"`
+	VERSION_POLICY      string  `yaml:"VERSION_POLICY"`
+	VERSION_FORMATS     string  `yaml:"VERSION_FORMATS"`
 }
 type Genres struct {
 	TREE_FILE string `yaml:"TREE_FILE"`
 }
+type Rules struct {
+	FILE string `yaml:"FILE"`
+}
+type Covers struct {
+	CACHE_DIR       string `yaml:"CACHE_DIR"`
+	THUMBNAIL_SIZES string `yaml:"THUMBNAIL_SIZES"`
+}
 type Logs struct {
 	OPDS  string `yaml:"OPDS"`
 	SCAN  string `yaml:"SCAN"`
@@ -44,6 +66,7 @@ type OPDS struct {
 	PAGE_SIZE     int    `yaml:"PAGE_SIZE"`
 	LATEST_DAYS   int    `yaml:"LATEST_DAYS"`
 	NO_CONVERSION bool   `yaml:"NO_CONVERSION"`
+	ADMIN         bool   `yaml:"ADMIN"`
 }
 type Auth struct {
 	METHOD string `yaml:"METHOD"`
@@ -52,12 +75,15 @@ type Auth struct {
 }
 
 type Config struct {
-	Library  Library  `yaml:"library"`
-	Database Database `yaml:"database"`
-	Genres   Genres   `yaml:"genres"`
-	Logs     Logs     `yaml:"logs"`
-	OPDS     OPDS     `yaml:"opds"`
-	Auth     Auth     `yaml:"auth"`
+	Library   Library   `yaml:"library"`
+	Libraries []Library `yaml:"libraries"`
+	Database  Database  `yaml:"database"`
+	Genres    Genres    `yaml:"genres"`
+	Rules     Rules     `yaml:"rules"`
+	Covers    Covers    `yaml:"covers"`
+	Logs      Logs      `yaml:"logs"`
+	OPDS      OPDS      `yaml:"opds"`
+	Auth      Auth      `yaml:"auth"`
 	locales.Locales
 }
 
@@ -107,17 +133,32 @@ func LoadConfig(rootDir string) *Config {
 			NEW_DIR:   "",
 		},
 		Database: Database{
-			DSN:               "dbdata/books.db",
-			POLL_DELAY:        300,
-			MAX_SCAN_THREADS:  10,
-			BOOK_QUEUE_SIZE:   20000,
-			FILE_QUEUE_SIZE:   20000,
-			MAX_BOOKS_IN_TX:   20000,
-			DEDUPLICATE_LEVEL: "F",
+			DSN:                 "dbdata/books.db",
+			POLL_DELAY:          300,
+			SCAN_MODE:           "poll",
+			RECONCILE_DELAY:     86400,
+			MAX_SCAN_THREADS:    0,
+			MAX_ZIP_THREADS:     2,
+			BOOK_QUEUE_SIZE:     20000,
+			FILE_QUEUE_SIZE:     20000,
+			MAX_BOOKS_IN_TX:     20000,
+			HASHES:              "memory",
+			LANGUAGE_CONFIDENCE: 0.8,
+			DEDUPLICATE_LEVEL:   "F",
+			VERSION_SIMILARITY:  0.85,
+			VERSION_POLICY:      "cover, format, largest, newest",
+			VERSION_FORMATS:     "epub, fb2, azw3, mobi, pdf, cbz",
 		},
 		Genres: Genres{
 			TREE_FILE: "config/genres.xml",
 		},
+		Rules: Rules{
+			FILE: "config/rules.yml",
+		},
+		Covers: Covers{
+			CACHE_DIR:       "dbdata/covers",
+			THUMBNAIL_SIZES: "100, 200",
+		},
 		Logs: Logs{
 			OPDS:  "logs/opds.log",
 			SCAN:  "logs/scan.log",
@@ -129,6 +170,7 @@ func LoadConfig(rootDir string) *Config {
 			PAGE_SIZE:     20,
 			LATEST_DAYS:   14,
 			NO_CONVERSION: false,
+			ADMIN:         false,
 		},
 		Locales: locales.Locales{
 			DIR:      "config/locales",
@@ -145,22 +187,94 @@ func LoadConfig(rootDir string) *Config {
 		log.Fatal(err)
 	}
 
-	c.Library.STOCK_DIR = makeAbs(rootDir, c.Library.STOCK_DIR)
-	if len(c.Library.TRASH_DIR) > 0 {
-		c.Library.TRASH_DIR = makeAbs(rootDir, c.Library.TRASH_DIR)
+	if c.Database.MAX_SCAN_THREADS <= 0 {
+		c.Database.MAX_SCAN_THREADS = runtime.NumCPU()
 	}
-	if len(c.Library.NEW_DIR) > 0 {
-		c.Library.NEW_DIR = makeAbs(rootDir, c.Library.NEW_DIR)
+	if c.Database.MAX_ZIP_THREADS <= 0 {
+		c.Database.MAX_ZIP_THREADS = 1
+	}
+
+	// single library section is the only library without name
+	if len(c.Libraries) == 0 {
+		c.Libraries = []Library{c.Library}
+	}
+	names := make(map[string]struct{}, len(c.Libraries))
+	for i := range c.Libraries {
+		lib := &c.Libraries[i]
+		if lib.NAME == "" && len(c.Libraries) > 1 {
+			log.Fatal("libraries must have NAME")
+		}
+		if _, ok := names[lib.NAME]; ok {
+			log.Fatalf("library NAME %q is used more than once", lib.NAME)
+		}
+		names[lib.NAME] = struct{}{}
+		if lib.STOCK_DIR == "" {
+			log.Fatalf("library %q has no STOCK folder", lib.NAME)
+		}
+		if lib.TITLE == "" {
+			lib.TITLE = lib.NAME
+		}
+		if lib.ACCEPTED == "" {
+			lib.ACCEPTED = c.Locales.ACCEPTED
+		}
+		if lib.DEDUPLICATE_LEVEL == "" {
+			lib.DEDUPLICATE_LEVEL = c.Database.DEDUPLICATE_LEVEL
+		}
+		lib.STOCK_DIR = makeAbs(rootDir, lib.STOCK_DIR)
+		lib.TRASH_DIR = makeAbs(rootDir, lib.TRASH_DIR)
+		lib.NEW_DIR = makeAbs(rootDir, lib.NEW_DIR)
 	}
+	c.Library = c.Libraries[0]
 	c.Locales.DIR = makeAbs(rootDir, c.Locales.DIR)
 	c.Genres.TREE_FILE = makeAbs(rootDir, c.Genres.TREE_FILE)
+	c.Rules.FILE = makeAbs(rootDir, c.Rules.FILE)
 	c.Database.DSN = makeAbs(rootDir, c.Database.DSN)
+	c.Covers.CACHE_DIR = makeAbs(rootDir, c.Covers.CACHE_DIR)
 	c.Logs.OPDS = makeAbs(rootDir, c.Logs.OPDS)
 	c.Logs.SCAN = makeAbs(rootDir, c.Logs.SCAN)
 
 	return c
 }
 
+// ForLibrary returns the copy of config with the folders, accepted languages and deduplication level of the library
+func (c *Config) ForLibrary(lib Library) *Config {
+	lc := *c
+	lc.Library = lib
+	lc.Locales.ACCEPTED = lib.ACCEPTED
+	lc.Database.DEDUPLICATE_LEVEL = lib.DEDUPLICATE_LEVEL
+	return &lc
+}
+
+// LibraryByID returns the library with database id, the first library if there is no such one
+func (c *Config) LibraryByID(id int64) Library {
+	for _, lib := range c.Libraries {
+		if lib.ID == id {
+			return lib
+		}
+	}
+	return c.Libraries[0]
+}
+
+// LibraryByName returns the library with the name
+func (c *Config) LibraryByName(name string) (Library, bool) {
+	for _, lib := range c.Libraries {
+		if lib.NAME == name {
+			return lib, true
+		}
+	}
+	return Library{}, false
+}
+
+// LibraryOf returns the library which stock folder contains the path, the first library if there is no such one
+func (c *Config) LibraryOf(path string) Library {
+	for _, lib := range c.Libraries {
+		if rel, err := filepath.Rel(lib.STOCK_DIR, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return lib
+		}
+	}
+	return c.Libraries[0]
+}
+
 func (c *Config) InitLogs(needOpds bool) (stockLog, opdsLog *rlog.Log) {
 	stockLog = nil
 	opdsLog = nil
@@ -1,9 +1,10 @@
 package model
 
 type Language struct {
-	ID   int64
-	Code string
-	Name string
+	ID         int64
+	Code       string
+	Name       string
+	Confidence float64 // of the language detected in the book text, 0 if the language is declared in the book
 }
 
 type Author struct {
@@ -13,25 +14,59 @@ type Author struct {
 	Count int // for intermediate keeping author book counts
 }
 
+// Contributor roles, MARC relator codes as they are used by EPUB
+const (
+	TranslatorRole  = "trl"
+	IllustratorRole = "ill"
+	EditorRole      = "edt"
+)
+
+// Contributor is a person who contributed to the book other than its author
+type Contributor struct {
+	Author
+	Role string // TranslatorRole, IllustratorRole or EditorRole
+}
+
 type Book struct {
-	ID       int64
-	File     string
-	CRC32    uint32
-	Archive  string
-	Size     int64
-	Format   string
-	Title    string
-	Sort     string
-	Year     string
-	Plot     string
-	Cover    string
-	Language *Language
-	Authors  []*Author
-	Genres   []string
-	Keywords string
-	Serie    *Serie
-	SerieNum int
-	Updated  int64
+	ID           int64
+	File         string
+	CRC32        uint32
+	SHA256       string
+	Archive      string
+	Size         int64
+	Format       string
+	Title        string
+	Sort         string
+	Year         string
+	Plot         string
+	Cover        string
+	Language     *Language
+	Authors      []*Author
+	Contributors []*Contributor // translators, illustrators and editors
+	Genres       []string
+	Keywords     string
+	Serie        *Serie
+	SerieNum     int
+	Series       []*BookSerie // all series the book is part of, Serie and SerieNum are the main one
+	ISBN         string       // comma separated ISBNs
+	Publisher    string
+	City         string // of publication
+	SrcLang      string // original language code of the translated book
+	SrcTitle     string // original title of the translated book
+	Pages        int    // number of page images of comics
+	Updated      int64
+	Library      int64  // id of the library the book file is in
+	Error        string // why the file was rejected, see IngestStatus
+}
+
+// IngestStatus is a record of the stock file or archive rejected by indexer
+type IngestStatus struct {
+	ID      int64
+	File    string
+	Archive string
+	State   int64 // negative hash.BookState
+	Error   string
+	Updated int64
 }
 
 type Genre struct {
@@ -46,3 +81,16 @@ type Serie struct {
 	Name  string
 	Count int // for intermediate keeping serie book counts
 }
+
+// Series roles, the book series is either set by the author or by the publisher
+const (
+	AuthorSerie    = "author"
+	PublisherSerie = "publisher"
+)
+
+// BookSerie is the series the book is part of with the book number in it
+type BookSerie struct {
+	Serie
+	Role   string // AuthorSerie, PublisherSerie or empty if unknown
+	Number string // as it is in the book, e.g. 2, 2.5 or III
+}
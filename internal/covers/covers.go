@@ -0,0 +1,203 @@
+package covers
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/nfnt/resize"
+	"github.com/vinser/flibgolite/internal/core/model"
+	"github.com/vinser/flibgolite/internal/parsers/cbz"
+	"github.com/vinser/flibgolite/internal/parsers/epub"
+	"github.com/vinser/flibgolite/internal/parsers/fb2"
+	"github.com/vinser/flibgolite/internal/parsers/mobi"
+	"github.com/vinser/flibgolite/internal/parsers/pdf"
+)
+
+// JPEG_QUALITY is the quality of cached covers and thumbnails
+const JPEG_QUALITY = 90
+
+// DEFAULT_THUMBNAIL_SIZE is the thumbnail width when no sizes are configured
+const DEFAULT_THUMBNAIL_SIZE = 100
+
+// INDEX_DIR_PREFIX starts the names of index cover folders, only such folders are pruned
+const INDEX_DIR_PREFIX = "idx-"
+
+// Cache keeps book covers and their thumbnails as JPEG files named by book id in subfolders by last id digits,
+// e.g. 456/123456.jpg is the cover of book 123456 and 456/123456-100.jpg is its thumbnail 100 pixels wide.
+// Book ids are reused by a new or rebuilt index, so covers are kept in the folder named by the index cover cache id,
+// e.g. idx-lq3k9x2b1c/456/123456.jpg. Nil cache keeps nothing
+type Cache struct {
+	Dir   string
+	ID    string // cover cache id of the index
+	Sizes []int  // thumbnail widths, the first is the default one
+}
+
+// NewCache returns the cache in dir with comma separated thumbnail widths, nil if dir is empty
+func NewCache(dir, sizes string) *Cache {
+	if dir == "" {
+		return nil
+	}
+	return &Cache{Dir: dir, Sizes: ParseSizes(sizes)}
+}
+
+// ForIndex returns the cache of the index with cover cache id
+func (c *Cache) ForIndex(id string) *Cache {
+	if c == nil {
+		return nil
+	}
+	ic := *c
+	ic.ID = id
+	return &ic
+}
+
+// ParseSizes returns the valid widths of comma separated list in their order without repeats
+func ParseSizes(sizes string) []int {
+	widths := []int{}
+	for _, s := range strings.Split(sizes, ",") {
+		w, err := strconv.Atoi(strings.TrimSpace(s))
+		if err == nil && w > 0 && !slices.Contains(widths, w) {
+			widths = append(widths, w)
+		}
+	}
+	if len(widths) == 0 {
+		widths = append(widths, DEFAULT_THUMBNAIL_SIZE)
+	}
+	return widths
+}
+
+// ThumbnailSize returns the smallest configured width not less than width, the largest one if there is no such,
+// the default one if width is 0
+func ThumbnailSize(sizes []int, width int) int {
+	if width <= 0 {
+		return sizes[0]
+	}
+	sorted := slices.Sorted(slices.Values(sizes))
+	for _, s := range sorted {
+		if s >= width {
+			return s
+		}
+	}
+	return sorted[len(sorted)-1]
+}
+
+// Path returns the file path of the cover, of its thumbnail if size > 0
+func (c *Cache) Path(bookId int64, size int) string {
+	name := strconv.FormatInt(bookId, 10)
+	if size > 0 {
+		name += "-" + strconv.Itoa(size)
+	}
+	return filepath.Join(c.Dir, INDEX_DIR_PREFIX+c.ID, fmt.Sprintf("%03d", bookId%1000), name+".jpg")
+}
+
+// Put stores the cover and its thumbnails, the cover is not enlarged
+func (c *Cache) Put(bookId int64, img image.Image) error {
+	if c == nil {
+		return nil
+	}
+	if err := writeJPEG(c.Path(bookId, 0), img); err != nil {
+		return err
+	}
+	for _, size := range c.Sizes {
+		if err := writeJPEG(c.Path(bookId, size), Thumbnail(img, size)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Fill extracts the book cover from the stock and stores it with its thumbnails
+func (c *Cache) Fill(stock string, book *model.Book) error {
+	if c == nil || book.Cover == "" {
+		return nil
+	}
+	img, err := Image(stock, book)
+	if err != nil {
+		return fmt.Errorf("cover of book %d: %w", book.ID, err)
+	}
+	return c.Put(book.ID, img)
+}
+
+// Remove removes the covers and thumbnails of the books
+func (c *Cache) Remove(books []*model.Book) {
+	if c == nil {
+		return
+	}
+	for _, b := range books {
+		for _, size := range append([]int{0}, c.Sizes...) {
+			os.Remove(c.Path(b.ID, size))
+		}
+	}
+}
+
+// Prune removes covers of other indexes, other files and folders are kept as cache dir may be shared
+func (c *Cache) Prune() error {
+	if c == nil || c.ID == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(c.Dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() && strings.HasPrefix(e.Name(), INDEX_DIR_PREFIX) && e.Name() != INDEX_DIR_PREFIX+c.ID {
+			if err := os.RemoveAll(filepath.Join(c.Dir, e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Thumbnail returns the image scaled down to width with Lanczos resampling, smaller image is returned as is
+func Thumbnail(img image.Image, width int) image.Image {
+	if img.Bounds().Dx() <= width {
+		return img
+	}
+	return resize.Resize(uint(width), 0, img, resize.Lanczos3)
+}
+
+// Image decodes the cover image of the book from the stock
+func Image(stock string, book *model.Book) (image.Image, error) {
+	switch book.Format {
+	case "fb2":
+		return fb2.GetCoverImage(stock, book)
+	case "epub":
+		return epub.GetCoverImage(stock, book)
+	case "pdf":
+		return pdf.GetCoverImage(stock, book)
+	case "mobi", "azw", "azw3":
+		return mobi.GetCoverImage(stock, book)
+	case "cbz":
+		return cbz.GetCoverImage(stock, book)
+	}
+	return nil, fmt.Errorf("no covers for format %s", book.Format)
+}
+
+// writeJPEG writes the image to the temporary file and renames it, so readers never see partly written file
+func writeJPEG(name string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0775); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(name), ".cover-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	err = f.Chmod(0664)
+	if err == nil {
+		err = jpeg.Encode(f, img, &jpeg.Options{Quality: JPEG_QUALITY})
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
@@ -0,0 +1,97 @@
+package covers
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseSizes(t *testing.T) {
+	var testSizes = []struct {
+		sizes  string
+		widths []int
+	}{
+		{"240", []int{240}},
+		{"320, 120,480", []int{320, 120, 480}},
+		{"120,x,-5,0,120, 240 ", []int{120, 240}},
+		{"", []int{DEFAULT_THUMBNAIL_SIZE}},
+		{"none", []int{DEFAULT_THUMBNAIL_SIZE}},
+	}
+
+	for _, s := range testSizes {
+		if widths := ParseSizes(s.sizes); !slices.Equal(widths, s.widths) {
+			t.Errorf("%q: expecting %v, got: %v", s.sizes, s.widths, widths)
+		}
+	}
+}
+
+func TestThumbnailSize(t *testing.T) {
+	sizes := []int{320, 120, 480} // the first one is default
+	var testWidths = []struct {
+		width int
+		size  int
+	}{
+		{0, 320},
+		{-10, 320},
+		{1, 120},
+		{120, 120},
+		{121, 320},
+		{320, 320},
+		{400, 480},
+		{480, 480},
+		{1000, 480},
+	}
+
+	for _, w := range testWidths {
+		if size := ThumbnailSize(sizes, w.width); size != w.size {
+			t.Errorf("%d: expecting %d, got: %d", w.width, w.size, size)
+		}
+	}
+
+	if size := ThumbnailSize([]int{240}, 1000); size != 240 {
+		t.Errorf("Expecting the only size 240, got: %d", size)
+	}
+	if !slices.Equal(sizes, []int{320, 120, 480}) {
+		t.Errorf("Expecting sizes are not reordered, got: %v", sizes)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	old := NewCache(dir, "100").ForIndex("old")
+	cur := NewCache(dir, "100").ForIndex("cur")
+	for _, c := range []*Cache{old, cur} {
+		if err := c.Put(123456, image.NewGray(image.Rect(0, 0, 200, 300))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// cache dir may be shared with database or books
+	for _, name := range []string{"books.db", "stock/book.fb2", "idx-file"} {
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0775)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("keep"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := cur.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	var testPaths = []struct {
+		path   string
+		exists bool
+	}{
+		{cur.Path(123456, 0), true},
+		{cur.Path(123456, 100), true},
+		{old.Path(123456, 0), false},
+		{filepath.Join(dir, "books.db"), true},
+		{filepath.Join(dir, "stock", "book.fb2"), true},
+		{filepath.Join(dir, "idx-file"), true},
+	}
+	for _, p := range testPaths {
+		if _, err := os.Stat(p.path); (err == nil) != p.exists {
+			t.Errorf("%s: expecting exists %v, got: %v", p.path, p.exists, err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package hash
+
+import (
+	"hash/fnv"
+)
+
+const (
+	bloomBitsPerKey = 16 // keeps false positive rate low when the library doubles after start
+	bloomHashes     = 8
+	bloomMinKeys    = 1 << 14
+)
+
+// bloom is a Bloom filter of string keys, it tells for sure that a key was never added
+type bloom struct {
+	bits []uint64
+	m    uint64
+}
+
+// newBloom returns the Bloom filter sized for n keys
+func newBloom(n int) *bloom {
+	m := uint64(max(n, bloomMinKeys)) * bloomBitsPerKey
+	words := (m + 63) / 64
+	return &bloom{
+		bits: make([]uint64, words),
+		m:    words * 64,
+	}
+}
+
+// positions returns two hashes of the key, the bit positions are derived from them by double hashing
+func (f *bloom) positions(key string) (h1, h2 uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	return sum & 0xffffffff, sum>>32 | 1
+}
+
+func (f *bloom) add(key string) {
+	h1, h2 := f.positions(key)
+	for i := uint64(0); i < bloomHashes; i++ {
+		p := (h1 + i*h2) % f.m
+		f.bits[p/64] |= 1 << (p % 64)
+	}
+}
+
+// test reports whether the key may have been added
+func (f *bloom) test(key string) bool {
+	h1, h2 := f.positions(key)
+	for i := uint64(0); i < bloomHashes; i++ {
+		p := (h1 + i*h2) % f.m
+		if f.bits[p/64]&(1<<(p%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
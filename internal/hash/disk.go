@@ -0,0 +1,161 @@
+package hash
+
+import (
+	"hash/crc32"
+	"log"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/vinser/flibgolite/internal/core/model"
+)
+
+// Book hashes modes
+const (
+	MemoryMode = "memory" // all hashes are kept in memory
+	DiskMode   = "disk"   // hashes are looked up in database behind Bloom filters
+)
+
+// diskHashes answers book hash lookups with indexed database queries.
+// Bloom filters kept in memory skip the queries for keys that were never added
+type diskHashes struct {
+	db        *sqlx.DB
+	library   int64
+	files     *bloom
+	archives  *bloom
+	crc32     *bloom
+	sha256    *bloom
+	titlePlot *bloom
+}
+
+// initDiskHashes fills Bloom filters with the keys of indexed books and rejected files,
+// the maps of returned hashes keep only the books added since the last commit
+func initDiskHashes(db *sqlx.DB, library int64) *BookHashes {
+	count := 0
+	db.QueryRowx(`SELECT (SELECT count(*) FROM books WHERE library_id=?) + (SELECT count(*) FROM ingest_status WHERE library_id=?)`, library, library).Scan(&count)
+	d := &diskHashes{
+		db:        db,
+		library:   library,
+		files:     newBloom(count),
+		archives:  newBloom(count),
+		crc32:     newBloom(count),
+		sha256:    newBloom(count),
+		titlePlot: newBloom(count),
+	}
+	rows, err := db.Query(`SELECT file, archive, crc32, ifnull(sha256, ''), title, plot FROM books WHERE library_id=?`, library)
+	if err != nil {
+		log.Panicln(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		b := &model.Book{}
+		err := rows.Scan(&b.File, &b.Archive, &b.CRC32, &b.SHA256, &b.Title, &b.Plot)
+		if err != nil {
+			log.Panicln(err)
+		}
+		d.addFile(b.File, b.Archive)
+		d.addContent(b)
+		tpBytes := []byte(b.Title + b.Plot)
+		if len(tpBytes) >= MIN_TITLEPLOT_LEN {
+			d.titlePlot.add(crcKey(crc32.ChecksumIEEE(tpBytes)))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Panicln(err)
+	}
+
+	statuses, err := db.Query(`SELECT file, archive FROM ingest_status WHERE library_id=?`, library)
+	if err != nil {
+		log.Panicln(err)
+	}
+	defer statuses.Close()
+	for statuses.Next() {
+		var file, archive string
+		if err := statuses.Scan(&file, &archive); err != nil {
+			log.Panicln(err)
+		}
+		d.addFile(file, archive)
+	}
+
+	bh := newMemoryHashes(0)
+	bh.disk = d
+	return bh
+}
+
+func fileKey(file, archive string) string {
+	return archive + "\x00" + file
+}
+
+func crcKey(crc uint32) string {
+	return strconv.FormatUint(uint64(crc), 16)
+}
+
+func (d *diskHashes) addFile(file, archive string) {
+	if archive != "" {
+		d.archives.add(archive)
+		if file == "" {
+			return
+		}
+	}
+	d.files.add(fileKey(file, archive))
+}
+
+func (d *diskHashes) addContent(b *model.Book) {
+	if b.SHA256 != "" {
+		d.sha256.add(b.SHA256)
+	}
+	if b.CRC32 != 0 {
+		d.crc32.add(crcKey(b.CRC32))
+	}
+}
+
+// exists runs the query returning one boolean, failed query is logged and reported as false
+func (d *diskHashes) exists(query string, args ...any) bool {
+	ok := false
+	if err := d.db.QueryRow(query, args...).Scan(&ok); err != nil {
+		log.Println(err)
+		return false
+	}
+	return ok
+}
+
+func (d *diskHashes) fileExists(file, archive string) bool {
+	if !d.files.test(fileKey(file, archive)) {
+		return false
+	}
+	return d.exists(`SELECT EXISTS (SELECT 1 FROM books WHERE file=? AND archive=? AND library_id=?) OR EXISTS (SELECT 1 FROM ingest_status WHERE file=? AND archive=? AND library_id=?)`,
+		file, archive, d.library, file, archive, d.library)
+}
+
+func (d *diskHashes) archiveExists(archive string) bool {
+	if !d.archives.test(archive) {
+		return false
+	}
+	return d.exists(`SELECT EXISTS (SELECT 1 FROM books WHERE archive=? AND library_id=?) OR EXISTS (SELECT 1 FROM ingest_status WHERE archive=? AND library_id=?)`,
+		archive, d.library, archive, d.library)
+}
+
+// isDuplicate reports whether the content of indexed book is the same, see BookHashes.isDuplicate
+func (d *diskHashes) isDuplicate(b *model.Book) (BookState, bool) {
+	if b.SHA256 != "" && d.sha256.test(b.SHA256) &&
+		d.exists(`SELECT EXISTS (SELECT 1 FROM books WHERE sha256=? AND library_id=?)`, b.SHA256, d.library) {
+		return DuplicateSHA256, true
+	}
+	if b.CRC32 == 0 || !d.crc32.test(crcKey(b.CRC32)) {
+		return Unique, false
+	}
+	query := `SELECT EXISTS (SELECT 1 FROM books WHERE crc32=? AND library_id=?)`
+	if b.SHA256 != "" {
+		query = `SELECT EXISTS (SELECT 1 FROM books WHERE crc32=? AND library_id=? AND ifnull(sha256, '')='')`
+	}
+	if d.exists(query, b.CRC32, d.library) {
+		return DuplicateCRC32, true
+	}
+	return Unique, false
+}
+
+func (d *diskHashes) titlePlotExists(b *model.Book, tpCRC32 uint32) bool {
+	if !d.titlePlot.test(crcKey(tpCRC32)) {
+		return false
+	}
+	return d.exists(`SELECT EXISTS (SELECT 1 FROM books WHERE title=? AND plot=? AND library_id=?)`, b.Title, b.Plot, d.library)
+}
@@ -1,6 +1,7 @@
 package hash
 
 import (
+	"fmt"
 	"hash/crc32"
 	"log"
 	"sync"
@@ -22,52 +23,194 @@ const (
 	UnsupportedFormat
 	FileOpenFailed
 	FileIsNotRegular
+	DuplicateSHA256
+	RejectedByRule
 )
 const MIN_TITLEPLOT_LEN = 128
 
+// stateNames are the book state names used in ingest status reports and feeds
+var stateNames = []struct {
+	State BookState
+	Name  string
+}{
+	{DuplicateCRC32, "duplicate-crc32"},
+	{DuplicateTitlePlot, "duplicate-title-plot"},
+	{FileIsEmpty, "empty-file"},
+	{FileHasErrors, "parse-error"},
+	{LanguageNotAccepted, "language-not-accepted"},
+	{BadArchive, "bad-archive"},
+	{UnsupportedFormat, "unsupported-format"},
+	{FileOpenFailed, "open-failed"},
+	{FileIsNotRegular, "not-regular-file"},
+	{DuplicateSHA256, "duplicate-sha256"},
+	{RejectedByRule, "rejected-by-rule"},
+}
+
+func (s BookState) String() string {
+	for _, sn := range stateNames {
+		if sn.State == s {
+			return sn.Name
+		}
+	}
+	return "unique"
+}
+
+// ParseState returns the book state by its name, Unique stands for "all" states
+func ParseState(name string) (BookState, error) {
+	if name == "" || name == "all" {
+		return Unique, nil
+	}
+	for _, sn := range stateNames {
+		if sn.Name == name {
+			return sn.State, nil
+		}
+	}
+	return Unique, fmt.Errorf("unknown book state %q", name)
+}
+
+// StateNames returns the names of all states of rejected book files
+func StateNames() []string {
+	names := make([]string, 0, len(stateNames))
+	for _, sn := range stateNames {
+		names = append(names, sn.Name)
+	}
+	return names
+}
+
+// CRC32 map values tell whether the book has SHA-256 to compare
+const (
+	crcOnly = 1 // book content is known by CRC32 only, e.g. imported from INPX
+	crcSHA  = 2
+)
+
+// BookHashes tells whether book files are known already and whether book content is a duplicate.
+// In disk mode the maps keep only the books added since the last Commit, others are looked up in database
 type BookHashes struct {
 	Archives  map[string]map[string]int
 	Files     map[string]int
 	CRC32     map[uint32]int
+	SHA256    map[string]int
 	TitlePlot map[uint32]int
+	disk      *diskHashes
 	mx        sync.RWMutex
 }
 
-func InitHashes(db *sqlx.DB) *BookHashes {
-	count := 0
-	db.QueryRowx(`SELECT count(*) FROM books`).Scan(&count)
-	bh := &BookHashes{
-		Archives:  make(map[string]map[string]int),
-		Files:     make(map[string]int),
-		CRC32:     make(map[uint32]int, count),
-		TitlePlot: make(map[uint32]int, count),
+// InitHashes loads the hashes of the library indexed books and rejected files in MemoryMode or DiskMode
+func InitHashes(db *sqlx.DB, library int64, mode string) *BookHashes {
+	if mode == DiskMode {
+		return initDiskHashes(db, library)
 	}
-	rows, err := db.Query(`SELECT file, archive, crc32, title, plot FROM books`)
+	count := 0
+	db.QueryRowx(`SELECT count(*) FROM books WHERE library_id=?`, library).Scan(&count)
+	bh := newMemoryHashes(count)
+	rows, err := db.Query(`SELECT file, archive, crc32, ifnull(sha256, ''), title, plot FROM books WHERE library_id=?`, library)
 	if err != nil {
 		log.Panicln(err)
 	}
 	defer rows.Close()
 	for rows.Next() {
 		b := &model.Book{}
-		err := rows.Scan(&b.File, &b.Archive, &b.CRC32, &b.Title, &b.Plot)
+		err := rows.Scan(&b.File, &b.Archive, &b.CRC32, &b.SHA256, &b.Title, &b.Plot)
 		if err != nil {
 			log.Panicln(err)
 		}
 		bh.Add(b.File, b.Archive)
-		if b.CRC32 != 0 {
-			bh.CRC32[b.CRC32] = 1
-		}
+		bh.addContent(b)
 		tpBytes := []byte(b.Title + b.Plot)
 		if len(tpBytes) >= MIN_TITLEPLOT_LEN {
-			bh.CRC32[crc32.ChecksumIEEE(tpBytes)] = 1
+			bh.TitlePlot[crc32.ChecksumIEEE(tpBytes)] = 1
 		}
 	}
+	if err := rows.Err(); err != nil {
+		log.Panicln(err)
+	}
+
+	// rejected files are known too, so they are not processed again on each scan
+	statuses, err := db.Query(`SELECT file, archive FROM ingest_status WHERE library_id=?`, library)
+	if err != nil {
+		log.Panicln(err)
+	}
+	defer statuses.Close()
+	for statuses.Next() {
+		var file, archive string
+		if err := statuses.Scan(&file, &archive); err != nil {
+			log.Panicln(err)
+		}
+		bh.Add(file, archive)
+	}
 	return bh
 }
 
+func newMemoryHashes(count int) *BookHashes {
+	return &BookHashes{
+		Archives:  make(map[string]map[string]int),
+		Files:     make(map[string]int),
+		CRC32:     make(map[uint32]int, count),
+		SHA256:    make(map[string]int, count),
+		TitlePlot: make(map[uint32]int, count),
+	}
+}
+
+// Replace switches to the hashes of other at once, e.g. after the index was rebuilt
+func (bh *BookHashes) Replace(other *BookHashes) {
+	bh.mx.Lock()
+	defer bh.mx.Unlock()
+	bh.Archives, bh.Files, bh.CRC32, bh.SHA256, bh.TitlePlot = other.Archives, other.Files, other.CRC32, other.SHA256, other.TitlePlot
+	bh.disk = other.disk
+}
+
+// Commit forgets in disk mode the books added so far, they must be committed to database already
+func (bh *BookHashes) Commit() {
+	bh.mx.Lock()
+	defer bh.mx.Unlock()
+	if bh.disk == nil {
+		return
+	}
+	fresh := newMemoryHashes(0)
+	bh.Archives, bh.Files, bh.CRC32, bh.SHA256, bh.TitlePlot = fresh.Archives, fresh.Files, fresh.CRC32, fresh.SHA256, fresh.TitlePlot
+}
+
+// addContent remembers the book content hashes, CRC32 of books without SHA-256 takes precedence
+func (bh *BookHashes) addContent(b *model.Book) {
+	if bh.disk != nil {
+		bh.disk.addContent(b)
+	}
+	if b.SHA256 != "" {
+		bh.SHA256[b.SHA256] = 1
+		if b.CRC32 != 0 && bh.CRC32[b.CRC32] != crcOnly {
+			bh.CRC32[b.CRC32] = crcSHA
+		}
+		return
+	}
+	if b.CRC32 != 0 {
+		bh.CRC32[b.CRC32] = crcOnly
+	}
+}
+
+// isDuplicate reports whether the book content is known already.
+// Books with SHA-256 are compared by SHA-256, CRC32 is used when one of the books has no SHA-256
+func (bh *BookHashes) isDuplicate(b *model.Book) (BookState, bool) {
+	if b.SHA256 != "" {
+		if _, ok := bh.SHA256[b.SHA256]; ok {
+			return DuplicateSHA256, true
+		}
+		if bh.CRC32[b.CRC32] == crcOnly {
+			return DuplicateCRC32, true
+		}
+		return Unique, false
+	}
+	if _, ok := bh.CRC32[b.CRC32]; ok {
+		return DuplicateCRC32, true
+	}
+	return Unique, false
+}
+
 func (bh *BookHashes) Add(file, archive string) {
 	bh.mx.Lock()
 	defer bh.mx.Unlock()
+	if bh.disk != nil {
+		bh.disk.addFile(file, archive)
+	}
 	if archive == "" {
 		bh.Files[file] = 1
 	} else {
@@ -84,22 +227,22 @@ func (bh *BookHashes) FileExists(file, archive string) bool {
 	bh.mx.RLock()
 	defer bh.mx.RUnlock()
 	if archive == "" {
-		_, ok := bh.Files[file]
-		return ok
-	}
-	if _, ok := bh.Archives[archive]; ok {
-		if _, ok := bh.Archives[archive][file]; ok {
+		if _, ok := bh.Files[file]; ok {
 			return true
 		}
+	} else if _, ok := bh.Archives[archive][file]; ok {
+		return true
 	}
-	return false
+	return bh.disk != nil && bh.disk.fileExists(file, archive)
 }
 
 func (bh *BookHashes) ArchiveExists(archive string) bool {
 	bh.mx.RLock()
 	defer bh.mx.RUnlock()
-	_, ok := bh.Archives[archive]
-	return ok
+	if _, ok := bh.Archives[archive]; ok {
+		return true
+	}
+	return bh.disk != nil && bh.disk.archiveExists(archive)
 }
 
 func (bh *BookHashes) GetState(b *model.Book, level string) BookState {
@@ -109,10 +252,15 @@ func (bh *BookHashes) GetState(b *model.Book, level string) BookState {
 		return BookState(b.Updated)
 	}
 	if level != "N" {
-		if _, ok := bh.CRC32[b.CRC32]; ok {
-			return DuplicateCRC32
+		if state, ok := bh.isDuplicate(b); ok {
+			return state
+		}
+		if bh.disk != nil {
+			if state, ok := bh.disk.isDuplicate(b); ok {
+				return state
+			}
 		}
-		bh.CRC32[b.CRC32] = 1
+		bh.addContent(b)
 	}
 	if level == "S" {
 		tpBytes := []byte(b.Title + b.Plot)
@@ -121,8 +269,38 @@ func (bh *BookHashes) GetState(b *model.Book, level string) BookState {
 			if _, ok := bh.TitlePlot[tpCRC32]; ok {
 				return DuplicateTitlePlot
 			}
+			if bh.disk != nil {
+				if bh.disk.titlePlotExists(b, tpCRC32) {
+					return DuplicateTitlePlot
+				}
+				bh.disk.titlePlot.add(crcKey(tpCRC32))
+			}
 			bh.TitlePlot[tpCRC32] = 1
 		}
 	}
 	return Unique
 }
+
+// Remove forgets the book file and, for indexed books, its content hashes so the file can be indexed again,
+// in disk mode the book has to be deleted from database before
+func (bh *BookHashes) Remove(b *model.Book) {
+	bh.mx.Lock()
+	defer bh.mx.Unlock()
+	if b.Archive == "" {
+		delete(bh.Files, b.File)
+	} else if files, ok := bh.Archives[b.Archive]; ok {
+		delete(files, b.File)
+		if len(files) == 0 {
+			delete(bh.Archives, b.Archive)
+		}
+	}
+	if b.Updated < 0 { // duplicates share hashes with the indexed book
+		return
+	}
+	delete(bh.CRC32, b.CRC32)
+	delete(bh.SHA256, b.SHA256)
+	tpBytes := []byte(b.Title + b.Plot)
+	if len(tpBytes) >= MIN_TITLEPLOT_LEN {
+		delete(bh.TitlePlot, crc32.ChecksumIEEE(tpBytes))
+	}
+}
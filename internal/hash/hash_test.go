@@ -0,0 +1,152 @@
+package hash
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/vinser/flibgolite/internal/core/model"
+	_ "modernc.org/sqlite"
+)
+
+var plot = strings.Repeat("Long annotation of the book. ", 5)
+
+// testDB returns database with the books and ingest statuses of libraries 1 and 2 used by book hashes
+func testDB(t *testing.T) *sqlx.DB {
+	db, err := sqlx.Open("sqlite", filepath.Join(t.TempDir(), "books.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	for _, q := range []string{
+		`CREATE TABLE books (id INTEGER PRIMARY KEY, file TEXT, archive TEXT, crc32 INTEGER, sha256 TEXT, title TEXT, plot TEXT, library_id INTEGER)`,
+		`CREATE TABLE ingest_status (id INTEGER PRIMARY KEY, file TEXT, archive TEXT, library_id INTEGER)`,
+		`INSERT INTO books (file, archive, crc32, sha256, title, plot, library_id) VALUES
+			('a.fb2', '', 111, 'sha-a', 'A', '', 1),
+			('b.fb2', 'x.zip', 222, NULL, 'B', '', 1),
+			('c.fb2', 'x.zip', 333, 'sha-c', 'C', '` + plot + `', 1),
+			('other.fb2', '', 444, 'sha-other', 'Other', '', 2)`,
+		`INSERT INTO ingest_status (file, archive, library_id) VALUES ('r.fb2', 'y.zip', 1), ('', 'bad.zip', 1)`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestBookHashes(t *testing.T) {
+	var testFiles = []struct {
+		file, archive string
+		exists        bool
+	}{
+		{"a.fb2", "", true},
+		{"b.fb2", "x.zip", true},
+		{"r.fb2", "y.zip", true},
+		{"b.fb2", "", false},
+		{"other.fb2", "", false}, // other library
+		{"new.fb2", "", false},
+	}
+	var testArchives = []struct {
+		archive string
+		exists  bool
+	}{
+		{"x.zip", true},
+		{"y.zip", true},
+		{"bad.zip", true},
+		{"z.zip", false},
+	}
+	var testBooks = []struct {
+		name  string
+		book  model.Book
+		level string
+		state BookState
+	}{
+		{"same SHA-256", model.Book{CRC32: 999, SHA256: "sha-a"}, "F", DuplicateSHA256},
+		{"CRC32 of book without SHA-256", model.Book{CRC32: 222, SHA256: "sha-new"}, "F", DuplicateCRC32},
+		{"CRC32 of book with other SHA-256", model.Book{CRC32: 111, SHA256: "sha-collision"}, "F", Unique},
+		{"CRC32 of book with SHA-256", model.Book{CRC32: 333}, "F", DuplicateCRC32},
+		{"content of other library", model.Book{CRC32: 444, SHA256: "sha-other"}, "F", Unique},
+		{"added before", model.Book{CRC32: 555, SHA256: "sha-other"}, "F", DuplicateSHA256},
+		{"no check", model.Book{CRC32: 111, SHA256: "sha-a"}, "N", Unique},
+		{"same title and plot", model.Book{CRC32: 666, SHA256: "sha-copy", Title: "C", Plot: plot}, "S", DuplicateTitlePlot},
+		{"other title", model.Book{CRC32: 777, SHA256: "sha-d", Title: "D", Plot: plot}, "S", Unique},
+		{"rejected", model.Book{CRC32: 888, Updated: int64(FileHasErrors)}, "F", FileHasErrors},
+	}
+
+	for _, mode := range []string{MemoryMode, DiskMode} {
+		db := testDB(t)
+		bh := InitHashes(db, 1, mode)
+		for _, f := range testFiles {
+			if exists := bh.FileExists(f.file, f.archive); exists != f.exists {
+				t.Errorf("%s %s %s: expecting file exists %v, got: %v", mode, f.archive, f.file, f.exists, exists)
+			}
+		}
+		for _, a := range testArchives {
+			if exists := bh.ArchiveExists(a.archive); exists != a.exists {
+				t.Errorf("%s %s: expecting archive exists %v, got: %v", mode, a.archive, a.exists, exists)
+			}
+		}
+		for _, b := range testBooks {
+			if state := bh.GetState(&b.book, b.level); state != b.state {
+				t.Errorf("%s %s: expecting state %s, got: %s", mode, b.name, b.state, state)
+			}
+		}
+
+		// added file is known until commit, then it is looked up in database in disk mode
+		bh.Add("new.fb2", "z.zip")
+		if !bh.FileExists("new.fb2", "z.zip") || !bh.ArchiveExists("z.zip") {
+			t.Errorf("%s: expecting added file exists", mode)
+		}
+		if _, err := db.Exec(`INSERT INTO books (file, archive, crc32, title, plot, library_id) VALUES ('new.fb2', 'z.zip', 1000, 'New', '', 1)`); err != nil {
+			t.Fatal(err)
+		}
+		bh.Commit()
+		if !bh.FileExists("new.fb2", "z.zip") || !bh.ArchiveExists("z.zip") {
+			t.Errorf("%s: expecting committed file exists", mode)
+		}
+
+		// removed book is forgotten in memory mode, in disk mode it has to be deleted from database too
+		removed := &model.Book{File: "b.fb2", Archive: "x.zip", CRC32: 222}
+		if _, err := db.Exec(`DELETE FROM books WHERE file='b.fb2'`); err != nil {
+			t.Fatal(err)
+		}
+		bh.Remove(removed)
+		if bh.FileExists("b.fb2", "x.zip") {
+			t.Errorf("%s: expecting removed file does not exist", mode)
+		}
+		if state := bh.GetState(&model.Book{CRC32: 222}, "F"); state != Unique {
+			t.Errorf("%s: expecting removed book content unique, got: %s", mode, state)
+		}
+
+		// reloaded hashes see the books committed to database only
+		bh.Replace(InitHashes(db, 1, mode))
+		if !bh.FileExists("new.fb2", "z.zip") || bh.FileExists("b.fb2", "x.zip") {
+			t.Errorf("%s: expecting reloaded hashes of database books", mode)
+		}
+	}
+}
+
+func TestBloom(t *testing.T) {
+	const n = 50000
+	f := newBloom(n)
+	for i := 0; i < n; i++ {
+		f.add("added-" + strconv.Itoa(i))
+	}
+	for i := 0; i < n; i++ {
+		if !f.test("added-" + strconv.Itoa(i)) {
+			t.Fatalf("Expecting added key %d found", i)
+		}
+	}
+	positives := 0
+	for i := 0; i < n; i++ {
+		if f.test("other-" + strconv.Itoa(i)) {
+			positives++
+		}
+	}
+	if rate := float64(positives) / n; rate > 0.001 {
+		t.Errorf("Expecting false positive rate 0.1%% at most, got: %.4f", rate)
+	}
+}
@@ -0,0 +1,49 @@
+package hash
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/crc32"
+	"io"
+	"os"
+
+	stdhash "hash"
+)
+
+// Reader computes CRC32 and SHA-256 of the content read through it, so book files are hashed while parsed
+type Reader struct {
+	r   io.Reader
+	crc stdhash.Hash32
+	sha stdhash.Hash
+}
+
+func NewReader(r io.Reader) *Reader {
+	hr := &Reader{
+		crc: crc32.NewIEEE(),
+		sha: sha256.New(),
+	}
+	hr.r = io.TeeReader(r, io.MultiWriter(hr.crc, hr.sha))
+	return hr
+}
+
+func (hr *Reader) Read(p []byte) (int, error) {
+	return hr.r.Read(p)
+}
+
+// Sums reads the rest of content the parser has not read and returns its CRC32 and hex encoded SHA-256
+func (hr *Reader) Sums() (uint32, string, error) {
+	if _, err := io.Copy(io.Discard, hr.r); err != nil {
+		return 0, "", err
+	}
+	return hr.crc.Sum32(), hex.EncodeToString(hr.sha.Sum(nil)), nil
+}
+
+// FileSums streams the file and returns its CRC32 and hex encoded SHA-256
+func FileSums(filePath string) (uint32, string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	return NewReader(f).Sums()
+}
@@ -0,0 +1,175 @@
+package hash
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/vinser/flibgolite/internal/core/model"
+)
+
+// MIN_VERSION_PLOT_LEN is the minimal length of normalized annotations compared to tell book versions
+const MIN_VERSION_PLOT_LEN = 64
+
+// AuthorKey returns the key of book authors and language, only books with equal keys can be versions of one book
+func AuthorKey(b *model.Book) string {
+	names := []string{}
+	for _, a := range b.Authors {
+		last, _, _ := strings.Cut(a.Sort, ",")
+		if last = Normalize(last); last != "" {
+			names = append(names, last)
+		}
+	}
+	slices.Sort(names)
+	lang := ""
+	if b.Language != nil {
+		lang = b.Language.Code
+	}
+	return lang + "|" + strings.Join(slices.Compact(names), "|")
+}
+
+// Normalize lowercases s and keeps only words of letters and digits,
+// bracketed parts like "(сборник)" or "[litres]" are dropped
+func Normalize(s string) string {
+	var sb strings.Builder
+	depth := 0
+	space := false
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case r == '(' || r == '[' || r == '{':
+			depth++
+		case r == ')' || r == ']' || r == '}':
+			depth = max(depth-1, 0)
+		case depth > 0:
+		case r == 'ё':
+			sb.WriteRune('е')
+			space = false
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if space && sb.Len() > 0 {
+				sb.WriteRune(' ')
+			}
+			sb.WriteRune(r)
+			space = false
+		default:
+			space = true
+		}
+	}
+	return sb.String()
+}
+
+// Similarity returns Dice coefficient of a and b character trigrams from 0 to 1
+func Similarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+	common := 0
+	for t, na := range ta {
+		common += min(na, tb[t])
+	}
+	total := 0
+	for _, n := range ta {
+		total += n
+	}
+	for _, n := range tb {
+		total += n
+	}
+	return 2 * float64(common) / float64(total)
+}
+
+func trigrams(s string) map[string]int {
+	r := []rune("  " + s + " ")
+	t := make(map[string]int, len(r))
+	for i := 0; i+3 <= len(r); i++ {
+		t[string(r[i:i+3])]++
+	}
+	return t
+}
+
+// VersionScore returns similarity of normalized titles and annotations of two books with the same author key
+// Titles with different numbers like volumes of series never match
+func VersionScore(titleA, plotA, titleB, plotB string) float64 {
+	if !slices.Equal(numbers(titleA), numbers(titleB)) {
+		return 0
+	}
+	score := Similarity(titleA, titleB)
+	if len(plotA) >= MIN_VERSION_PLOT_LEN && len(plotB) >= MIN_VERSION_PLOT_LEN {
+		score = 0.7*score + 0.3*Similarity(plotA, plotB)
+	}
+	return score
+}
+
+// VersionTitleLens returns the range of normalized title lengths in runes of the books that can have
+// VersionScore with the title not less than similarity, titles of other lengths have too few common trigrams
+func VersionTitleLens(title string, similarity float64) (int, int) {
+	t := (similarity - 0.3) / 0.7 // the least title similarity when annotations are similar too
+	if t <= 0 {
+		return 0, math.MaxInt32
+	}
+	n := float64(utf8.RuneCountInString(title) + 1) // number of title trigrams
+	return max(int(math.Ceil(n*t/(2-t)-1e-9))-1, 0), int(math.Floor(n*(2-t)/t+1e-9)) - 1
+}
+
+func numbers(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsDigit(r) })
+}
+
+// VersionPolicy picks the canonical version of a book to show in feeds
+type VersionPolicy struct {
+	Criteria []string // cover, format, largest, newest
+	Formats  []string // preferred formats, the first is the best
+}
+
+// NewVersionPolicy makes policy from comma separated criteria and formats lists
+func NewVersionPolicy(criteria, formats string) *VersionPolicy {
+	split := func(s string) []string {
+		list := []string{}
+		for _, item := range strings.Split(strings.ToLower(s), ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list
+	}
+	return &VersionPolicy{
+		Criteria: split(criteria),
+		Formats:  split(formats),
+	}
+}
+
+// Better reports whether version a is preferred to version b
+func (p *VersionPolicy) Better(a, b *model.Book) bool {
+	for _, c := range p.Criteria {
+		switch c {
+		case "cover":
+			if (a.Cover != "") != (b.Cover != "") {
+				return a.Cover != ""
+			}
+		case "format":
+			if fa, fb := p.formatRank(a.Format), p.formatRank(b.Format); fa != fb {
+				return fa < fb
+			}
+		case "largest":
+			if a.Size != b.Size {
+				return a.Size > b.Size
+			}
+		case "newest":
+			if a.Updated != b.Updated {
+				return a.Updated > b.Updated
+			}
+		}
+	}
+	return a.ID < b.ID
+}
+
+func (p *VersionPolicy) formatRank(format string) int {
+	if i := slices.Index(p.Formats, format); i >= 0 {
+		return i
+	}
+	return len(p.Formats)
+}
@@ -0,0 +1,64 @@
+package hash
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestVersionScore(t *testing.T) {
+	plot := Normalize("Молодой офицер Андрей Болконский уходит на войну с Наполеоном, оставив беременную жену в имении отца")
+	var testTitles = []struct {
+		a, b     string
+		plotA    string
+		plotB    string
+		versions bool
+	}{
+		{"Война и мир", "Война и мир", "", "", true},
+		{"Война и мир (сборник)", "Война и мир [litres]", "", "", true},
+		{"Война и мир. Том 1", "Война и мир. Том 2", "", "", false},
+		{"Война и мир", "Война и мир. Книга первая", "", "", false},
+		{"Война и мир", "Война и миръ", plot, plot, true},
+		{"Анна Каренина", "Война и мир", plot, plot, false},
+	}
+
+	for _, tt := range testTitles {
+		a, b := Normalize(tt.a), Normalize(tt.b)
+		score := VersionScore(a, tt.plotA, b, tt.plotB)
+		if (score >= 0.85) != tt.versions {
+			t.Errorf("%s and %s: expecting versions %v, got score: %.2f", tt.a, tt.b, tt.versions, score)
+		}
+	}
+}
+
+func TestVersionTitleLens(t *testing.T) {
+	plot := Normalize("Молодой офицер Андрей Болконский уходит на войну с Наполеоном, оставив беременную жену в имении отца")
+	titles := []string{"", "я", "мир", "война и мир", "война и миръ", "война и мир книга", "анна каренина", "воскресение",
+		"the lord of the rings", "lord of the rings", "rings", "the fellowship of the ring", "fellowship of the ring"}
+	for _, similarity := range []float64{0.5, 0.7, 0.85, 0.95} {
+		for _, a := range titles {
+			lo, hi := VersionTitleLens(a, similarity)
+			for _, b := range titles {
+				n := utf8.RuneCountInString(b)
+				if score := VersionScore(a, plot, b, plot); score >= similarity && (n < lo || n > hi) {
+					t.Errorf("%q and %q: expecting length %d in range %d-%d for score %.2f", a, b, n, lo, hi, score)
+				}
+			}
+		}
+	}
+
+	var testLens = []struct {
+		title      string
+		similarity float64
+		lo, hi     int
+	}{
+		{"война и мир", 0.85, 7, 17},
+		{"война и мир", 1, 11, 11},
+		{"война и мир", 0.3, 0, 1<<31 - 1},
+	}
+
+	for _, l := range testLens {
+		if lo, hi := VersionTitleLens(l.title, l.similarity); lo != l.lo || hi != l.hi {
+			t.Errorf("%q %.2f: expecting range %d-%d, got: %d-%d", l.title, l.similarity, l.lo, l.hi, lo, hi)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package index
+
+import (
+	"fmt"
+)
+
+// MergeAuthors moves the books of the author to the canonical author and keeps the author name as an alias,
+// so books of the author indexed later get the canonical author. Authors are given by id, exact name or alias
+func (h *Handler) MergeAuthors(author, canonical string) (int64, error) {
+	from, to := h.DB.FindAuthorID(author), h.DB.FindAuthorID(canonical)
+	switch {
+	case from == 0:
+		return 0, fmt.Errorf("author %q not found", author)
+	case to == 0:
+		return 0, fmt.Errorf("author %q not found", canonical)
+	}
+	moved, err := h.DB.MergeAuthors(from, to)
+	if err != nil {
+		return 0, err
+	}
+	h.LOG.S.Printf("author %q (%d) was merged into %q (%d), %d books were moved\n", author, from, canonical, to, moved)
+	return moved, nil
+}
@@ -0,0 +1,192 @@
+package index
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/vinser/flibgolite/internal/core/model"
+	"github.com/vinser/flibgolite/internal/hash"
+	"github.com/vinser/flibgolite/internal/parsers"
+	"github.com/vinser/flibgolite/internal/parsers/sidecar"
+)
+
+// BackfillSHA256 computes SHA-256 of books indexed before it was stored, each archive is opened once
+// Book hashes are reloaded afterwards so duplicates are checked by SHA-256
+func (h *Handler) BackfillSHA256() {
+	books, err := h.DB.BooksWithoutSHA256()
+	if err != nil {
+		h.LOG.E.Printf("SHA-256 backfill failed: %v\n", err)
+		return
+	}
+	if len(books) == 0 {
+		return
+	}
+	start := time.Now()
+	h.LOG.S.Printf("SHA-256 backfill of %d books started\n", len(books))
+
+	stock := &stockFiles{dir: h.CFG.Library.STOCK_DIR}
+	defer stock.close()
+	done := []*model.Book{}
+	updated := 0
+	flush := func() {
+		if err := h.DB.UpdateBooksSHA256(done); err != nil {
+			h.LOG.E.Printf("SHA-256 backfill failed: %v\n", err)
+			return
+		}
+		updated += len(done)
+		done = done[:0]
+	}
+	for _, b := range books {
+		rc, err := stock.open(b)
+		if err != nil {
+			h.LOG.W.Println(err)
+			continue
+		}
+		_, b.SHA256, err = hash.NewReader(rc).Sums()
+		rc.Close()
+		if err != nil {
+			h.LOG.W.Println(err)
+			continue
+		}
+		done = append(done, b)
+		if len(done) >= h.CFG.Database.MAX_BOOKS_IN_TX {
+			flush()
+		}
+	}
+	flush()
+	h.reloadHashes()
+	h.LOG.S.Printf("SHA-256 backfill: %d of %d books updated, %v elapsed\n", updated, len(books), time.Since(start))
+}
+
+// LoadLazyBooks loads covers, annotations and publication details of the books imported from INPX catalog
+// from their files in background, each archive is opened once.
+// Books of formats that are not parsed and broken files are left as they were imported
+func (h *Handler) LoadLazyBooks() {
+	books, err := h.DB.LazyBooks()
+	if err != nil {
+		h.LOG.E.Printf("INPX books loading failed: %v\n", err)
+		return
+	}
+	if len(books) == 0 {
+		return
+	}
+	start := time.Now()
+	h.LOG.S.Printf("INPX books loading of %d books started\n", len(books))
+
+	stock := &stockFiles{dir: h.CFG.Library.STOCK_DIR}
+	defer stock.close()
+	done := []*model.Book{}
+	loaded := 0
+	flush := func() {
+		if err := h.DB.UpdateLazyBooks(done); err != nil {
+			h.LOG.E.Printf("INPX books loading failed: %v\n", err)
+			return
+		}
+		loaded += len(done)
+		done = done[:0]
+	}
+	for _, b := range books {
+		if !isArchiveEntryFormat(filepath.Ext(b.File)) {
+			continue
+		}
+		if err := h.loadLazyBook(stock, b); err != nil {
+			h.LOG.D.Printf("book %d info loading failed: %v\n", b.ID, err)
+			continue
+		}
+		done = append(done, b)
+		if len(done) >= h.CFG.Database.MAX_BOOKS_IN_TX {
+			flush()
+		}
+	}
+	flush()
+	h.LOG.S.Printf("INPX books loading: %d of %d books loaded, %v elapsed\n", loaded, len(books), time.Since(start))
+}
+
+// loadLazyBook parses the book file and fills in the book details
+func (h *Handler) loadLazyBook(stock *stockFiles, b *model.Book) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("parser failed: %v", r)
+		}
+	}()
+	rc, err := stock.open(b)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	p, err := parseBookFile(b.File, rc)
+	if err != nil {
+		return err
+	}
+	b.Cover, b.Plot, b.Pages = p.GetCover(), p.GetPlot(), parsers.Pages(p)
+	b.ISBN, b.Publisher, b.City = p.GetISBN(), p.GetPublisher(), p.GetCity()
+	b.SrcLang, b.SrcTitle = p.GetSrcLanguage(), p.GetSrcTitle()
+	return nil
+}
+
+// stockFiles opens the stock book files keeping the last archive open, so books ordered by archive open it once
+type stockFiles struct {
+	dir     string
+	zr      *zip.ReadCloser
+	current string
+	entries map[string]*zip.File
+	err     error // current archive open error
+}
+
+func (s *stockFiles) open(b *model.Book) (io.ReadCloser, error) {
+	if b.Archive == "" {
+		return os.Open(parsers.StockPath(s.dir, b.File))
+	}
+	if b.Archive != s.current {
+		s.close()
+		s.current, s.entries = b.Archive, map[string]*zip.File{}
+		s.zr, s.err = zip.OpenReader(parsers.StockPath(s.dir, b.Archive))
+		if s.err == nil {
+			for _, f := range s.zr.File {
+				s.entries[filepath.Base(f.Name)] = f
+			}
+		}
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	f, ok := s.entries[b.File]
+	if !ok {
+		return nil, fmt.Errorf("file %s not found in archive %s", b.File, b.Archive)
+	}
+	return f.Open()
+}
+
+// sidecar returns the metadata of the first sidecar file found next to the book file, nil if there is none or it is broken
+func (s *stockFiles) sidecar(b *model.Book) *sidecar.Metadata {
+	if b.Archive == "" {
+		m, _ := sidecar.Find(parsers.StockPath(s.dir, b.File))
+		return m
+	}
+	if s.err != nil || b.Archive != s.current {
+		return nil
+	}
+	for _, name := range sidecar.Names(b.File) {
+		if f, ok := s.entries[name]; ok {
+			rc, err := f.Open()
+			if err != nil {
+				return nil
+			}
+			defer rc.Close()
+			m, _ := sidecar.Parse(name, rc)
+			return m
+		}
+	}
+	return nil
+}
+
+func (s *stockFiles) close() {
+	if s.zr != nil {
+		s.zr.Close()
+		s.zr = nil
+	}
+}
@@ -1,44 +1,140 @@
 package index
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/vinser/flibgolite/internal/core/model"
 	"github.com/vinser/flibgolite/internal/hash"
+	"github.com/vinser/flibgolite/internal/langid"
 	"github.com/vinser/flibgolite/internal/parsers"
+	"github.com/vinser/flibgolite/internal/parsers/sidecar"
 )
 
 // createBookFromParser creates a model.Book from parser data
-func (h *Handler) createBookFromParser(p parsers.Parser, file string, archive string, size int64, crc32 uint32) *model.Book {
+func (h *Handler) createBookFromParser(p parsers.Parser, file string, archive string, size int64, crc32 uint32, sha256 string) *model.Book {
 	return &model.Book{
-		File:     file,
-		CRC32:    crc32,
-		Archive:  archive,
-		Size:     size,
-		Format:   p.GetFormat(),
-		Title:    p.GetTitle(),
-		Sort:     p.GetSort(),
-		Year:     p.GetYear(),
-		Plot:     p.GetPlot(),
-		Cover:    p.GetCover(),
-		Language: p.GetLanguage(),
-		Authors:  p.GetAuthors(),
-		Genres:   p.GetGenres(),
-		Keywords: p.GetKeywords(),
-		Serie:    p.GetSerie(),
-		SerieNum: p.GetSerieNumber(),
-		Updated:  time.Now().UnixNano(),
-	}
-}
-
-// processLanguage checks if the book language is accepted and returns error if not
-func (h *Handler) processLanguage(p parsers.Parser, file, archive string) error {
+		File:         file,
+		CRC32:        crc32,
+		SHA256:       sha256,
+		Archive:      archive,
+		Size:         size,
+		Format:       p.GetFormat(),
+		Title:        p.GetTitle(),
+		Sort:         p.GetSort(),
+		Year:         p.GetYear(),
+		Plot:         p.GetPlot(),
+		Cover:        p.GetCover(),
+		Language:     p.GetLanguage(),
+		Authors:      p.GetAuthors(),
+		Contributors: parsers.Contributors(p),
+		Genres:       p.GetGenres(),
+		Keywords:     p.GetKeywords(),
+		Serie:        p.GetSerie(),
+		SerieNum:     p.GetSerieNumber(),
+		Series:       parsers.Series(p),
+		ISBN:         p.GetISBN(),
+		Publisher:    p.GetPublisher(),
+		City:         p.GetCity(),
+		SrcLang:      p.GetSrcLanguage(),
+		SrcTitle:     p.GetSrcTitle(),
+		Pages:        parsers.Pages(p),
+		Updated:      time.Now().UnixNano(),
+	}
+}
+
+// applyRules normalizes the book metadata with the rules, the book rejected by a rule is recorded with its state
+func (h *Handler) applyRules(b *model.Book) error {
+	changes, rejectedBy := h.Rules.Apply(b)
+	for _, c := range changes {
+		h.LOG.D.Printf("rule %q changed %s of %s from %q to %q\n", c.Rule, c.Field, b.File, c.Old, c.New)
+	}
+	if rejectedBy != "" {
+		err := fmt.Errorf("file %s was rejected by rule %q", b.File, rejectedBy)
+		h.addFileToBookQueue(b.File, b.Archive, hash.RejectedByRule, err)
+		return err
+	}
+	return nil
+}
+
+// applySidecar overrides the metadata of single book file with its sidecar file if there is one
+func (h *Handler) applySidecar(p parsers.Parser, bookPath, file string) parsers.Parser {
+	m, err := sidecar.Find(bookPath)
+	if err != nil {
+		h.LOG.W.Printf("sidecar of %s was not read: %v\n", file, err)
+		return p
+	}
+	if m == nil {
+		return p
+	}
+	h.LOG.I.Printf("metadata of %s were overridden by sidecar\n", file)
+	return sidecar.Override(p, m)
+}
+
+// processLanguage detects the book language if needed, checks if it is accepted and returns error if not
+func (h *Handler) processLanguage(p parsers.Parser, file, archive string) (parsers.Parser, error) {
+	p = h.detectLanguage(p, file, archive)
 	language := p.GetLanguage()
 	if !h.acceptLanguage(language.Code) {
-		h.addFileToBookQueue(file, archive, hash.LanguageNotAccepted)
-		return &LanguageNotAcceptedError{Language: language.Code, File: file}
+		err := &LanguageNotAcceptedError{Language: language.Code, File: file}
+		h.addFileToBookQueue(file, archive, hash.LanguageNotAccepted, err)
+		return p, err
 	}
-	return nil
+	return p, nil
+}
+
+// detectLanguage identifies the language of the book title, annotation and text beginning.
+// Detected language replaces missing declared language or the declared one that the detector could recognize but did not
+func (h *Handler) detectLanguage(p parsers.Parser, file, archive string) parsers.Parser {
+	minConfidence := h.CFG.Database.LANGUAGE_CONFIDENCE
+	if minConfidence <= 0 {
+		return p
+	}
+	if sc, ok := p.(*sidecar.Book); ok && sc.Metadata.Language != "" { // language set by sidecar is trusted
+		return p
+	}
+	text := p.GetTitle() + "\n" + p.GetPlot()
+	if ts, ok := p.(parsers.TextSampler); ok {
+		text += "\n" + ts.GetTextSample()
+	}
+	code, confidence := langid.Detect(text)
+	declared := p.GetLanguage().Code
+	if code == "" || code == declared || confidence < minConfidence {
+		return p
+	}
+	if !langid.Supported(declared) { // missing declared language is reported as "en"
+		return p
+	}
+	h.LOG.I.Printf("language of %s was detected as %s instead of \"%s\" with confidence %.2f\n", file, code, declared, confidence)
+	lang := parsers.GetLanguage(code)
+	lang.Confidence = confidence
+	return &detectedLanguage{Parser: p, language: lang}
+}
+
+// detectedLanguage overrides the language declared in the book
+type detectedLanguage struct {
+	parsers.Parser
+	language *model.Language
+}
+
+func (d *detectedLanguage) GetLanguage() *model.Language {
+	return d.language
+}
+
+func (d *detectedLanguage) GetSort() string {
+	return parsers.GetSortTitle(d.GetTitle(), parsers.GetLanguageTag(d.language.Code))
+}
+
+func (d *detectedLanguage) GetSeries() []*model.BookSerie {
+	return parsers.Series(d.Parser)
+}
+
+func (d *detectedLanguage) GetContributors() []*model.Contributor {
+	return parsers.Contributors(d.Parser)
+}
+
+func (d *detectedLanguage) GetPages() int {
+	return parsers.Pages(d.Parser)
 }
 
 // LanguageNotAcceptedError represents an error when book language is not accepted
@@ -0,0 +1,69 @@
+package index
+
+import (
+	"time"
+
+	"github.com/vinser/flibgolite/internal/core/model"
+	"github.com/vinser/flibgolite/internal/covers"
+)
+
+// coverCache returns the cover cache of the index, nil if covers are not cached
+func (h *Handler) coverCache() *covers.Cache {
+	if h.Covers == nil {
+		return nil
+	}
+	return h.Covers.ForIndex(h.DB.CoversID())
+}
+
+// CacheCovers extracts covers of the books from the cover queue to the cover cache
+func (h *Handler) CacheCovers() {
+	for {
+		select {
+		case c := <-h.CoverQueue:
+			h.fillCover(c)
+			h.coversPending.Add(-1)
+		case <-time.After(time.Second):
+			h.LOG.D.Printf("Cover queue timeout")
+		case <-h.StopWorkers:
+			return
+		}
+	}
+}
+
+// fillCover caches the cover, decoder failure on malformed book does not stop caching
+func (h *Handler) fillCover(c Cover) {
+	defer func() {
+		if r := recover(); r != nil {
+			h.LOG.E.Printf("cover of book %d: %v\n", c.Book.ID, r)
+		}
+	}()
+	if err := c.Cache.Fill(h.CFG.Library.STOCK_DIR, &c.Book); err != nil {
+		h.LOG.D.Println(err) // the cover will be extracted on request
+	}
+}
+
+// queueCovers puts the added books with covers to the cover queue, books are skipped when the queue is full.
+// Covers are cached for the index the books were committed to, even if it is replaced before they are extracted
+func (h *Handler) queueCovers(books []model.Book) {
+	if len(books) == 0 {
+		return
+	}
+	cache := h.coverCache()
+	for _, book := range books {
+		select {
+		case h.CoverQueue <- Cover{Book: book, Cache: cache}:
+		default:
+			h.coversPending.Add(-1)
+		}
+	}
+}
+
+// addCover reserves the place in the cover queue for the book being added to index,
+// it is queued when the book transaction is committed
+func (h *Handler) addCover(pending []model.Book, book *model.Book) []model.Book {
+	if h.Covers == nil || h.CoverQueue == nil || book.Cover == "" {
+		return pending
+	}
+	h.coversPending.Add(1)
+	return append(pending, *book)
+}
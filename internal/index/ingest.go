@@ -0,0 +1,127 @@
+package index
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vinser/flibgolite/internal/core/model"
+	"github.com/vinser/flibgolite/internal/hash"
+	"github.com/vinser/flibgolite/internal/parsers/sidecar"
+)
+
+// IngestReport writes the numbers of rejected files by state and the list of files with the state name,
+// "all" lists files of all states
+func (h *Handler) IngestReport(w io.Writer, stateName string) error {
+	state, err := hash.ParseState(stateName)
+	if err != nil {
+		return fmt.Errorf("%s, use one of: all %v", err, hash.StateNames())
+	}
+	counts, err := h.DB.IngestStateCounts()
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, name := range hash.StateNames() {
+		s, _ := hash.ParseState(name)
+		fmt.Fprintf(tw, "%s\t%d\n", name, counts[s])
+	}
+	fmt.Fprintln(tw)
+	statuses, err := h.DB.IngestStatuses(state, -1, 0)
+	if err != nil {
+		return err
+	}
+	for _, s := range statuses {
+		updated := "-"
+		if s.Updated > 0 {
+			updated = time.Unix(0, s.Updated).Format(time.DateTime)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", updated, hash.BookState(s.State), s.Archive, s.File, s.Error)
+	}
+	return tw.Flush()
+}
+
+// Requeue removes ingest statuses of rejected files with the state name so the files are processed again.
+// The build id is changed to make running server reload book hashes and rescan the stock.
+func (h *Handler) Requeue(stateName string) (int64, error) {
+	state, err := hash.ParseState(stateName)
+	if err != nil {
+		return 0, fmt.Errorf("%s, use one of: all %v", err, hash.StateNames())
+	}
+	n, err := h.DB.RequeueIngestStatuses(state)
+	if err != nil || n == 0 {
+		return n, err
+	}
+	return n, h.DB.SetBuildID()
+}
+
+// RulesReport writes for each metadata normalization rule the indexed books it would change and the changes.
+// Book files are parsed again, so the rules see the metadata as they are in the files before the rules and
+// the genres tree change them, books that can not be parsed are matched as they are indexed
+func (h *Handler) RulesReport(w io.Writer) error {
+	if h.Rules.Len() == 0 {
+		_, err := fmt.Fprintf(w, "no rules in %s\n", h.CFG.Rules.FILE)
+		return err
+	}
+	stock := &stockFiles{dir: h.CFG.Library.STOCK_DIR}
+	defer stock.close()
+	changed := make(map[string][]string) // book changes by rule
+	err := h.DB.IndexedBooks(func(b *model.Book) error {
+		if parsed, err := h.parseStockBook(stock, b); err == nil {
+			b = parsed
+		} else {
+			h.LOG.D.Printf("file %s from %s is matched as indexed: %v\n", b.File, b.Archive, err)
+		}
+		changes, _ := h.Rules.Apply(b)
+		for _, c := range changes {
+			line := fmt.Sprintf("%s\t%s\t%s\t%s\t%q -> %q", b.Archive, b.File, b.Title, c.Field, c.Old, c.New)
+			if c.Field == "reject" {
+				line = fmt.Sprintf("%s\t%s\t%s\t%s", b.Archive, b.File, b.Title, "rejected")
+			}
+			changed[c.Rule] = append(changed[c.Rule], line)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, r := range h.Rules.Rules {
+		fmt.Fprintf(tw, "%s - changes: %d\n", r.Name, len(changed[r.Name]))
+		for _, line := range changed[r.Name] {
+			fmt.Fprintf(tw, "  %s\n", line)
+		}
+	}
+	return tw.Flush()
+}
+
+// parseStockBook parses the stock book file with its sidecar as it is parsed when indexed,
+// the book metadata are not changed by the rules and the genres tree
+func (h *Handler) parseStockBook(stock *stockFiles, b *model.Book) (book *model.Book, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("parser failed: %v", r)
+		}
+	}()
+	if !isArchiveEntryFormat(filepath.Ext(b.File)) {
+		return nil, fmt.Errorf("unsupported format \"%s\"", filepath.Ext(b.File))
+	}
+	rc, err := stock.open(b)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	p, err := parseBookFile(b.File, rc)
+	if err != nil {
+		return nil, err
+	}
+	if m := stock.sidecar(b); m != nil {
+		p = sidecar.Override(p, m)
+	}
+	p = h.detectLanguage(p, b.File, b.Archive)
+	book = h.createBookFromParser(p, b.File, b.Archive, b.Size, b.CRC32, b.SHA256)
+	book.ID, book.Updated = b.ID, b.Updated
+	return book, nil
+}
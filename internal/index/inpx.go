@@ -0,0 +1,211 @@
+package index
+
+import (
+	"archive/zip"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vinser/flibgolite/internal/core/model"
+	"github.com/vinser/flibgolite/internal/hash"
+	"github.com/vinser/flibgolite/internal/parsers"
+	"github.com/vinser/flibgolite/internal/parsers/inpx"
+)
+
+// ImportINPX adds books described by INPX catalog records to index without parsing book files
+// Archives are looked for next to the INPX file, book covers and annotations are loaded in background, see LoadLazyBooks
+func (h *Handler) ImportINPX(inpxPath string) error {
+	start := time.Now()
+	cat, err := inpx.Open(inpxPath)
+	if err != nil {
+		return fmt.Errorf("incorrect INPX catalog %s: %s", inpxPath, err)
+	}
+	defer cat.Close()
+
+	dir := filepath.Dir(inpxPath)
+	entries := map[string]*zip.File{} // current archive entries
+	current := ""
+	missing := map[string]*missingArchive{}
+	added, skipped := 0, 0
+	tx := h.DB.TxBegin()
+	defer func() { tx.TxEnd() }()
+	bookInTX := 0
+	for _, inp := range cat.Inps {
+		h.LOG.I.Printf("inp: %s\n", inp.Name)
+		err := cat.ReadInp(inp, func(r *inpx.Record) error {
+			archive := relPath(h.CFG.Library.STOCK_DIR, filepath.Join(dir, filepath.FromSlash(r.Archive)))
+			if strings.HasPrefix(archive, "..") {
+				return fmt.Errorf("archive %s is out of the stock folder %s", r.Archive, h.CFG.Library.STOCK_DIR)
+			}
+			if m, ok := missing[archive]; ok {
+				m.records++
+				skipped++
+				return nil
+			}
+			if archive != current {
+				current, entries = archive, map[string]*zip.File{}
+				zr, err := zip.OpenReader(filepath.Join(dir, filepath.FromSlash(r.Archive)))
+				if err != nil {
+					missing[archive] = &missingArchive{err: err, records: 1}
+					skipped++
+					return nil
+				}
+				for _, f := range zr.File {
+					entries[filepath.Base(f.Name)] = f
+				}
+				zr.Close()
+			}
+			file := r.FileName()
+			f, ok := entries[file]
+			switch {
+			case r.Deleted || !ok:
+				h.LOG.D.Printf("file %s from %s is deleted or missing and has been skipped\n", file, archive)
+				skipped++
+				return nil
+			case h.Hashes.FileExists(file, archive):
+				h.LOG.D.Printf("file %s from %s is in stock already and has been skipped\n", file, archive)
+				skipped++
+				return nil
+			case !h.acceptLanguage(r.GetLanguage().Code):
+				h.LOG.D.Printf("file %s from %s has not accepted language \"%s\" and has been skipped\n", file, archive, r.Lang)
+				skipped++
+				return nil
+			}
+			book := h.createBookFromParser(r, file, archive, int64(f.UncompressedSize64), f.CRC32, "")
+			_, rejectedBy := h.Rules.Apply(book)
+			h.GT.Refine(book)
+			h.Hashes.Add(file, archive)
+			if rejectedBy != "" {
+				h.LOG.D.Printf("file %s from %s was rejected by rule %q and has been skipped\n", file, archive, rejectedBy)
+				skipped++
+				book.Error = fmt.Sprintf("file %s was rejected by rule %q", file, rejectedBy)
+				return tx.RecordBookState(book, hash.RejectedByRule)
+			}
+			if state := h.Hashes.GetState(book, h.CFG.Database.DEDUPLICATE_LEVEL); state != hash.Unique {
+				h.LOG.D.Printf("file %s from %s is a duplicate and has been skipped\n", file, archive)
+				skipped++
+				return tx.RecordBookState(book, state)
+			}
+			if err := tx.NewLazyBook(book); err != nil {
+				return err
+			}
+			if h.CFG.Database.DEDUPLICATE_LEVEL == "V" {
+				if err := h.addVersion(tx, book); err != nil {
+					return err
+				}
+			}
+			added++
+			bookInTX++
+			if bookInTX >= h.CFG.Database.MAX_BOOKS_IN_TX {
+				tx.TxEnd()
+				h.Hashes.Commit()
+				tx = h.DB.TxBegin()
+				bookInTX = 0
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %s", inp.Name, err)
+		}
+	}
+	archives := slices.Sorted(maps.Keys(missing))
+	for _, archive := range archives {
+		h.LOG.W.Printf("archive %s was not opened, its %d records have been skipped: %s\n", archive, missing[archive].records, missing[archive].err)
+	}
+	if len(archives) > 0 {
+		h.LOG.S.Printf("INPX import: %d books added, %d records skipped, %d archives missing: %s, %v elapsed\n", added, skipped, len(archives), strings.Join(archives, ", "), time.Since(start))
+	} else {
+		h.LOG.S.Printf("INPX import: %d books added, %d records skipped, %v elapsed\n", added, skipped, time.Since(start))
+	}
+	return nil
+}
+
+// missingArchive is the archive of INPX records that was not opened
+type missingArchive struct {
+	err     error
+	records int
+}
+
+// ExportINPX writes INPX catalog of books from stock archives with one .inp file per archive
+// Archive paths are stored relative to the catalog folder
+func (h *Handler) ExportINPX(inpxPath string) error {
+	start := time.Now()
+	f, err := os.Create(inpxPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w, err := inpx.NewWriter(f)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(inpxPath)
+	current := ""
+	books, archives := 0, 0
+	err = h.DB.ArchiveBooks(func(b *model.Book) error {
+		if b.Archive != current {
+			current = b.Archive
+			archives++
+			name := strings.ReplaceAll(strings.TrimSuffix(b.Archive, path.Ext(b.Archive)), "/", "_") + ".inp"
+			if err := w.StartInp(name); err != nil {
+				return err
+			}
+		}
+		books++
+		return w.WriteRecord(h.inpxRecord(dir, b))
+	})
+	if err != nil {
+		return err
+	}
+	collection := fmt.Sprintf("%s\r\nflibgolite\r\n65536\r\nFLibGoLite book stock\r\n", h.CFG.OPDS.TITLE)
+	if err := w.WriteInfo("collection.info", collection); err != nil {
+		return err
+	}
+	if err := w.WriteInfo("version.info", time.Now().Format("20060102")+"\r\n"); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	h.LOG.S.Printf("INPX export: %d books from %d archives, %v elapsed\n", books, archives, time.Since(start))
+	return nil
+}
+
+// inpxRecord makes INPX record of the book, dir is the catalog folder
+func (h *Handler) inpxRecord(dir string, b *model.Book) *inpx.Record {
+	folder, err := filepath.Rel(dir, parsers.StockPath(h.CFG.Library.STOCK_DIR, b.Archive))
+	if err != nil {
+		folder = b.Archive
+	}
+	ext := path.Ext(b.File)
+	r := &inpx.Record{
+		Genres:   b.Genres,
+		Title:    b.Title,
+		Series:   b.Serie.Name,
+		File:     strings.TrimSuffix(b.File, ext),
+		Size:     b.Size,
+		LibID:    strconv.FormatInt(b.ID, 10),
+		Ext:      strings.TrimPrefix(ext, "."),
+		Date:     time.Unix(0, b.Updated).Format("2006-01-02"),
+		Lang:     b.Language.Code,
+		Keywords: b.Keywords,
+		Archive:  filepath.ToSlash(folder),
+	}
+	if b.SerieNum > 0 {
+		r.SerNo = strconv.Itoa(b.SerieNum)
+	}
+	for _, a := range b.Authors {
+		if strings.HasPrefix(a.Name, "[") { // author not specified
+			continue
+		}
+		n := parsers.ParseFullName(a.Name)
+		r.Authors = append(r.Authors, []string{n.Last, n.First, n.Middle})
+	}
+	return r
+}
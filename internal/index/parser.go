@@ -2,140 +2,259 @@ package index
 
 import (
 	"archive/zip"
+	"errors"
 	"fmt"
-	"hash/crc32"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/vinser/flibgolite/internal/hash"
 	"github.com/vinser/flibgolite/internal/parsers"
+	"github.com/vinser/flibgolite/internal/parsers/cbz"
 	"github.com/vinser/flibgolite/internal/parsers/epub"
 	"github.com/vinser/flibgolite/internal/parsers/fb2"
+	"github.com/vinser/flibgolite/internal/parsers/mobi"
+	"github.com/vinser/flibgolite/internal/parsers/pdf"
+	"github.com/vinser/flibgolite/internal/parsers/sidecar"
 )
 
-// parseFB2 processes a single FB2 file and adds it to book stock index
-func (h *Handler) parseFB2(FB2Path string) error {
-	fInfo, _ := os.Stat(FB2Path)
-	file := fInfo.Name()
+// errBadArchive tells that zip based book file is not a zip archive
+var errBadArchive = errors.New("incorrect zip archive")
+
+// bookOpener parses the book read sequentially from r or in place from ra of size.
+// Reading from ra does not consume r, so the file is hashed by one pass anyway
+type bookOpener func(r io.Reader, ra io.ReaderAt, size int64) (parsers.Parser, error)
+
+// parseStockFile processes a single book file and adds it to book stock index, open parses the file format
+// file is bookPath relative to the stock root
+func (h *Handler) parseStockFile(bookPath, file string, open bookOpener) error {
 	if h.Hashes.FileExists(file, "") {
 		h.LOG.D.Printf("file %s is in stock already and has been skipped", file)
 		return nil
 	}
-	f, err := os.Open(FB2Path)
+	f, err := os.Open(bookPath)
 	if err != nil {
-		h.addFileToBookQueue(file, "", hash.FileOpenFailed)
-		return fmt.Errorf("failed to open file %s: %s", FB2Path, err)
+		h.addFileToBookQueue(file, "", hash.FileOpenFailed, err)
+		return fmt.Errorf("failed to open file %s: %s", bookPath, err)
 	}
 	defer f.Close()
+	fInfo, err := f.Stat()
+	if err != nil {
+		h.addFileToBookQueue(file, "", hash.FileOpenFailed, err)
+		return fmt.Errorf("failed to open file %s: %s", bookPath, err)
+	}
 
-	var p parsers.Parser
-	p, err = fb2.ParseFB2(f)
+	hr := hash.NewReader(f)
+	p, err := open(hr, f, fInfo.Size())
 	if err != nil {
-		h.addFileToBookQueue(file, "", hash.FileHasErrors)
+		state := hash.FileHasErrors
+		if errors.Is(err, errBadArchive) {
+			state = hash.BadArchive
+		}
+		h.addFileToBookQueue(file, "", state, err)
 		return fmt.Errorf("file %s has errors: %s", file, err)
 	}
 	h.LOG.D.Println(p)
-	if err := h.processLanguage(p, file, ""); err != nil {
+	p = h.applySidecar(p, bookPath, file)
+	if p, err = h.processLanguage(p, file, ""); err != nil {
+		return err
+	}
+	crc, sha, err := hr.Sums()
+	if err != nil {
+		h.addFileToBookQueue(file, "", hash.FileOpenFailed, err)
+		return fmt.Errorf("failed to read file %s: %s", bookPath, err)
+	}
+	book := h.createBookFromParser(p, file, "", fInfo.Size(), crc, sha)
+	if err := h.applyRules(book); err != nil {
 		return err
 	}
-	book := h.createBookFromParser(p, file, "", fInfo.Size(), fileCRC32(FB2Path))
 	h.GT.Refine(book)
 	h.BookQueue <- *book
 	return nil
 }
 
-// parseEPUB processes a single EPUB file and adds it to book stock index
-func (h *Handler) parseEPUB(EPUBPath string) error {
-	fInfo, _ := os.Stat(EPUBPath)
-	file := fInfo.Name()
-	if h.Hashes.FileExists(file, "") {
-		h.LOG.D.Printf("file %s is in stock already and has been skipped", file)
-		return nil
-	}
-	zr, err := zip.OpenReader(EPUBPath)
-	if err != nil {
-		h.addFileToBookQueue(fInfo.Name(), "", hash.BadArchive)
-		return fmt.Errorf("incorrect zip archive %s", file)
+// stockBookOpener returns the parser of single book file format, zip based books and PDF are read in place
+func (h *Handler) stockBookOpener(file string) bookOpener {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".epub":
+		return func(_ io.Reader, ra io.ReaderAt, size int64) (parsers.Parser, error) {
+			zr, err := zip.NewReader(ra, size)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", errBadArchive, err)
+			}
+			opfPath, err := epub.GetOPFPath(zr)
+			if err != nil {
+				return nil, err
+			}
+			return epub.NewOPF(zr, opfPath)
+		}
+	case ".cbz":
+		return func(_ io.Reader, ra io.ReaderAt, size int64) (parsers.Parser, error) {
+			zr, err := zip.NewReader(ra, size)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", errBadArchive, err)
+			}
+			return h.newCBZ(zr, file, "")
+		}
+	case ".pdf":
+		return func(_ io.Reader, ra io.ReaderAt, size int64) (parsers.Parser, error) {
+			return pdf.ParsePDF(ra, size, file)
+		}
+	default:
+		return func(r io.Reader, _ io.ReaderAt, _ int64) (parsers.Parser, error) {
+			return parseBookFile(file, r)
+		}
 	}
-	defer zr.Close()
+}
 
-	var p parsers.Parser
-	zPath, err := epub.GetOPFPath(zr)
+// parseZipBook parses zip based archive entry in place, comics are not read to memory when stored in archive uncompressed
+func (h *Handler) parseZipBook(file *File) (parsers.Parser, error) {
+	zr, close, err := file.OpenZip()
 	if err != nil {
-		h.addFileToBookQueue(fInfo.Name(), "", hash.FileHasErrors)
-		return fmt.Errorf("file %s has errors: %s", file, err)
+		return nil, err
 	}
-	p, err = epub.NewOPF(zr, zPath)
+	defer close()
+	return h.newCBZ(zr, file.Name, file.Archive)
+}
+
+// newCBZ parses the comic, malformed ComicInfo.xml is reported and the comic is catalogued without it
+func (h *Handler) newCBZ(zr *zip.Reader, file, archive string) (*cbz.CBZ, error) {
+	c, err := cbz.ParseCBZ(zr, file)
 	if err != nil {
-		h.addFileToBookQueue(fInfo.Name(), "", hash.FileHasErrors)
-		return fmt.Errorf("file %s has errors: %s", file, err)
+		return nil, err
 	}
-	h.LOG.D.Println(p)
-	if err := h.processLanguage(p, fInfo.Name(), ""); err != nil {
-		return err
+	if c.InfoError != nil {
+		if archive == "" {
+			h.LOG.W.Printf("file %s: %v, catalogued by file name\n", file, c.InfoError)
+		} else {
+			h.LOG.W.Printf("file %s from %s: %v, catalogued by file name\n", file, archive, c.InfoError)
+		}
 	}
-	book := h.createBookFromParser(p, fInfo.Name(), "", fInfo.Size(), fileCRC32(EPUBPath))
-	h.GT.Refine(book)
-	h.BookQueue <- *book
-	return nil
+	return c, nil
 }
 
-// parseZipEntry processes a zip archive with FB2 files and adds them to book stock index
-func (h *Handler) parseZipEntry(zipPath string) error {
+// parseZipEntry processes a zip archive with book files and adds them to book stock index
+// archive is zipPath relative to the stock root
+func (h *Handler) parseZipEntry(zipPath, archive string) (err error) {
+	defer h.recoverParser("", archive, &err)
 	h.LOG.D.Printf("archive %s indexing has been started\n", zipPath)
 	zr, err := zip.OpenReader(zipPath)
 	if err != nil {
-		h.addFileToBookQueue("", filepath.Base(zipPath), hash.BadArchive)
+		h.addFileToBookQueue("", archive, hash.BadArchive, err)
 		return fmt.Errorf("incorrect zip archive %s: %s", zipPath, err)
 	}
 	defer func() {
 		zr.Close()
 		h.LOG.D.Printf("archive %s indexing has been finished\n", zipPath)
 	}()
+	sidecars := make(map[string]*zip.File) // sidecar entries by their book names
+	for _, file := range zr.File {
+		if book, ok := sidecar.BookName(filepath.Base(file.Name)); ok {
+			sidecars[book] = file
+		}
+	}
+	var wg sync.WaitGroup // entries are parsed concurrently, archive is closed when all of them are done
 	for _, file := range zr.File {
 		h.LOG.D.Print(ZipEntryInfo(file))
+		if _, ok := sidecar.BookName(filepath.Base(file.Name)); ok {
+			continue
+		}
 
-		if h.Hashes.FileExists(filepath.Base(file.Name), filepath.Base(zipPath)) {
-			h.LOG.D.Printf("file %s from %s is in stock already and has been skipped", filepath.Base(file.Name), filepath.Base(zipPath))
+		if h.Hashes.FileExists(filepath.Base(file.Name), archive) {
+			h.LOG.D.Printf("file %s from %s is in stock already and has been skipped", filepath.Base(file.Name), archive)
 			continue
 		}
 
 		if file.UncompressedSize64 == 0 {
-			h.addFileToBookQueue(filepath.Base(file.Name), filepath.Base(zipPath), hash.FileIsEmpty)
-			h.LOG.D.Printf("file %s from %s has size of zero and has been skipped\n", file.Name, filepath.Base(zipPath))
+			h.addFileToBookQueue(filepath.Base(file.Name), archive, hash.FileIsEmpty, fmt.Errorf("file has size of zero"))
+			h.LOG.D.Printf("file %s from %s has size of zero and has been skipped\n", file.Name, archive)
 			continue
 		}
-		if filepath.Ext(file.Name) != ".fb2" {
-			h.addFileToBookQueue(filepath.Base(file.Name), filepath.Base(zipPath), hash.UnsupportedFormat)
-			h.LOG.D.Printf("file %s from %s has unsupported format \"%s\" and has been skipped\n", file.Name, filepath.Base(zipPath), filepath.Ext(file.Name))
+		if !isArchiveEntryFormat(filepath.Ext(file.Name)) {
+			h.addFileToBookQueue(filepath.Base(file.Name), archive, hash.UnsupportedFormat, fmt.Errorf("unsupported format \"%s\"", filepath.Ext(file.Name)))
+			h.LOG.D.Printf("file %s from %s has unsupported format \"%s\" and has been skipped\n", file.Name, archive, filepath.Ext(file.Name))
 			continue
 
 		}
 
-		h.ScanWG.Add(1)
-		f := &File{
-			Reader: func() io.ReadCloser {
-				r, _ := file.Open()
-				return r
-			}(),
+		var meta *sidecar.Metadata
+		if sc, ok := sidecars[filepath.Base(file.Name)]; ok {
+			meta = h.readSidecarEntry(sc, archive)
+		}
+		wg.Add(1)
+		h.FileQueue <- File{
+			Open:    file.Open,
+			OpenZip: func() (*zip.Reader, func() error, error) { return parsers.OpenZipEntry(zipPath, file) },
 			Name:    filepath.Base(file.Name),
 			CRC32:   file.CRC32,
-			Archive: filepath.Base(zipPath),
+			Archive: archive,
 			Size:    int64(file.UncompressedSize64),
+			Sidecar: meta,
+			done:    func(error) { wg.Done() },
 		}
-		h.FileQueue <- *f
-
 	}
-	h.ScanWG.Wait()
+	wg.Wait()
 	return nil
 }
 
-// fileCRC32 calculates file CRC32
-func fileCRC32(filePath string) uint32 {
-	fbytes, err := os.ReadFile(filePath)
+// readSidecarEntry reads the sidecar archive entry, metadata are nil if the entry is broken
+func (h *Handler) readSidecarEntry(file *zip.File, archive string) *sidecar.Metadata {
+	rc, err := file.Open()
 	if err != nil {
-		return 0
+		h.LOG.W.Printf("sidecar %s from %s was not read: %v\n", file.Name, archive, err)
+		return nil
+	}
+	defer rc.Close()
+	m, err := sidecar.Parse(file.Name, rc)
+	if err != nil {
+		h.LOG.W.Printf("sidecar %s from %s was not read: %v\n", file.Name, archive, err)
+		return nil
+	}
+	return m
+}
+
+// isArchiveEntryFormat reports whether book files with ext extension are indexed inside zip archives
+func isArchiveEntryFormat(ext string) bool {
+	switch strings.ToLower(ext) {
+	case ".fb2", ".epub", ".pdf", ".mobi", ".azw", ".azw3", ".cbz":
+		return true
+	}
+	return false
+}
+
+// parseBookFile parses book content according to the file name extension
+func parseBookFile(name string, r io.Reader) (parsers.Parser, error) {
+	switch ext := strings.ToLower(filepath.Ext(name)); ext {
+	case ".fb2":
+		return fb2.ParseFB2(io.NopCloser(r))
+	case ".epub":
+		zr, err := parsers.NewZipReader(r)
+		if err != nil {
+			return nil, err
+		}
+		opfPath, err := epub.GetOPFPath(zr)
+		if err != nil {
+			return nil, err
+		}
+		return epub.NewOPF(zr, opfPath)
+	case ".pdf":
+		sr, remove, err := parsers.SpoolReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer remove()
+		return pdf.ParsePDF(sr, sr.Size(), name)
+	case ".mobi", ".azw", ".azw3":
+		return mobi.ParseMOBI(r, name)
+	case ".cbz":
+		zr, err := parsers.NewZipReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return cbz.ParseCBZ(zr, name)
+	default:
+		return nil, fmt.Errorf("unsupported format \"%s\"", ext)
 	}
-	return crc32.ChecksumIEEE(fbytes)
 }
@@ -1,55 +1,95 @@
 package index
 
 import (
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/vinser/flibgolite/internal/core/model"
 	"github.com/vinser/flibgolite/internal/hash"
 	"github.com/vinser/flibgolite/internal/parsers"
-	"github.com/vinser/flibgolite/internal/parsers/fb2"
+	"github.com/vinser/flibgolite/internal/parsers/sidecar"
 	"github.com/vinser/flibgolite/internal/store"
 )
 
-// ParseFB2Queue processes files from the file queue
-func (h *Handler) ParseFB2Queue() {
+// ReadZipQueue reads zip archives from the zip queue and puts their entries to the file queue
+func (h *Handler) ReadZipQueue() {
 	for {
 		select {
-		case file := <-h.FileQueue:
-			func() {
-				f := file.Reader
-				defer func() {
-					f.Close()
-					h.ScanWG.Done()
-				}()
-				var p parsers.Parser
-				p, err := fb2.ParseFB2(f)
-				if err != nil {
-					h.addFileToBookQueue(file.Name, file.Archive, hash.FileHasErrors)
-					h.LOG.D.Printf("file %s from %s has error: <%s> and has been skipped\n", file.Name, file.Archive, err.Error())
-					return
-				}
-				if err := h.processLanguage(p, file.Name, file.Archive); err != nil {
-					return
-				}
-				h.LOG.D.Println(p)
-				book := h.createBookFromParser(p, file.Name, file.Archive, file.Size, file.CRC32)
-				h.GT.Refine(book)
-				h.BookQueue <- *book
-			}()
+		case z := <-h.ZipQueue:
+			h.readZip(z)
+		case <-h.StopWorkers:
+			return
+		}
+	}
+}
 
+// ParseFileQueue processes files from the file queue
+func (h *Handler) ParseFileQueue() {
+	for {
+		select {
+		case file := <-h.FileQueue:
+			file.done(h.parseFile(&file))
 		case <-time.After(time.Second):
 			h.LOG.D.Printf("File queue timeout")
-		case <-h.StopScan:
+		case <-h.StopWorkers:
 			return
 		}
 	}
+}
 
+// parseFile parses single book file or archive entry and puts the book to the book queue
+func (h *Handler) parseFile(file *File) (err error) {
+	defer h.recoverParser(file.Name, file.Archive, &err)
+	if file.Open == nil {
+		return h.parseStockFile(file.Path, file.Name, h.stockBookOpener(file.Name))
+	}
+	f, err := file.Open()
+	if err != nil {
+		h.addFileToBookQueue(file.Name, file.Archive, hash.FileOpenFailed, err)
+		return err
+	}
+	defer f.Close()
+	hr := hash.NewReader(f)
+	sha := ""
+	var p parsers.Parser
+	if file.OpenZip != nil && strings.EqualFold(filepath.Ext(file.Name), ".cbz") {
+		p, err = h.parseZipBook(file)
+	} else {
+		p, err = parseBookFile(file.Name, hr)
+	}
+	if err == nil {
+		_, sha, err = hr.Sums()
+	}
+	if err != nil {
+		h.addFileToBookQueue(file.Name, file.Archive, hash.FileHasErrors, err)
+		h.LOG.D.Printf("file %s from %s has error: <%s> and has been skipped\n", file.Name, file.Archive, err.Error())
+		return err
+	}
+	if file.Sidecar != nil {
+		h.LOG.I.Printf("metadata of %s from %s were overridden by sidecar\n", file.Name, file.Archive)
+		p = sidecar.Override(p, file.Sidecar)
+	}
+	if p, err = h.processLanguage(p, file.Name, file.Archive); err != nil {
+		return err
+	}
+	h.LOG.D.Println(p)
+	book := h.createBookFromParser(p, file.Name, file.Archive, file.Size, file.CRC32, sha)
+	if err := h.applyRules(book); err != nil {
+		return err
+	}
+	h.GT.Refine(book)
+	h.BookQueue <- *book
+	return nil
 }
 
 // AddBooksToIndex processes books from the book queue and adds them to the database
 func (h *Handler) AddBooksToIndex() {
 	tx := &store.TX{}
+	coverBooks := []model.Book{} // books of the transaction with covers to be cached
 	defer func() {
 		tx.TxEnd()
+		h.queueCovers(coverBooks)
 		h.StopDB <- struct{}{}
 	}()
 	bookInTX := 0
@@ -63,10 +103,14 @@ func (h *Handler) AddBooksToIndex() {
 			switch state := h.Hashes.GetState(&book, h.CFG.Database.DEDUPLICATE_LEVEL); state {
 			case hash.Unique:
 				err := tx.NewBook(&book)
+				if err == nil && h.CFG.Database.DEDUPLICATE_LEVEL == "V" {
+					err = h.addVersion(tx, &book)
+				}
 				if err != nil {
 					h.LOG.W.Println("Error adding book to database:", err)
 					return
 				}
+				coverBooks = h.addCover(coverBooks, &book)
 			default:
 				err := tx.RecordBookState(&book, state)
 				if err != nil {
@@ -82,12 +126,28 @@ func (h *Handler) AddBooksToIndex() {
 			}
 			if bookInTX >= h.CFG.Database.MAX_BOOKS_IN_TX {
 				tx.TxEnd()
+				h.Hashes.Commit()
+				h.queueCovers(coverBooks)
+				coverBooks = coverBooks[:0]
+				bookInTX = 0
+			}
+		case done := <-h.HashReload:
+			if bookInTX > 0 {
+				tx.TxEnd()
+				h.Hashes.Commit()
+				h.queueCovers(coverBooks)
+				coverBooks = coverBooks[:0]
 				bookInTX = 0
 			}
+			h.Hashes.Replace(hash.InitHashes(h.DB.DB, h.DB.Library, h.CFG.Database.HASHES))
+			close(done)
 		case <-time.After(time.Second):
 			h.LOG.D.Printf("Book queue timeout")
 			if tx.Tx != nil {
 				tx.TxEnd()
+				h.Hashes.Commit()
+				h.queueCovers(coverBooks)
+				coverBooks = coverBooks[:0]
 			}
 			bookInTX = 0
 		case <-h.StopDB:
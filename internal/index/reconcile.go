@@ -0,0 +1,281 @@
+package index
+
+import (
+	"archive/zip"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/vinser/flibgolite/internal/core/model"
+	"github.com/vinser/flibgolite/internal/hash"
+	"github.com/vinser/flibgolite/internal/parsers"
+	"github.com/vinser/flibgolite/internal/parsers/sidecar"
+)
+
+// Reconcile removes index records of books whose files or archives were deleted from the stock
+// and indexes again files and archive entries that were replaced since they had been indexed
+func (h *Handler) Reconcile() {
+	start := time.Now()
+	books, err := h.DB.StockBooks()
+	if err != nil {
+		h.LOG.E.Printf("Stock reconciliation failed: %v\n", err)
+		return
+	}
+	statuses, err := h.DB.IngestStatuses(hash.Unique, -1, 0)
+	if err != nil {
+		h.LOG.E.Printf("Stock reconciliation failed: %v\n", err)
+		return
+	}
+	rejected := make(map[string]map[string]struct{}) // rejected entries by archive
+	for _, s := range statuses {
+		if s.Archive != "" {
+			if rejected[s.Archive] == nil {
+				rejected[s.Archive] = make(map[string]struct{})
+			}
+			rejected[s.Archive][s.File] = struct{}{}
+		}
+	}
+	archives := make(map[string][]*model.Book)
+	removed := []*model.Book{}
+	refresh := []string{} // stock files and archives to index again
+	for _, b := range books {
+		if b.Archive != "" {
+			archives[b.Archive] = append(archives[b.Archive], b)
+			continue
+		}
+		gone, changed := h.checkFile(b)
+		if gone || changed {
+			removed = append(removed, b)
+		}
+		if changed {
+			refresh = append(refresh, b.File)
+		}
+	}
+	for archive, entries := range archives {
+		gone, changed := h.checkArchive(archive, entries, rejected[archive])
+		removed = append(removed, gone...)
+		if changed {
+			refresh = append(refresh, archive)
+		}
+	}
+
+	outdated, replaced := h.checkStatuses(statuses)
+	for _, rel := range replaced {
+		if !slices.Contains(refresh, rel) {
+			refresh = append(refresh, rel)
+		}
+	}
+
+	if err := h.forget(removed, outdated); err != nil {
+		h.LOG.E.Printf("Stock reconciliation failed: %v\n", err)
+		return
+	}
+	for _, rel := range refresh {
+		h.LOG.I.Printf("file %s was replaced and will be indexed again\n", rel)
+		path := parsers.StockPath(h.CFG.Library.STOCK_DIR, rel)
+		h.processFile(h.CFG.Library.STOCK_DIR, path, strings.ToLower(filepath.Ext(path)))
+	}
+	h.LOG.S.Printf("Stock reconciliation: %d records removed, %d ingest statuses removed, %d files refreshed, %v elapsed\n", len(removed), len(outdated), len(refresh), time.Since(start))
+}
+
+// forget removes index records of the books and ingest statuses of the rejected files,
+// so the files are indexed again by the next scan
+func (h *Handler) forget(removed []*model.Book, outdated []*model.IngestStatus) error {
+	if len(removed) > 0 {
+		if err := h.DB.DeleteBooks(removed); err != nil {
+			return err
+		}
+		h.coverCache().Remove(removed)
+		for _, b := range removed {
+			h.Hashes.Remove(b)
+		}
+		if err := h.electOrphanVersions(); err != nil {
+			return err
+		}
+	}
+	if len(outdated) > 0 {
+		if err := h.DB.DeleteIngestStatuses(outdated); err != nil {
+			return err
+		}
+		for _, s := range outdated {
+			h.Hashes.Remove(&model.Book{File: s.File, Archive: s.Archive, Updated: s.State})
+		}
+	}
+	return nil
+}
+
+// refreshStockFile indexes again the single stock file if it was indexed or rejected before changed time,
+// e.g. when its sidecar file was changed
+func (h *Handler) refreshStockFile(rel string, changed int64) {
+	books, err := h.DB.StockFileBooks(rel)
+	statuses := []*model.IngestStatus{}
+	if err == nil {
+		statuses, err = h.DB.FileIngestStatuses(rel, "")
+	}
+	if err != nil {
+		h.LOG.E.Printf("file %s was not indexed again: %v\n", rel, err)
+		return
+	}
+	outdated := false
+	for _, b := range books {
+		outdated = outdated || b.Updated < changed
+	}
+	for _, s := range statuses {
+		outdated = outdated || s.Updated < changed
+	}
+	if !outdated {
+		return
+	}
+	h.LOG.I.Printf("sidecar of %s was changed, the file will be indexed again\n", rel)
+	if err := h.forget(books, statuses); err != nil {
+		h.LOG.E.Printf("file %s was not indexed again: %v\n", rel, err)
+		return
+	}
+	path := parsers.StockPath(h.CFG.Library.STOCK_DIR, rel)
+	h.processFile(h.CFG.Library.STOCK_DIR, path, strings.ToLower(filepath.Ext(path)))
+}
+
+// sidecarChanged reports whether a sidecar file of the book file was modified after the book was indexed
+func sidecarChanged(bookPath string, indexed int64) bool {
+	for _, name := range sidecar.Names(bookPath) {
+		if info, err := os.Stat(name); err == nil && info.ModTime().UnixNano() > indexed {
+			return true
+		}
+	}
+	return false
+}
+
+// checkFile reports whether single stock file of the book was deleted or replaced
+func (h *Handler) checkFile(b *model.Book) (gone, changed bool) {
+	path := parsers.StockPath(h.CFG.Library.STOCK_DIR, b.File)
+	info, err := os.Stat(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		h.LOG.I.Printf("file %s was deleted from stock\n", b.File)
+		return true, false
+	case err != nil:
+		h.LOG.W.Println(err)
+		return false, false
+	case sidecarChanged(path, b.Updated):
+		h.LOG.I.Printf("sidecar of %s was changed\n", b.File)
+		return false, true
+	case info.Size() == b.Size && info.ModTime().UnixNano() <= b.Updated:
+		return false, false
+	}
+	if info.Size() == b.Size { // file could be touched only
+		crc, sha, err := hash.FileSums(path)
+		switch {
+		case err != nil:
+			h.LOG.W.Println(err)
+			return false, false
+		case b.SHA256 != "" && sha == b.SHA256, b.SHA256 == "" && crc == b.CRC32:
+			return false, false
+		}
+	}
+	return false, true
+}
+
+// checkArchive returns the records of deleted or replaced archive entries
+// and reports whether the archive has to be indexed again, rejected entries are not new ones
+func (h *Handler) checkArchive(archive string, books []*model.Book, rejected map[string]struct{}) (gone []*model.Book, changed bool) {
+	path := parsers.StockPath(h.CFG.Library.STOCK_DIR, archive)
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		h.LOG.I.Printf("archive %s was deleted from stock\n", archive)
+		return books, false
+	}
+	if err != nil {
+		h.LOG.W.Println(err)
+		return nil, false
+	}
+	var updated int64
+	for _, b := range books {
+		updated = max(updated, b.Updated)
+	}
+	if info.ModTime().UnixNano() <= updated {
+		return nil, false
+	}
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		h.LOG.W.Printf("incorrect zip archive %s: %s\n", archive, err)
+		return nil, false
+	}
+	defer zr.Close()
+	entries := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		entries[filepath.Base(f.Name)] = f
+	}
+	known := make(map[string]struct{}, len(books)+len(rejected))
+	for name := range rejected {
+		known[name] = struct{}{}
+	}
+	for _, b := range books {
+		known[b.File] = struct{}{}
+		f, ok := entries[b.File]
+		switch {
+		case !ok:
+			h.LOG.I.Printf("file %s was deleted from %s\n", b.File, archive)
+			gone = append(gone, b)
+		case b.CRC32 != 0 && (f.CRC32 != b.CRC32 || int64(f.UncompressedSize64) != b.Size):
+			gone, changed = append(gone, b), true
+		case sidecarEntryChanged(entries, b):
+			h.LOG.I.Printf("sidecar of %s from %s was changed\n", b.File, archive)
+			gone, changed = append(gone, b), true
+		}
+	}
+	for name := range entries {
+		if _, ok := sidecar.BookName(name); ok {
+			continue
+		}
+		if _, ok := known[name]; !ok {
+			changed = true
+			break
+		}
+	}
+	return gone, changed
+}
+
+// sidecarEntryChanged reports whether a sidecar entry of the archived book was modified after the book was indexed
+func sidecarEntryChanged(entries map[string]*zip.File, b *model.Book) bool {
+	for _, name := range sidecar.Names(b.File) {
+		if f, ok := entries[name]; ok && f.Modified.UnixNano() > b.Updated {
+			return true
+		}
+	}
+	return false
+}
+
+// checkStatuses returns ingest statuses of rejected files deleted both from the stock and the trash folder
+// or replaced in the stock since they were rejected, replaced stock files and archives are returned too
+func (h *Handler) checkStatuses(statuses []*model.IngestStatus) (outdated []*model.IngestStatus, replaced []string) {
+	for _, s := range statuses {
+		rel := s.File
+		if s.Archive != "" {
+			rel = s.Archive
+		}
+		path := parsers.StockPath(h.CFG.Library.STOCK_DIR, rel)
+		info, err := os.Stat(path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			if h.CFG.Library.TRASH_DIR != "" {
+				if _, err := os.Stat(filepath.Join(h.CFG.Library.TRASH_DIR, filepath.FromSlash(rel))); err == nil {
+					continue // rejected file is kept in the trash folder
+				}
+			}
+			outdated = append(outdated, s)
+		case err != nil:
+			h.LOG.W.Println(err)
+		case s.Updated > 0 && (info.ModTime().UnixNano() > s.Updated || s.Archive == "" && sidecarChanged(path, s.Updated)):
+			h.LOG.I.Printf("rejected file %s was replaced and will be indexed again\n", rel)
+			outdated = append(outdated, s)
+			if !slices.Contains(replaced, rel) {
+				replaced = append(replaced, rel)
+			}
+		}
+	}
+	return outdated, replaced
+}
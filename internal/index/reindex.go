@@ -0,0 +1,34 @@
+package index
+
+import (
+	"github.com/vinser/flibgolite/internal/hash"
+)
+
+// reloadHashes replaces book hashes with the ones loaded from database. The routine adding books to index
+// reloads them between its transactions, so the books of the open transaction are not lost.
+// Hashes are reloaded at once by the handler without such routine
+func (h *Handler) reloadHashes() {
+	if h.HashReload == nil {
+		h.Hashes.Replace(hash.InitHashes(h.DB.DB, h.DB.Library, h.CFG.Database.HASHES))
+		return
+	}
+	done := make(chan struct{})
+	h.HashReload <- done
+	<-done
+}
+
+// ReloadHashes reloads book hashes if the index was rebuilt or rejected files were requeued since they had been loaded,
+// covers cached for the previous index are removed
+func (h *Handler) ReloadHashes() bool {
+	id := h.DB.BuildID()
+	if id == h.BuildID {
+		return false
+	}
+	h.reloadHashes()
+	h.BuildID = id
+	if err := h.coverCache().Prune(); err != nil {
+		h.LOG.W.Printf("Covers of the previous index build were not removed: %v\n", err)
+	}
+	h.LOG.S.Printf("Book hashes were reloaded for the index build %s\n", id)
+	return true
+}
@@ -10,10 +10,11 @@ import (
 	"time"
 
 	"github.com/vinser/flibgolite/internal/hash"
+	"github.com/vinser/flibgolite/internal/parsers/sidecar"
 )
 
 // isFileReady checks if a file is ready for processing
-func (h *Handler) isFileReady(dir string, ent fs.DirEntry) (path string, ext string, err error) {
+func (h *Handler) isFileReady(root, dir string, ent fs.DirEntry) (path string, ext string, err error) {
 	info, err := ent.Info()
 	if err != nil {
 		return "", "", err
@@ -33,14 +34,14 @@ func (h *Handler) isFileReady(dir string, ent fs.DirEntry) (path string, ext str
 			if info.Size() == oldSize {
 				if info.Size() == 0 {
 					err := fmt.Errorf("file %s has size of zero", path)
-					h.addFileToBookQueue(info.Name(), "", hash.FileIsEmpty)
-					h.moveFile(path, err)
+					h.addFileToBookQueue(relPath(root, path), "", hash.FileIsEmpty, err)
+					h.moveFile(root, path, err)
 					return "", "", err
 				}
 				// check if file is ready
 				h.LOG.D.Println("Check if file is not busy", path)
 				switch ext {
-				case ".zip", ".epub":
+				case ".zip", ".epub", ".cbz":
 					for {
 						time.Sleep(poll)
 						r, err := zip.OpenReader(path)
@@ -62,12 +63,19 @@ func (h *Handler) isFileReady(dir string, ent fs.DirEntry) (path string, ext str
 			oldSize = info.Size()
 		}
 	}
-	h.addFileToBookQueue(info.Name(), "", hash.FileIsNotRegular)
-	return "", "", fmt.Errorf("file %s is not a regular file", path)
+	path = filepath.Join(dir, info.Name())
+	err = fmt.Errorf("file %s is not a regular file", path)
+	h.addFileToBookQueue(relPath(root, path), "", hash.FileIsNotRegular, err)
+	return "", "", err
 }
 
-// ScanDir scans a directory for new books and processes them
+// ScanDir scans a directory and its subdirectories for new books and processes them
 func (h *Handler) ScanDir(dir string) error {
+	return h.scanDir(dir, dir)
+}
+
+// scanDir scans dir recursively, book paths are kept relative to root
+func (h *Handler) scanDir(root, dir string) error {
 	d, err := os.Open(dir)
 	if err != nil {
 		return err
@@ -80,47 +88,145 @@ func (h *Handler) ScanDir(dir string) error {
 	absDir, _ := filepath.Abs(dir)
 	h.LOG.I.Printf("scanning folder %s for new books...\n", absDir)
 	for _, entry := range entries {
-		path, ext, err := h.isFileReady(dir, entry)
+		if entry.IsDir() {
+			subDir := filepath.Join(dir, entry.Name())
+			if h.isServiceDir(subDir) {
+				continue
+			}
+			if err := h.scanDir(root, subDir); err != nil {
+				h.LOG.W.Printf("Error scanning folder %s: %v", subDir, err)
+			}
+			continue
+		}
+		path, ext, err := h.isFileReady(root, dir, entry)
 		if err != nil {
 			h.LOG.I.Println(err)
 			continue
 		}
-		switch {
-		case ext == ".fb2":
-			go func() {
-				h.LOG.I.Println("file: ", entry.Name())
-				err = h.parseFB2(path)
-				h.moveFile(path, err)
-				if err != nil {
-					h.LOG.W.Printf("Error processing file %s: %v", entry.Name(), err)
-				}
-			}()
-		case ext == ".epub":
-			go func() {
-				h.LOG.I.Println("file: ", entry.Name())
-				err = h.parseEPUB(path)
-				h.moveFile(path, err)
+		h.processFile(root, path, ext)
+	}
+	return nil
+}
+
+// ScanFile processes a single new acquisition reported by the folder watcher
+func (h *Handler) ScanFile(root, path string) {
+	info, err := os.Stat(path)
+	if err != nil { // file was moved or deleted already
+		return
+	}
+	switch {
+	case info.IsDir():
+		if h.isServiceDir(path) {
+			return
+		}
+		if err := h.scanDir(root, path); err != nil {
+			h.LOG.W.Printf("Error scanning folder %s: %v", path, err)
+		}
+	case !info.Mode().IsRegular():
+		err := fmt.Errorf("file %s is not a regular file", path)
+		h.addFileToBookQueue(relPath(root, path), "", hash.FileIsNotRegular, err)
+		h.LOG.I.Println(err)
+	case info.Size() == 0:
+		err := fmt.Errorf("file %s has size of zero", path)
+		h.addFileToBookQueue(relPath(root, path), "", hash.FileIsEmpty, err)
+		h.moveFile(root, path, err)
+		h.LOG.I.Println(err)
+	default:
+		h.processFile(root, path, strings.ToLower(filepath.Ext(path)))
+	}
+}
+
+// processFile queues the ready file to be parsed and moved to the stock or to the trash folder,
+// it blocks while the queue is full
+func (h *Handler) processFile(root, path, ext string) {
+	if _, busy := h.processing.LoadOrStore(path, struct{}{}); busy {
+		h.LOG.D.Printf("file %s is being processed already", path)
+		return
+	}
+	rel := relPath(root, path)
+	if book, ok := sidecar.BookName(path); ok {
+		defer h.processing.Delete(path)
+		h.processSidecar(root, path, book)
+		return
+	}
+	switch {
+	case ext == ".fb2", ext == ".epub", ext == ".pdf", ext == ".mobi", ext == ".azw", ext == ".azw3", ext == ".cbz":
+		h.LOG.I.Println("file: ", rel)
+		h.FileQueue <- File{
+			Path: path,
+			Name: rel,
+			done: func(err error) {
+				defer h.processing.Delete(path)
+				h.moveFile(root, path, err)
 				if err != nil {
-					h.LOG.W.Printf("Error processing file %s: %v", entry.Name(), err)
+					h.LOG.W.Printf("Error processing file %s: %v", rel, err)
 				}
-			}()
-		case ext == ".zip":
-			start := time.Now()
-			new := !h.Hashes.ArchiveExists(entry.Name())
-			h.LOG.I.Println("zip: ", entry.Name())
-			err = h.parseZipEntry(path)
-			h.moveFile(path, err)
-			if err != nil {
-				h.LOG.W.Println(err)
-			}
-			if new {
-				h.LOG.S.Printf("%v elapsed for parsing %s ", time.Since(start), entry.Name())
-			}
-		default:
-			h.LOG.D.Printf("file %s has not supported format \"%s\"\n", path, filepath.Ext(path))
-			h.addFileToBookQueue(entry.Name(), "", hash.UnsupportedFormat)
-			h.moveFile(path, err)
+			},
+		}
+	case ext == ".zip":
+		h.ZipQueue <- Zip{Root: root, Path: path}
+	default:
+		defer h.processing.Delete(path)
+		h.LOG.D.Printf("file %s has not supported format \"%s\"\n", path, filepath.Ext(path))
+		if !h.Hashes.FileExists(rel, "") {
+			h.addFileToBookQueue(rel, "", hash.UnsupportedFormat, fmt.Errorf("unsupported format \"%s\"", filepath.Ext(path)))
 		}
+		h.moveFile(root, path, nil)
 	}
-	return nil
+}
+
+// processSidecar leaves the sidecar file of new acquisition to be moved together with its book,
+// otherwise the book of the sidecar is indexed again if it is in the stock already
+func (h *Handler) processSidecar(root, path, bookPath string) {
+	stock := h.CFG.Library.STOCK_DIR
+	if root != stock {
+		if _, err := os.Stat(bookPath); err == nil {
+			return
+		}
+		h.moveFile(root, path, nil)
+		h.refreshStockFile(relPath(root, bookPath), time.Now().UnixNano())
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	h.refreshStockFile(relPath(root, bookPath), info.ModTime().UnixNano())
+}
+
+// readZip puts the archive entries to the file queue, waits until they are parsed
+// and moves the archive to the stock or to the trash folder
+func (h *Handler) readZip(z Zip) {
+	defer h.processing.Delete(z.Path)
+	start := time.Now()
+	rel := relPath(z.Root, z.Path)
+	new := !h.Hashes.ArchiveExists(rel)
+	h.LOG.I.Println("zip: ", rel)
+	err := h.parseZipEntry(z.Path, rel)
+	h.moveFile(z.Root, z.Path, err)
+	if err != nil {
+		h.LOG.W.Println(err)
+	}
+	if new {
+		h.LOG.S.Printf("%v elapsed for parsing %s ", time.Since(start), rel)
+	}
+}
+
+// NewDirWatcher starts watching dir and its subfolders for new acquisitions
+func (h *Handler) NewDirWatcher(dir string) (*Watcher, error) {
+	w, err := NewWatcher(h.isServiceDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.Add(dir); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// isServiceDir reports whether dir is a library folder that must not be scanned as a part of another one
+func (h *Handler) isServiceDir(dir string) bool {
+	return (h.CFG.Library.TRASH_DIR != "" && dir == h.CFG.Library.TRASH_DIR) ||
+		(h.CFG.Library.NEW_DIR != "" && dir == h.CFG.Library.NEW_DIR)
 }
@@ -7,36 +7,73 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"runtime/debug"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/vinser/flibgolite/internal/core/config"
 	"github.com/vinser/flibgolite/internal/core/model"
+	"github.com/vinser/flibgolite/internal/covers"
 	"github.com/vinser/flibgolite/internal/genres"
 	"github.com/vinser/flibgolite/internal/hash"
+	"github.com/vinser/flibgolite/internal/parsers/sidecar"
 	"github.com/vinser/flibgolite/internal/rlog"
+	"github.com/vinser/flibgolite/internal/rules"
 	"github.com/vinser/flibgolite/internal/store"
 )
 
+// Handler indexes the book stock with the pipeline of goroutines connected by bounded queues:
+// folder scanning puts zip archives to ZipQueue and book files to FileQueue,
+// ReadZipQueue routines put archive entries to FileQueue, ParseFileQueue routines put parsed books to BookQueue
+// and the only AddBooksToIndex routine writes them to database. Full queue blocks its producers.
+// CacheCovers routines extract covers of the added books to the cover cache.
 type Handler struct {
-	CFG       *config.Config
-	Hashes    *hash.BookHashes
-	DB        *store.DB
-	GT        *genres.GenresTree
-	LOG       *rlog.Log
-	ScanWG    sync.WaitGroup
-	FileQueue chan File
-	BookQueue chan model.Book
-	StopScan  chan struct{}
-	StopDB    chan struct{}
+	CFG         *config.Config
+	Hashes      *hash.BookHashes
+	DB          *store.DB
+	GT          *genres.GenresTree
+	Rules       *rules.Rules // metadata normalization rules applied before genres are refined
+	LOG         *rlog.Log
+	Covers      *covers.Cache // nil if covers are not cached
+	ZipQueue    chan Zip
+	FileQueue   chan File
+	BookQueue   chan model.Book
+	CoverQueue  chan Cover // added books with covers to be cached
+	StopScan    chan struct{}
+	StopWorkers chan struct{} // closed to stop zip reading and file parsing routines
+	StopDB      chan struct{}
+	HashReload  chan chan struct{} // book hashes reload requests, the done channel is closed when hashes are reloaded
+	BuildID     string             // index build the hashes were loaded from
+
+	processing    sync.Map     // paths of files being processed now
+	coversPending atomic.Int64 // added books which covers are not cached yet
+}
+
+// Zip is a zip archive waiting to be read
+type Zip struct {
+	Root string // folder the archive was found in
+	Path string
 }
 
+// Cover is the cover of added book waiting to be cached
+type Cover struct {
+	Book  model.Book
+	Cache *covers.Cache // cache of the index the book was added to
+}
+
+// File is a single book file or a zip archive entry waiting to be parsed
 type File struct {
-	Reader  io.ReadCloser
+	Open    func() (io.ReadCloser, error)             // opens archive entry, nil for single book file
+	OpenZip func() (*zip.Reader, func() error, error) // opens zip based archive entry in place, nil for single book file
+	Path    string                                    // path of single book file
 	Name    string
 	CRC32   uint32
 	Archive string
 	Size    int64
+	Sidecar *sidecar.Metadata // metadata of sidecar archive entry, single book file sidecar is found when parsed
+
+	done func(err error) // called when the file was parsed
 }
 
 // InitStockFolders()
@@ -56,12 +93,39 @@ func (h *Handler) InitStockFolders() {
 	}
 }
 
-func (h *Handler) addFileToBookQueue(file, archive string, state hash.BookState) {
-	h.BookQueue <- model.Book{
+// Idle reports whether no files are being processed and no books are waiting to be added to index
+// or to have their covers cached
+func (h *Handler) Idle() bool {
+	busy := false
+	h.processing.Range(func(_, _ any) bool {
+		busy = true
+		return false
+	})
+	return !busy && len(h.ZipQueue) == 0 && len(h.FileQueue) == 0 && len(h.BookQueue) == 0 && h.coversPending.Load() == 0
+}
+
+// addFileToBookQueue queues the state of rejected file to be recorded in ingest status, err may be nil
+func (h *Handler) addFileToBookQueue(file, archive string, state hash.BookState, err error) {
+	book := model.Book{
 		File:    file,
 		Archive: archive,
 		Updated: int64(state),
 	}
+	if err != nil {
+		book.Error = err.Error()
+	}
+	h.BookQueue <- book
+}
+
+// recoverParser turns the parser panic on malformed file into the file error, so the file does not stop indexing
+func (h *Handler) recoverParser(file, archive string, err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	*err = fmt.Errorf("parser failed: %v", r)
+	h.LOG.E.Printf("file %s %s: %v\n%s", file, archive, r, debug.Stack())
+	h.addFileToBookQueue(file, archive, hash.FileHasErrors, *err)
 }
 
 func (h *Handler) acceptLanguage(lang string) bool {
@@ -71,15 +135,48 @@ func (h *Handler) acceptLanguage(lang string) bool {
 	return strings.Contains(h.CFG.ACCEPTED, lang)
 }
 
-func (h *Handler) moveFile(filePath string, err error) {
-	if err != nil && h.CFG.Library.TRASH_DIR != "" {
-		os.Rename(filePath, filepath.Join(h.CFG.Library.TRASH_DIR, filepath.Base(filePath)))
+// moveFile moves processed file to the stock folder or to the trash folder in case of error
+// keeping its folder layout relative to root
+func (h *Handler) moveFile(root, filePath string, err error) {
+	dest := h.CFG.Library.STOCK_DIR
+	switch {
+	case err != nil && h.CFG.Library.TRASH_DIR != "":
+		dest = h.CFG.Library.TRASH_DIR
+	case root == h.CFG.Library.STOCK_DIR:
 		return
 	}
-	if filepath.Dir(filePath) == h.CFG.Library.STOCK_DIR {
-		return
+	moveTo(filePath, filepath.Join(dest, filepath.FromSlash(relPath(root, filePath))))
+	for _, name := range sidecar.Names(filePath) { // sidecar files follow their book
+		if _, err := os.Stat(name); err == nil {
+			moveTo(name, filepath.Join(dest, filepath.FromSlash(relPath(root, name))))
+		}
+	}
+	removeEmptyDirs(root, filepath.Dir(filePath))
+}
+
+// removeEmptyDirs removes the new acquisitions subfolder and its parents below root while they are empty
+func removeEmptyDirs(root, dir string) {
+	root, dir = filepath.Clean(root), filepath.Clean(dir)
+	for strings.HasPrefix(dir, root+string(filepath.Separator)) {
+		if os.Remove(dir) != nil { // not empty
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func moveTo(oldPath, newPath string) {
+	os.MkdirAll(filepath.Dir(newPath), 0776)
+	os.Rename(oldPath, newPath)
+}
+
+// relPath returns slash separated path of file relative to root folder
+func relPath(root, filePath string) string {
+	rel, err := filepath.Rel(root, filePath)
+	if err != nil {
+		return filepath.Base(filePath)
 	}
-	os.Rename(filePath, filepath.Join(h.CFG.Library.STOCK_DIR, filepath.Base(filePath)))
+	return filepath.ToSlash(rel)
 }
 
 // ===============================
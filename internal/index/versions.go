@@ -0,0 +1,64 @@
+package index
+
+import (
+	"github.com/vinser/flibgolite/internal/core/model"
+	"github.com/vinser/flibgolite/internal/hash"
+	"github.com/vinser/flibgolite/internal/store"
+)
+
+// addVersion groups the new book with indexed books of the same authors and similar title and annotation
+// and picks the canonical version of the group by the configured policy
+func (h *Handler) addVersion(tx *store.TX, b *model.Book) error {
+	authorKey, titleKey, plot := hash.AuthorKey(b), hash.Normalize(b.Title), hash.Normalize(b.Plot)
+	minLen, maxLen := hash.VersionTitleLens(titleKey, h.CFG.Database.VERSION_SIMILARITY)
+	candidates, err := tx.VersionCandidates(authorKey, minLen, maxLen)
+	if err != nil {
+		return err
+	}
+	groupID, best := b.ID, h.CFG.Database.VERSION_SIMILARITY
+	for _, c := range candidates {
+		if score := hash.VersionScore(titleKey, plot, c.TitleKey, hash.Normalize(c.Plot)); score >= best {
+			groupID, best = c.GroupID, score
+		}
+	}
+	if err := tx.NewVersion(b.ID, groupID, authorKey, titleKey); err != nil {
+		return err
+	}
+	if groupID == b.ID {
+		return nil
+	}
+	h.LOG.I.Printf("file %s is a version of book %d with similarity %.2f\n", b.File, groupID, best)
+	return h.electVersion(tx, groupID)
+}
+
+// electVersion makes the best version of the group by the configured policy its canonical version
+func (h *Handler) electVersion(tx *store.TX, groupID int64) error {
+	books, err := tx.VersionGroupBooks(groupID)
+	if err != nil || len(books) == 0 {
+		return err
+	}
+	policy := hash.NewVersionPolicy(h.CFG.Database.VERSION_POLICY, h.CFG.Database.VERSION_FORMATS)
+	canonical := books[0]
+	for _, b := range books[1:] {
+		if policy.Better(b, canonical) {
+			canonical = b
+		}
+	}
+	return tx.SetCanonicalVersion(groupID, canonical.ID)
+}
+
+// electOrphanVersions picks canonical versions of groups which canonical books were removed
+func (h *Handler) electOrphanVersions() error {
+	groups := h.DB.OrphanVersionGroups()
+	if len(groups) == 0 {
+		return nil
+	}
+	tx := h.DB.TxBegin()
+	defer tx.TxEnd()
+	for _, g := range groups {
+		if err := h.electVersion(tx, g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
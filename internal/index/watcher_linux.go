@@ -0,0 +1,125 @@
+//go:build linux
+
+package index
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const watchMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_CREATE | syscall.IN_DELETE_SELF
+
+// Watcher reports new acquisitions with Linux inotify as soon as they are completely written
+type Watcher struct {
+	Events  chan string // paths of written files and of created folders
+	Errors  chan error
+	fd      int
+	file    *os.File              // keeps fd in the runtime poller so Close unblocks reading
+	skip    func(dir string) bool // reports whether a folder must not be watched
+	watches map[int32]string      // watch descriptor -> folder
+	mx      sync.Mutex
+}
+
+func NewWatcher(skip func(dir string) bool) (*Watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify init failed: %w", err)
+	}
+	w := &Watcher{
+		Events:  make(chan string, 1024),
+		Errors:  make(chan error, 16),
+		fd:      fd,
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		skip:    skip,
+		watches: make(map[int32]string),
+	}
+	go w.readEvents()
+	return w, nil
+}
+
+// Add watches dir and all its subfolders
+func (w *Watcher) Add(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != dir && w.skip(path) {
+			return filepath.SkipDir
+		}
+		wd, err := syscall.InotifyAddWatch(w.fd, path, watchMask)
+		if err != nil {
+			return fmt.Errorf("failed to watch folder %s: %w", path, err)
+		}
+		w.mx.Lock()
+		w.watches[int32(wd)] = path
+		w.mx.Unlock()
+		return nil
+	})
+}
+
+func (w *Watcher) Close() error {
+	return w.file.Close()
+}
+
+func (w *Watcher) readEvents() {
+	defer close(w.Events)
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				w.sendError(err)
+			}
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			name := string(bytes.TrimRight(buf[nameStart:nameStart+int(event.Len)], "\x00"))
+			offset = nameStart + int(event.Len)
+			if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				w.sendError(fmt.Errorf("inotify event queue overflow, some new acquisitions wait for the next full scan"))
+				continue
+			}
+
+			w.mx.Lock()
+			dir, ok := w.watches[event.Wd]
+			if event.Mask&(syscall.IN_IGNORED|syscall.IN_DELETE_SELF) != 0 {
+				delete(w.watches, event.Wd)
+			}
+			w.mx.Unlock()
+			if !ok || name == "" {
+				continue
+			}
+			path := filepath.Join(dir, name)
+			switch {
+			case event.Mask&syscall.IN_ISDIR != 0 && event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+				if w.skip(path) {
+					continue
+				}
+				if err := w.Add(path); err != nil {
+					w.sendError(err)
+				}
+				w.Events <- path
+			case event.Mask&syscall.IN_ISDIR == 0 && event.Mask&(syscall.IN_CLOSE_WRITE|syscall.IN_MOVED_TO) != 0:
+				w.Events <- path
+			}
+		}
+	}
+}
+
+func (w *Watcher) sendError(err error) {
+	select {
+	case w.Errors <- err:
+	default:
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+
+package index
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Watcher is available on Linux only, other platforms use folder polling
+type Watcher struct {
+	Events chan string
+	Errors chan error
+}
+
+func NewWatcher(skip func(dir string) bool) (*Watcher, error) {
+	return nil, fmt.Errorf("folder watching is not supported on %s", runtime.GOOS)
+}
+
+func (w *Watcher) Add(dir string) error {
+	return nil
+}
+
+func (w *Watcher) Close() error {
+	return nil
+}
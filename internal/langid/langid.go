@@ -0,0 +1,138 @@
+// Package langid identifies the language of a text by its character n-grams.
+// Language profiles are built from the sample texts embedded into the binary, so no network or model files are needed.
+package langid
+
+import (
+	"embed"
+	"math"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+//go:embed samples/*.txt
+var samples embed.FS
+
+const (
+	maxN       = 3    // longest n-gram
+	maxRunes   = 2000 // longer texts are truncated
+	minNGrams  = 10   // shorter texts are not identified
+	smoothing  = 0.5  // additive smoothing of n-gram counts
+	evidenceNG = 60   // number of n-grams taken as evidence, limits confidence of long texts
+	evidenceW  = 0.3  // weight of one n-gram as evidence, n-grams of words overlap and are not independent
+)
+
+type profile struct {
+	code   string
+	counts map[string]float64
+	total  float64
+}
+
+var profiles = loadProfiles()
+
+func loadProfiles() []*profile {
+	entries, err := samples.ReadDir("samples")
+	if err != nil {
+		panic(err)
+	}
+	ps := make([]*profile, 0, len(entries))
+	for _, e := range entries {
+		b, err := samples.ReadFile(path.Join("samples", e.Name()))
+		if err != nil {
+			panic(err)
+		}
+		p := &profile{
+			code:   strings.TrimSuffix(e.Name(), path.Ext(e.Name())),
+			counts: make(map[string]float64),
+		}
+		for _, g := range ngrams(string(b)) {
+			p.counts[g]++
+			p.total++
+		}
+		ps = append(ps, p)
+	}
+	return ps
+}
+
+// Languages returns the codes of languages that can be identified
+func Languages() []string {
+	codes := make([]string, 0, len(profiles))
+	for _, p := range profiles {
+		codes = append(codes, p.code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// Supported reports whether the language with ISO 639-1 code can be identified
+func Supported(code string) bool {
+	for _, p := range profiles {
+		if p.code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Detect returns ISO 639-1 code of the most probable language of the text and its probability from 0 to 1.
+// Empty code is returned for texts too short to be identified
+func Detect(text string) (code string, confidence float64) {
+	grams := ngrams(text)
+	if len(grams) < minNGrams {
+		return "", 0
+	}
+	scores := make([]float64, len(profiles))
+	best := 0
+	for i, p := range profiles {
+		vocabulary := float64(len(p.counts))
+		for _, g := range grams {
+			scores[i] += math.Log((p.counts[g] + smoothing) / (p.total + smoothing*vocabulary))
+		}
+		scores[i] /= float64(len(grams))
+		if scores[i] > scores[best] {
+			best = i
+		}
+	}
+	// mean log-likelihoods are scaled to limited evidence, otherwise long texts always get confidence of 1
+	evidence := float64(min(len(grams), evidenceNG)) * evidenceW
+	sum := 0.0
+	for _, s := range scores {
+		sum += math.Exp((s - scores[best]) * evidence)
+	}
+	return profiles[best].code, 1 / sum
+}
+
+// ngrams returns 1- to maxN-grams of the text words, words are lowercased and padded with spaces
+func ngrams(text string) []string {
+	var grams []string
+	word := make([]rune, 0, 32)
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+		padded := append(append([]rune{' '}, word...), ' ')
+		for n := 1; n <= maxN; n++ {
+			for i := 0; i+n <= len(padded); i++ {
+				if n == 1 && padded[i] == ' ' {
+					continue
+				}
+				grams = append(grams, string(padded[i:i+n]))
+			}
+		}
+		word = word[:0]
+	}
+	runes := 0
+	for _, r := range text {
+		if runes++; runes > maxRunes {
+			break
+		}
+		if unicode.IsLetter(r) {
+			word = append(word, unicode.ToLower(r))
+			continue
+		}
+		flush()
+	}
+	flush()
+	return grams
+}
@@ -0,0 +1,62 @@
+package langid
+
+import "testing"
+
+// texts are not taken from the samples, languages written in Cyrillic are most alike
+var testTexts = []struct {
+	code string
+	text string
+}{
+	{"ru", "Молодой врач приезжает в глухую деревню, чтобы заменить старого доктора, который умер прошлой зимой. Местные жители встречают его с недоверием, а в больнице нет ни лекарств, ни помощников. Но скоро ему приходится спасать тех, кто ещё вчера смеялся над ним."},
+	{"ru", "Сборник рассказов о детстве, прошедшем на берегу северного моря. Отец уходил в море на несколько месяцев, мать работала на почте, а мальчик с друзьями искал клады в заброшенных лодках и мечтал о дальних странах."},
+	{"uk", "Молодий лікар приїздить до глухого села, щоб замінити старого лікаря, який помер минулої зими. Місцеві мешканці зустрічають його з недовірою, а в лікарні немає ні ліків, ні помічників. Та незабаром йому доводиться рятувати тих, хто ще вчора сміявся з нього."},
+	{"uk", "Збірка оповідань про дитинство, що минуло на березі північного моря. Батько йшов у море на кілька місяців, мати працювала на пошті, а хлопчик із друзями шукав скарби в покинутих човнах і мріяв про далекі країни."},
+	{"be", "Малады лекар прыязджае ў глухую вёску, каб замяніць старога доктара, які памёр мінулай зімой. Мясцовыя жыхары сустракаюць яго з недаверам, а ў бальніцы няма ні лекаў, ні памочнікаў. Але хутка яму даводзіцца ратаваць тых, хто яшчэ ўчора смяяўся з яго."},
+	{"be", "Зборнік апавяданняў пра дзяцінства, якое прайшло на беразе паўночнага мора. Бацька сыходзіў у мора на некалькі месяцаў, маці працавала на пошце, а хлопчык з сябрамі шукаў скарбы ў закінутых лодках і марыў пра далёкія краіны."},
+	{"bg", "Млад лекар пристига в затънтено село, за да замени стария доктор, който почина миналата зима. Местните жители го посрещат с недоверие, а в болницата няма нито лекарства, нито помощници. Но скоро му се налага да спасява онези, които още вчера са му се смели."},
+	{"bg", "Сборник с разкази за детството, прекарано на брега на северно море. Бащата излизаше в морето за няколко месеца, майката работеше в пощата, а момчето и приятелите му търсеха съкровища в изоставените лодки и мечтаеха за далечни страни."},
+	{"sr", "Млади лекар долази у забачено село да замени старог доктора, који је умро прошле зиме. Мештани га дочекују с неповерењем, а у болници нема ни лекова ни помоћника. Али ускоро мора да спасава оне који су му се још јуче смејали."},
+	{"sr", "Збирка приповедака о детињству проведеном на обали северног мора. Отац је одлазио на море на неколико месеци, мајка је радила у пошти, а дечак је са друговима тражио благо у напуштеним чамцима и сањао о далеким земљама."},
+	{"en", "A young doctor comes to a remote village to replace the old one who died last winter. The villagers meet him with distrust, and the hospital has neither medicine nor assistants."},
+	{"de", "Ein junger Arzt kommt in ein abgelegenes Dorf, um den alten Doktor zu ersetzen, der im letzten Winter gestorben ist. Die Dorfbewohner begegnen ihm mit Misstrauen."},
+	{"pl", "Młody lekarz przyjeżdża do zapadłej wsi, aby zastąpić starego doktora, który zmarł zeszłej zimy. Mieszkańcy przyjmują go z nieufnością, a w szpitalu nie ma ani leków, ani pomocników."},
+}
+
+func TestDetect(t *testing.T) {
+	for _, tt := range testTexts {
+		code, confidence := Detect(tt.text)
+		if code != tt.code || confidence < 0.8 {
+			t.Errorf("Expecting %s with confidence 0.8 at least, got: %s %.2f for %.40q", tt.code, code, confidence, tt.text)
+		}
+	}
+
+	if code, confidence := Detect("Я"); code != "" || confidence != 0 {
+		t.Errorf("Expecting short text not identified, got: %s %.2f", code, confidence)
+	}
+}
+
+// short titles of words common to several languages must not be taken for other language
+var testTitles = []struct {
+	code string
+	text string
+}{
+	{"ru", "Война и мир"},
+	{"ru", "Тихий Дон"},
+	{"ru", "Мастер и Маргарита. Роман о любви и дьяволе"},
+	{"uk", "Кобзар"},
+	{"uk", "Лісова пісня. Драма-феєрія в трьох діях"},
+	{"be", "Новая зямля"},
+	{"be", "Людзі на балоце. Раман пра жыццё палескай вёскі"},
+	{"bg", "Под игото"},
+	{"bg", "Преселение. Разказ за живота на село"},
+	{"sr", "На Дрини ћуприја"},
+	{"sr", "Проклета авлија. Роман о затворској авлији у Цариграду"},
+}
+
+func TestDetectTitle(t *testing.T) {
+	for _, tt := range testTitles {
+		if code, confidence := Detect(tt.text); code != tt.code && confidence >= 0.8 {
+			t.Errorf("Expecting %s or confidence less than 0.8, got: %s %.2f for %q", tt.code, code, confidence, tt.text)
+		}
+	}
+}
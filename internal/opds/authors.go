@@ -10,6 +10,7 @@ import (
 	"unicode/utf8"
 
 	"github.com/vinser/flibgolite/internal/core/model"
+	"github.com/vinser/flibgolite/internal/parsers"
 
 	_ "image/gif"
 	_ "image/png"
@@ -121,7 +122,7 @@ func (h *Handler) listAuthors(w http.ResponseWriter, r *http.Request) {
 			}
 			f.Entry = append(f.Entry, entry)
 		}
-		writeFeed(w, http.StatusOK, *f)
+		h.writeFeed(w, http.StatusOK, *f)
 	default:
 		for _, author := range authors {
 			entry := &Entry{
@@ -140,7 +141,7 @@ func (h *Handler) listAuthors(w http.ResponseWriter, r *http.Request) {
 		}
 		addNotSpecLink()
 		addAllAuthorsLinks()
-		writeFeed(w, http.StatusOK, *f)
+		h.writeFeed(w, http.StatusOK, *f)
 	}
 }
 
@@ -185,7 +186,7 @@ func (h *Handler) authorAnthology(w http.ResponseWriter, r *http.Request) {
 				},
 			},
 		}
-		writeFeed(w, http.StatusOK, *f)
+		h.writeFeed(w, http.StatusOK, *f)
 	} else { // Author doesn't have book series
 		h.authorBooks(w, r)
 	}
@@ -211,7 +212,7 @@ func (h *Handler) authorAnthologySeries(w http.ResponseWriter, r *http.Request)
 		}
 		f.Entry = append(f.Entry, entry)
 	}
-	writeFeed(w, http.StatusOK, *f)
+	h.writeFeed(w, http.StatusOK, *f)
 }
 
 func (h *Handler) authorBooks(w http.ResponseWriter, r *http.Request) {
@@ -236,11 +237,11 @@ func (h *Handler) authorBooks(w http.ResponseWriter, r *http.Request) {
 	}
 
 	h.feedBookEntries(r, books, f)
-	writeFeed(w, http.StatusOK, *f)
+	h.writeFeed(w, http.StatusOK, *f)
 }
 
 func (h *Handler) fixIfNoSpecAuthorName(author *model.Author, lang string) *model.Author {
-	if author.Sort == "[author not specified]" || author.Name == "[author not specified]" {
+	if author.Sort == parsers.NO_AUTHOR || author.Name == parsers.NO_AUTHOR {
 		author.Name = h.MP[lang].Sprintf("~Author not specified")
 		author.Sort = h.MP[lang].Sprintf("~Author not specified")
 	}
@@ -2,10 +2,13 @@ package opds
 
 import (
 	"archive/zip"
+	"bytes"
+	"errors"
 	"fmt"
 	"image"
 	"image/jpeg"
 	"io"
+	"io/fs"
 	"math"
 	"mime"
 	"net/http"
@@ -19,9 +22,9 @@ import (
 	"github.com/nfnt/resize"
 	cfb2 "github.com/vinser/flibgolite/internal/converter/fb2"
 	"github.com/vinser/flibgolite/internal/core/model"
+	"github.com/vinser/flibgolite/internal/covers"
 	"github.com/vinser/flibgolite/internal/parsers"
-	"github.com/vinser/flibgolite/internal/parsers/epub"
-	"github.com/vinser/flibgolite/internal/parsers/fb2"
+	"github.com/vinser/flibgolite/internal/parsers/cbz"
 	"github.com/vinser/u8xml"
 
 	"github.com/mozillazg/go-unidecode"
@@ -72,11 +75,11 @@ func (h *Handler) latest(w http.ResponseWriter, r *http.Request) {
 		}
 
 		h.feedBookEntries(r, books, f)
-		writeFeed(w, http.StatusOK, *f)
+		h.writeFeed(w, http.StatusOK, *f)
 	default:
 		selfHref = fmt.Sprintf("/opds/latest?language=%s", lang)
 		f := NewFeed(h.MP[lang].Sprintf("Nothing new"), "", selfHref)
-		writeFeed(w, http.StatusOK, *f)
+		h.writeFeed(w, http.StatusOK, *f)
 	}
 }
 
@@ -84,15 +87,34 @@ func (h *Handler) latest(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) books(w http.ResponseWriter, r *http.Request) {
 	switch {
 	default:
+	case r.FormValue("versions") != "":
+		h.bookVersions(w, r)
 	case r.FormValue("id") != "":
 		h.unloadBook(w, r)
 		h.LOG.D.Println("UnloadBook")
 	}
 }
 
+// bookVersions lists all versions of the book
+func (h *Handler) bookVersions(w http.ResponseWriter, r *http.Request) {
+	lang := h.getLanguage(r)
+	h.LOG.D.Println(commentURL("Book versions", r))
+	bookId, _ := strconv.ParseInt(r.FormValue("versions"), 10, 64)
+	books := h.DB.ListBookVersions(bookId)
+	if len(books) == 0 {
+		writeMessage(w, http.StatusNotFound, h.MP[lang].Sprintf("Book not found"))
+		return
+	}
+	selfHref := fmt.Sprintf("/opds/books?language=%s&versions=%d", lang, bookId)
+	f := NewFeed(h.MP[lang].Sprintf("Book versions - %d", len(books)), "", selfHref)
+	h.feedBookEntries(r, books, f)
+	h.writeFeed(w, http.StatusOK, *f)
+}
+
 func (h *Handler) feedBookEntries(r *http.Request, books []*model.Book, f *Feed) {
 	lang := h.getLanguage(r)
 	for _, book := range books {
+		h.DB.LoadBookPublication(book)
 		var authorsList []Author
 		var authorsLinks []Link
 		authors := h.DB.AuthorsByBookId(book.ID)
@@ -112,8 +134,27 @@ func (h *Handler) feedBookEntries(r *http.Request, books []*model.Book, f *Feed)
 			authorsLinks = append(authorsLinks, authorLink)
 		}
 
+		var contributorsList []Author
+		book.Contributors = h.DB.ContributorsByBookID(book.ID)
+		for _, c := range book.Contributors {
+			contributor := Author{
+				Name: c.Name,
+			}
+			if c.Role == model.TranslatorRole {
+				contributor.Uri = fmt.Sprintf("/opds/translators?language=%s&id=%d&page=1", lang, c.ID)
+				authorsLinks = append(authorsLinks, Link{
+					Title: fmt.Sprintf("%s - %s", h.MP[lang].Sprintf("~All translator books"), c.Name),
+					Rel:   FeedRelatedLinkRel,
+					Href:  contributor.Uri,
+					Type:  FeedNavigationLinkType,
+				})
+			}
+			contributorsList = append(contributorsList, contributor)
+		}
+
 		links := append(authorsLinks, h.acquisitionLinks(book)...)
-		if serie := h.DB.SerieByBookID(book.ID); serie != nil {
+		book.Series = h.DB.BookSeries(book.ID)
+		for _, serie := range book.Series {
 			serieLink := Link{
 				Title: fmt.Sprintf("%s - %s", h.MP[lang].Sprintf("~All serie books"), serie.Name),
 				Rel:   FeedRelatedLinkRel,
@@ -122,6 +163,15 @@ func (h *Handler) feedBookEntries(r *http.Request, books []*model.Book, f *Feed)
 			}
 			links = append(links, serieLink)
 		}
+		if vc := h.DB.CountBookVersions(book.ID); vc > 1 {
+			versionsLink := Link{
+				Title: fmt.Sprintf("%s - %d", h.MP[lang].Sprintf("~All book versions"), vc),
+				Rel:   FeedRelatedLinkRel,
+				Href:  fmt.Sprintf("/opds/books?language=%s&versions=%d", lang, book.ID),
+				Type:  FeedAcquisitionLinkType,
+			}
+			links = append(links, versionsLink)
+		}
 
 		bookLang := ""
 		if book.Language != nil && book.Language.Code != "" {
@@ -134,13 +184,17 @@ func (h *Handler) feedBookEntries(r *http.Request, books []*model.Book, f *Feed)
 		}
 
 		entry := &Entry{
-			Title:      book.Title,
-			ID:         fmt.Sprintf("/opds/books/id=%d", book.ID),
-			Updated:    f.Time(time.Now()),
-			Links:      links,
-			Authors:    authorsList,
-			DcLanguage: bookLang,
-			DcIssued:   bookYear,
+			Title:        book.Title,
+			ID:           fmt.Sprintf("/opds/books/id=%d", book.ID),
+			Updated:      f.Time(time.Now()),
+			Links:        links,
+			Authors:      authorsList,
+			Contributors: contributorsList,
+			DcLanguage:   bookLang,
+			DcIssued:     bookYear,
+			DcPublisher:  book.Publisher,
+			DcIdentifier: isbnURNs(book.ISBN),
+			DcSource:     bookSource(book),
 			Content: &Content{
 				Type:    FeedTextHtmlContentType,
 				Content: h.contentInfo(r, book),
@@ -150,6 +204,28 @@ func (h *Handler) feedBookEntries(r *http.Request, books []*model.Book, f *Feed)
 	}
 }
 
+// isbnURNs returns book ISBNs as URNs for dc:identifier
+func isbnURNs(isbns string) []string {
+	urns := []string{}
+	for _, isbn := range strings.Split(isbns, ",") {
+		if isbn = strings.TrimSpace(isbn); isbn != "" {
+			urns = append(urns, "urn:isbn:"+isbn)
+		}
+	}
+	return urns
+}
+
+// bookSource describes the original of translated book for dc:source, e.g. "War and Peace (ru)"
+func bookSource(b *model.Book) string {
+	switch {
+	case b.SrcTitle != "" && b.SrcLang != "":
+		return fmt.Sprintf("%s (%s)", b.SrcTitle, b.SrcLang)
+	case b.SrcTitle != "":
+		return b.SrcTitle
+	}
+	return b.SrcLang
+}
+
 func (h *Handler) acquisitionLinks(book *model.Book) []Link {
 	rel := "http://opds-spec.org/acquisition/open-access"
 	link := []Link{}
@@ -167,6 +243,26 @@ func (h *Handler) acquisitionLinks(book *model.Book) []Link {
 		} else {
 			link = append(link, linkFunc("epub"), linkFunc("zip"))
 		}
+	case "cbz":
+		link = append(link,
+			Link{
+				Rel:  rel,
+				Href: fmt.Sprintf("/opds/books?id=%d", book.ID),
+				Type: mime.TypeByExtension("." + book.Format),
+			},
+		)
+		count := h.bookPages(book)
+		if count == 0 {
+			break
+		}
+		link = append(link,
+			Link{
+				Rel:      "http://vaemendis.net/opds-pse/stream",
+				Href:     fmt.Sprintf("/opds/pages?id=%d&page={pageNumber}&maxWidth={maxWidth}", book.ID),
+				Type:     "image/jpeg",
+				PseCount: strconv.Itoa(count),
+			},
+		)
 	default:
 		link = append(link,
 			Link{
@@ -182,14 +278,14 @@ func (h *Handler) acquisitionLinks(book *model.Book) []Link {
 			Link{
 				Rel:  "http://opds-spec.org/image",
 				Href: fmt.Sprintf("/opds/covers?cover=%d", book.ID),
-				Type: mime.TypeByExtension(path.Ext(book.Cover)),
+				Type: "image/jpeg",
 			},
 		)
 		link = append(link,
 			Link{
 				Rel:  "http://opds-spec.org/image/thumbnail",
 				Href: fmt.Sprintf("/opds/covers?thumbnail=%d", book.ID),
-				Type: mime.TypeByExtension(path.Ext(book.Cover)),
+				Type: "image/jpeg",
 			},
 		)
 	}
@@ -204,18 +300,11 @@ func (h *Handler) unloadBook(w http.ResponseWriter, r *http.Request) {
 		writeMessage(w, http.StatusNotFound, h.MP[lang].Sprintf("Book not found"))
 		return
 	}
-	var rc io.ReadCloser
-	if book.Archive == "" {
-		rc, _ = os.Open(path.Join(h.CFG.Library.STOCK_DIR, book.File))
-	} else {
-		zr, _ := zip.OpenReader(path.Join(h.CFG.Library.STOCK_DIR, book.Archive))
-		defer zr.Close()
-		for _, file := range zr.File {
-			if file.Name == book.File {
-				rc, _ = file.Open()
-				break
-			}
-		}
+	rc, err := parsers.OpenBook(h.stockDir(book), book)
+	if err != nil {
+		h.LOG.E.Println(err)
+		writeMessage(w, http.StatusNotFound, h.MP[lang].Sprintf("Book not found"))
+		return
 	}
 	defer rc.Close()
 
@@ -261,7 +350,7 @@ func (h *Handler) unloadBook(w http.ResponseWriter, r *http.Request) {
 		defer zipWriter.Close()
 		fileWriter, _ := zipWriter.CreateHeader(
 			&zip.FileHeader{
-				Name:   book.File,
+				Name:   path.Base(book.File),
 				Method: zip.Deflate,
 			},
 		)
@@ -320,54 +409,143 @@ func (h *Handler) covers(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handler) unloadCover(w http.ResponseWriter, r *http.Request) {
 	bookId, _ := strconv.ParseInt(r.FormValue("cover"), 10, 64)
-	img := h.getCoverImage(bookId)
-	if img == nil {
-		return
-	}
-	w.Header().Add("Content-Disposition", "attachment; filename=cover.jpg")
-	w.Header().Add("Content-Type", "image/jpeg")
-	jpeg.Encode(w, img, nil)
+	h.unloadCoverImage(w, r, bookId, 0, "cover.jpg")
 }
 
+// GET /opds/covers?thumbnail=<id>&width=<pixels> - the thumbnail of the nearest configured width, the first one by default
 func (h *Handler) unloadThumbnail(w http.ResponseWriter, r *http.Request) {
 	bookId, _ := strconv.ParseInt(r.FormValue("thumbnail"), 10, 64)
-	img := h.getCoverImage(bookId)
-	if img == nil {
-		return
+	width, _ := strconv.Atoi(r.FormValue("width"))
+	size := covers.DEFAULT_THUMBNAIL_SIZE
+	if h.Covers != nil {
+		size = covers.ThumbnailSize(h.Covers.Sizes, width)
 	}
-	img = resize.Resize(100, 0, img, resize.NearestNeighbor)
-	// img = imaging.Resize(img, 100, 0, imaging.NearestNeighbor)
-	w.Header().Add("Content-Disposition", "attachment; filename=thumbnail.jpg")
-	w.Header().Add("Content-Type", "image/jpeg")
-	jpeg.Encode(w, img, nil)
+	h.unloadCoverImage(w, r, bookId, size, "thumbnail.jpg")
 }
 
-func (h *Handler) getCoverImage(bookId int64) (img image.Image) {
+// unloadCoverImage writes the cached cover or its thumbnail if size > 0, cache miss is filled from the book file.
+// Without cache the cover is extracted from the book file every time
+func (h *Handler) unloadCoverImage(w http.ResponseWriter, r *http.Request, bookId int64, size int, fileName string) {
 	book := h.DB.FindBookById(bookId)
 	if book == nil {
-		return nil
+		writeMessage(w, http.StatusNotFound, h.MP[h.getLanguage(r)].Sprintf("Book not found"))
+		return
 	}
-	if book.Cover == "" {
-		return nil
+	if h.Covers == nil {
+		img := h.getCoverImage(book)
+		if img == nil {
+			return
+		}
+		if size > 0 {
+			img = covers.Thumbnail(img, size)
+		}
+		w.Header().Add("Content-Disposition", "attachment; filename="+fileName)
+		w.Header().Add("Content-Type", "image/jpeg")
+		jpeg.Encode(w, img, nil)
+		return
 	}
+	cache := h.Covers.ForIndex(h.DB.CoversID())
+	name := cache.Path(bookId, size)
+	f, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		img := h.getCoverImage(book)
+		if img == nil {
+			return
+		}
+		if err := cache.Put(bookId, img); err != nil {
+			h.LOG.E.Printf("cover of book %d was not cached: %v\n", bookId, err)
+			return
+		}
+		f, err = os.Open(name)
+	}
+	if err != nil {
+		h.LOG.E.Println(err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		h.LOG.E.Println(err)
+		return
+	}
+	w.Header().Add("Content-Disposition", "attachment; filename="+fileName)
+	w.Header().Add("Content-Type", "image/jpeg")
+	http.ServeContent(w, r, fileName, info.ModTime(), f)
+}
 
-	switch book.Format {
-	case "fb2":
-		img, err := fb2.GetCoverImage(h.CFG.Library.STOCK_DIR, book)
+// Pages of image-based books for OPDS Page Streaming Extension
+func (h *Handler) pages(w http.ResponseWriter, r *http.Request) {
+	h.LOG.D.Println(commentURL("Page", r))
+	lang := h.getLanguage(r)
+	bookId, _ := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	book := h.DB.FindBookById(bookId)
+	if book == nil || book.Format != "cbz" {
+		writeMessage(w, http.StatusNotFound, h.MP[lang].Sprintf("Book not found"))
+		return
+	}
+	page, err := strconv.Atoi(r.FormValue("page"))
+	if err != nil {
+		writeMessage(w, http.StatusBadRequest, "Bad request")
+		return
+	}
+	rc, ext, err := cbz.OpenPage(h.stockDir(book), book, page)
+	if err != nil {
+		h.LOG.D.Print(err)
+		writeMessage(w, http.StatusNotFound, "Page not found")
+		return
+	}
+	defer rc.Close()
+	var data io.Reader = rc
+	maxWidth, _ := strconv.Atoi(r.FormValue("maxWidth"))
+	if maxWidth > 0 {
+		b, err := io.ReadAll(rc)
 		if err != nil {
 			h.LOG.D.Print(err)
-			return nil
+			writeMessage(w, http.StatusNotFound, "Page not found")
+			return
 		}
-		return img
-	case "epub":
-		img, err := epub.GetCoverImage(h.CFG.Library.STOCK_DIR, book)
+		img, _, err := image.Decode(bytes.NewReader(b))
 		if err != nil {
 			h.LOG.D.Print(err)
-			return nil
+		} else if img.Bounds().Dx() > maxWidth {
+			img = resize.Resize(uint(maxWidth), 0, img, resize.Lanczos3)
+			w.Header().Add("Content-Type", "image/jpeg")
+			jpeg.Encode(w, img, nil)
+			return
 		}
-		return img
+		data = bytes.NewReader(b)
 	}
-	return nil
+	w.Header().Add("Content-Type", mime.TypeByExtension(ext))
+	io.Copy(w, data)
+}
+
+// bookPages returns the number of comics page images, pages of comics indexed before they were counted are counted once
+func (h *Handler) bookPages(book *model.Book) int {
+	pages := h.DB.BookPages(book.ID)
+	if pages > 0 {
+		return pages
+	}
+	pages, err := cbz.PageCount(h.stockDir(book), book)
+	if err != nil {
+		h.LOG.D.Print(err)
+		return 0
+	}
+	if err := h.DB.SetBookPages(book.ID, pages); err != nil {
+		h.LOG.D.Print(err)
+	}
+	return pages
+}
+
+func (h *Handler) getCoverImage(book *model.Book) image.Image {
+	if book.Cover == "" {
+		return nil
+	}
+	img, err := covers.Image(h.stockDir(book), book)
+	if err != nil {
+		h.LOG.D.Print(err)
+		return nil
+	}
+	return img
 }
 
 func (h *Handler) ConvertFb2Epub(w io.WriteCloser, r io.ReadSeekCloser, b int64) error {
@@ -398,16 +576,49 @@ func (h *Handler) contentInfo(r *http.Request, b *model.Book) (info string) {
 	if b.Year != "0" {
 		info += fmt.Sprintf("<br/>%s: %s", h.MP[lang].Sprintf("Year"), b.Year)
 	}
+	if b.Publisher != "" {
+		info += fmt.Sprintf("<br/>%s: %s", h.MP[lang].Sprintf("Publisher"), b.Publisher)
+		if b.City != "" {
+			info += ", " + b.City
+		}
+	}
+	if b.ISBN != "" {
+		info += fmt.Sprintf("<br/>ISBN: %s", b.ISBN)
+	}
+	for _, role := range []struct{ role, label string }{
+		{model.TranslatorRole, "Translator"},
+		{model.IllustratorRole, "Illustrator"},
+		{model.EditorRole, "Editor"},
+	} {
+		names := []string{}
+		for _, c := range b.Contributors {
+			if c.Role == role.role {
+				names = append(names, c.Name)
+			}
+		}
+		if len(names) > 0 {
+			info += fmt.Sprintf("<br/>%s: %s", h.MP[lang].Sprintf(role.label), strings.Join(names, ", "))
+		}
+	}
+	if source := bookSource(b); source != "" {
+		info += fmt.Sprintf("<br/>%s: %s", h.MP[lang].Sprintf("Original"), source)
+	}
 	if b.Archive != "" {
 		info += fmt.Sprintf("<br/>%s: %s", h.MP[lang].Sprintf("Archive"), b.Archive)
 	}
 	info += fmt.Sprintf("<br/>%s: %s", h.MP[lang].Sprintf("File"), b.File)
 	info += fmt.Sprintf("<br/>%s: %d Kb", h.MP[lang].Sprintf("Size"), int(float32(b.Size)/1024))
-	if b.Serie.Name != "" {
-		info += fmt.Sprintf("<br/>%s: %s", h.MP[lang].Sprintf("Serie"), b.Serie.Name)
-		if b.SerieNum > 0 {
-			info += fmt.Sprintf(" #%d", b.SerieNum)
+	for _, s := range b.Series {
+		label := "Serie"
+		if s.Role == model.PublisherSerie {
+			label = "Publisher serie"
+		}
+		info += fmt.Sprintf("<br/>%s: %s", h.MP[lang].Sprintf(label), s.Name)
+		if s.Number != "" {
+			info += fmt.Sprintf(" #%s", s.Number)
 		}
+	}
+	if len(b.Series) > 0 {
 		info += "<br/>"
 	}
 	return info + "</div>"
@@ -41,6 +41,7 @@ type Feed struct {
 	XmlnsDC      string   `xml:"xmlns:dc,attr,omitempty"`
 	XmlnsOS      string   `xml:"xmlns:os,attr,omitempty"`
 	XmlnsOPDS    string   `xml:"xmlns:opds,attr,omitempty"`
+	XmlnsPSE     string   `xml:"xmlns:pse,attr,omitempty"`
 	Title        string   `xml:"title"`
 	ID           string   `xml:"id"`
 	Updated      TimeStr  `xml:"updated"`
@@ -58,19 +59,23 @@ type Feed struct {
 type Entry struct {
 	// XMLName   xml.Name `xml:"entry"`
 	// Xmlns     string   `xml:"xmlns,attr,omitempty"`
-	Title      string   `xml:"title"`
-	ID         string   `xml:"id"`
-	Links      []Link   `xml:"link"`
-	Published  string   `xml:"published,omitempty"`
-	Updated    TimeStr  `xml:"updated"`
-	Category   string   `xml:"category,omitempty"`
-	Authors    []Author `xml:"author"`
-	DcLanguage string   `xml:"dc:language,omitempty"`
-	DcIssued   string   `xml:"dc:issued,omitempty"`
-	Summary    *Summary `xml:"summary"`
-	Content    *Content `xml:"content"`
-	Rights     string   `xml:"rights,omitempty"`
-	Source     string   `xml:"source,omitempty"`
+	Title        string   `xml:"title"`
+	ID           string   `xml:"id"`
+	Links        []Link   `xml:"link"`
+	Published    string   `xml:"published,omitempty"`
+	Updated      TimeStr  `xml:"updated"`
+	Category     string   `xml:"category,omitempty"`
+	Authors      []Author `xml:"author"`
+	Contributors []Author `xml:"contributor"`
+	DcLanguage   string   `xml:"dc:language,omitempty"`
+	DcIssued     string   `xml:"dc:issued,omitempty"`
+	DcPublisher  string   `xml:"dc:publisher,omitempty"`
+	DcIdentifier []string `xml:"dc:identifier,omitempty"`
+	DcSource     string   `xml:"dc:source,omitempty"`
+	Summary      *Summary `xml:"summary"`
+	Content      *Content `xml:"content"`
+	Rights       string   `xml:"rights,omitempty"`
+	Source       string   `xml:"source,omitempty"`
 }
 
 type Link struct {
@@ -80,6 +85,8 @@ type Link struct {
 	Href   string `xml:"href,attr"`
 	Rel    string `xml:"rel,attr,omitempty"`
 	Length string `xml:"length,attr,omitempty"`
+	// OPDS Page Streaming Extension page count
+	PseCount string `xml:"pse:count,attr,omitempty"`
 }
 
 type Author struct {
@@ -118,6 +125,7 @@ func NewFeed(title, subtitle, self string) *Feed {
 		XmlnsDC:   "http://purl.org/dc/terms/",
 		XmlnsOS:   "http://a9.com/-/spec/opensearch/1.1/",
 		XmlnsOPDS: "http://opds-spec.org/2010/catalog",
+		XmlnsPSE:  "http://vaemendis.net/opds-pse/ns",
 		Title:     title,
 		Icon:      "/favicon.ico",
 		ID:        idReplace.ReplaceAllString(self, "/"),
@@ -136,7 +144,15 @@ func commentURL(comment string, r *http.Request) string {
 	return fmt.Sprintf("%s --->URL: [%s]", comment, qu)
 }
 
-func writeFeed(w http.ResponseWriter, statusCode int, f Feed) {
+func (h *Handler) writeFeed(w http.ResponseWriter, statusCode int, f Feed) {
+	for i := range f.Link {
+		f.Link[i].Href = h.libraryHref(f.Link[i].Href)
+	}
+	for _, e := range f.Entry {
+		for i := range e.Links {
+			e.Links[i].Href = h.libraryHref(e.Links[i].Href)
+		}
+	}
 	data, err := xml.MarshalIndent(f, "", "  ")
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
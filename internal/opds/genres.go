@@ -56,7 +56,7 @@ func (h *Handler) listGenres(w http.ResponseWriter, r *http.Request) {
 		}
 		f.Entry = append(f.Entry, entry)
 	}
-	writeFeed(w, http.StatusOK, *f)
+	h.writeFeed(w, http.StatusOK, *f)
 }
 
 func (h *Handler) listSubgenres(w http.ResponseWriter, r *http.Request) {
@@ -86,7 +86,7 @@ func (h *Handler) listSubgenres(w http.ResponseWriter, r *http.Request) {
 		}
 		f.Entry = append(f.Entry, entry)
 	}
-	writeFeed(w, http.StatusOK, *f)
+	h.writeFeed(w, http.StatusOK, *f)
 }
 
 func (h *Handler) genreBooks(w http.ResponseWriter, r *http.Request) {
@@ -125,5 +125,5 @@ func (h *Handler) genreBooks(w http.ResponseWriter, r *http.Request) {
 	}
 
 	h.feedBookEntries(r, books, f)
-	writeFeed(w, http.StatusOK, *f)
+	h.writeFeed(w, http.StatusOK, *f)
 }
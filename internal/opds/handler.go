@@ -4,9 +4,12 @@ import (
 	"io"
 	"mime"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/vinser/flibgolite/internal/core/config"
+	"github.com/vinser/flibgolite/internal/core/model"
+	"github.com/vinser/flibgolite/internal/covers"
 	"github.com/vinser/flibgolite/internal/genres"
 	"github.com/vinser/flibgolite/internal/rlog"
 	"github.com/vinser/flibgolite/internal/store"
@@ -21,10 +24,16 @@ type Handler struct {
 	DB  *store.DB
 	GT  *genres.GenresTree
 	MP  map[string]*message.Printer
+
+	Covers *covers.Cache // nil if covers are not cached
+
+	lib string // name of the library the request is scoped to, empty for the only library or all libraries
 }
 
 func init() {
 	_ = mime.AddExtensionType(".mobi", "application/x-mobipocket-ebook")
+	_ = mime.AddExtensionType(".azw", "application/vnd.amazon.ebook")
+	_ = mime.AddExtensionType(".azw3", "application/x-mobi8-ebook")
 	_ = mime.AddExtensionType(".epub", "application/epub+zip")
 	_ = mime.AddExtensionType(".cbz", "application/x-cbz")
 	_ = mime.AddExtensionType(".cbr", "application/x-cbr")
@@ -36,6 +45,11 @@ func init() {
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.LOG.I.Println(commentURL("Router", r))
+	h, ok := h.forLibrary(r.FormValue("lib"))
+	if !ok {
+		writeMessage(w, http.StatusNotFound, "Library not found")
+		return
+	}
 	// switch r.URL.Path {
 	switch strings.ReplaceAll(r.URL.Path, "//", "/") { // compensate PocketBook Reader search query error
 	case "/favicon.ico":
@@ -56,10 +70,16 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.genres(w, r)
 	case "/opds/series":
 		h.series(w, r)
+	case "/opds/translators":
+		h.translators(w, r)
 	case "/opds/books":
 		h.books(w, r)
 	case "/opds/covers":
 		h.covers(w, r)
+	case "/opds/pages":
+		h.pages(w, r)
+	case "/opds/ingest":
+		h.ingest(w, r)
 	default:
 		w.WriteHeader(http.StatusBadRequest)
 		io.WriteString(w, `{"error": "Bad request"}`)
@@ -67,6 +87,42 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// forLibrary returns the copy of handler which feeds and searches are scoped to the library with the name.
+// The only library is always chosen, if there are several libraries and none is chosen the books of all are served
+func (h *Handler) forLibrary(name string) (*Handler, bool) {
+	rh := *h
+	switch {
+	case len(h.CFG.Libraries) == 1:
+		rh.DB = h.DB.ForLibrary(h.CFG.Libraries[0].ID)
+	case name != "":
+		lib, ok := h.CFG.LibraryByName(name)
+		if !ok {
+			return nil, false
+		}
+		rh.CFG = h.CFG.ForLibrary(lib)
+		rh.DB = h.DB.ForLibrary(lib.ID)
+		rh.lib = lib.NAME
+	}
+	return &rh, true
+}
+
+// libraryHref adds the library the request is scoped to to OPDS link
+func (h *Handler) libraryHref(href string) string {
+	if h.lib == "" || !strings.HasPrefix(href, "/opds") {
+		return href
+	}
+	sep := "?"
+	if strings.Contains(href, "?") {
+		sep = "&"
+	}
+	return href + sep + "lib=" + url.QueryEscape(h.lib)
+}
+
+// stockDir returns the stock folder of the book library
+func (h *Handler) stockDir(book *model.Book) string {
+	return h.CFG.LibraryByID(book.Library).STOCK_DIR
+}
+
 func (h *Handler) getLanguage(r *http.Request) string {
 	lang := r.FormValue("language")
 	if lang == "" {
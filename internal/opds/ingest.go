@@ -0,0 +1,140 @@
+package opds
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vinser/flibgolite/internal/core/model"
+	"github.com/vinser/flibgolite/internal/hash"
+)
+
+// ingestItem is the JSON view of ingest status record
+type ingestItem struct {
+	File    string    `json:"file"`
+	Archive string    `json:"archive,omitempty"`
+	State   string    `json:"state"`
+	Error   string    `json:"error,omitempty"`
+	Updated time.Time `json:"updated"`
+}
+
+// Ingest status administration feed of rejected files
+// state=<state name> filters records by state, format=json returns JSON instead of OPDS feed
+func (h *Handler) ingest(w http.ResponseWriter, r *http.Request) {
+	h.LOG.D.Println(commentURL("Ingest", r))
+	if !h.CFG.OPDS.ADMIN {
+		writeMessage(w, http.StatusForbidden, "Administration feeds are disabled")
+		return
+	}
+	state, err := hash.ParseState(r.FormValue("state"))
+	if err != nil {
+		writeMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, err := strconv.Atoi(r.FormValue("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	count := h.DB.IngestStatusCount(state)
+	statuses, err := h.DB.IngestStatuses(state, h.CFG.OPDS.PAGE_SIZE, (page-1)*h.CFG.OPDS.PAGE_SIZE)
+	if err != nil {
+		h.LOG.E.Println(err)
+		writeMessage(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	if r.FormValue("format") == "json" {
+		items := make([]ingestItem, 0, len(statuses))
+		for _, s := range statuses {
+			items = append(items, newIngestItem(s))
+		}
+		data, err := json.MarshalIndent(map[string]any{"state": state.String(), "count": count, "page": page, "items": items}, "", "  ")
+		if err != nil {
+			writeMessage(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		w.Header().Add("Content-Type", "application/json;charset=utf-8")
+		writeMessage(w, http.StatusOK, string(data))
+		return
+	}
+
+	lang := h.getLanguage(r)
+	if r.FormValue("state") == "" {
+		h.ingestStates(w, lang)
+		return
+	}
+	selfHref := fmt.Sprintf("/opds/ingest?language=%s&state=%s&page=%d", lang, state, page)
+	f := NewFeed(h.MP[lang].Sprintf("Rejected files: %s - %d", state, count), "", selfHref)
+	if int64(page*h.CFG.OPDS.PAGE_SIZE) < count {
+		nextRef := fmt.Sprintf("/opds/ingest?language=%s&state=%s&page=%d", lang, state, page+1)
+		f.Link = append(f.Link, Link{Rel: FeedNextLinkRel, Href: nextRef, Type: FeedNavigationLinkType})
+	}
+	if page > 1 {
+		prevRef := fmt.Sprintf("/opds/ingest?language=%s&state=%s&page=%d", lang, state, page-1)
+		f.Link = append(f.Link, Link{Rel: FeedPrevLinkRel, Href: prevRef, Type: FeedNavigationLinkType})
+	}
+	for _, s := range statuses {
+		item := newIngestItem(s)
+		title := item.File
+		if item.Archive != "" {
+			title = item.Archive + ": " + item.File
+		}
+		content := item.State
+		if item.Error != "" {
+			content += ": " + item.Error
+		}
+		f.Entry = append(f.Entry, &Entry{
+			Title:   title,
+			ID:      fmt.Sprintf("/opds/ingest/%d", s.ID),
+			Updated: f.Time(item.Updated),
+			Content: &Content{
+				Type:    FeedTextContentType,
+				Content: content,
+			},
+		})
+	}
+	h.writeFeed(w, http.StatusOK, *f)
+}
+
+// ingestStates lists states of rejected files with their numbers
+func (h *Handler) ingestStates(w http.ResponseWriter, lang string) {
+	counts, err := h.DB.IngestStateCounts()
+	if err != nil {
+		h.LOG.E.Println(err)
+		writeMessage(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	f := NewFeed(h.MP[lang].Sprintf("Rejected files"), "", "/opds/ingest?language="+lang)
+	for _, name := range hash.StateNames() {
+		state, _ := hash.ParseState(name)
+		f.Entry = append(f.Entry, &Entry{
+			Title:   name,
+			ID:      "/opds/ingest/" + name,
+			Updated: f.Time(time.Now()),
+			Links: []Link{
+				{
+					Rel:  FeedSubsectionLinkRel,
+					Href: "/opds/ingest?language=" + lang + "&state=" + name,
+					Type: FeedNavigationLinkType,
+				},
+			},
+			Content: &Content{
+				Type:    FeedTextContentType,
+				Content: h.MP[lang].Sprintf("^Rejected files - %d", counts[state]),
+			},
+		})
+	}
+	h.writeFeed(w, http.StatusOK, *f)
+}
+
+func newIngestItem(s *model.IngestStatus) ingestItem {
+	return ingestItem{
+		File:    s.File,
+		Archive: s.Archive,
+		State:   hash.BookState(s.State).String(),
+		Error:   s.Error,
+		Updated: time.Unix(0, s.Updated),
+	}
+}
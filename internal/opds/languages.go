@@ -42,5 +42,5 @@ func (h *Handler) languages(w http.ResponseWriter, r *http.Request) {
 		}
 		f.Entry = append(f.Entry, entry)
 	}
-	writeFeed(w, http.StatusOK, *f)
+	h.writeFeed(w, http.StatusOK, *f)
 }
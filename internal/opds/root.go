@@ -3,14 +3,25 @@ package opds
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"time"
+
+	"github.com/vinser/flibgolite/internal/core/model"
 )
 
 // Root
 func (h *Handler) root(w http.ResponseWriter, r *http.Request) {
+	if h.lib == "" && len(h.CFG.Libraries) > 1 {
+		h.libraries(w, r)
+		return
+	}
 	lang := h.getLanguage(r)
 	selfHref := fmt.Sprintf("/opds?language=%s", lang)
-	f := NewFeed(h.CFG.OPDS.TITLE, "", selfHref)
+	subtitle := ""
+	if h.lib != "" {
+		subtitle = h.CFG.Library.TITLE
+	}
+	f := NewFeed(h.CFG.OPDS.TITLE, subtitle, selfHref)
 	searchLink := &Link{Rel: FeedSearchLinkRel, Href: fmt.Sprintf("/opds/search?language=%s&q={searchTerms}", lang), Type: "application/atom+xml"}
 	f.Link = append(f.Link, *searchLink)
 	searchDescLink := &Link{Rel: FeedSearchLinkRel, Href: fmt.Sprintf("/opds/opensearch?language=%s", lang), Type: FeedSearchDescriptionLinkType, Title: "Search on catalog"}
@@ -81,6 +92,24 @@ func (h *Handler) root(w http.ResponseWriter, r *http.Request) {
 			},
 		},
 	}
+	if h.DB.CountContributors(model.TranslatorRole) > 0 {
+		f.Entry = append(f.Entry, &Entry{
+			Title:   h.MP[lang].Sprintf("~Book Translators"),
+			ID:      "translators",
+			Updated: f.Time(time.Now()),
+			Links: []Link{
+				{
+					Rel:  FeedSubsectionLinkRel,
+					Href: fmt.Sprintf("/opds/translators?language=%s", lang),
+					Type: FeedNavigationLinkType,
+				},
+			},
+			Content: &Content{
+				Type:    FeedTextContentType,
+				Content: h.MP[lang].Sprintf("^Browse books by translator"),
+			},
+		})
+	}
 	if len(h.CFG.Languages) > 1 {
 		f.Entry = append(f.Entry, &Entry{
 			Title:   h.MP[lang].Sprintf("~Book Languages"),
@@ -100,5 +129,32 @@ func (h *Handler) root(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
-	writeFeed(w, http.StatusOK, *f)
+	h.writeFeed(w, http.StatusOK, *f)
+}
+
+// Libraries
+func (h *Handler) libraries(w http.ResponseWriter, r *http.Request) {
+	lang := h.getLanguage(r)
+	selfHref := fmt.Sprintf("/opds?language=%s", lang)
+	f := NewFeed(h.CFG.OPDS.TITLE, "", selfHref)
+	for _, lib := range h.CFG.Libraries {
+		f.Entry = append(f.Entry, &Entry{
+			Title:   lib.TITLE,
+			ID:      "library:" + lib.NAME,
+			Updated: f.Time(time.Now()),
+			Links: []Link{
+				{
+					Rel:  FeedSubsectionLinkRel,
+					Href: fmt.Sprintf("/opds?language=%s&lib=%s", lang, url.QueryEscape(lib.NAME)),
+					Type: FeedNavigationLinkType,
+				},
+			},
+			Content: &Content{
+				Type:    FeedTextContentType,
+				Content: h.MP[lang].Sprintf("^Library books - %d", h.DB.ForLibrary(lib.ID).CountBooks()),
+			},
+		})
+	}
+
+	h.writeFeed(w, http.StatusOK, *f)
 }
@@ -21,7 +21,7 @@ func (h *Handler) openSerach(w http.ResponseWriter, r *http.Request) {
 <Description>Search on catalog</Description>
 <InputEncoding>UTF-8</InputEncoding>
 <OutputEncoding>UTF-8</OutputEncoding>
-<Url type="application/atom+xml" template=` + fmt.Sprintf("/opds/search?language=%s&q={searchTerms}", lang) + `/>
+<Url type="application/atom+xml" template=` + h.libraryHref(fmt.Sprintf("/opds/search?language=%s&q={searchTerms}", lang)) + `/>
 </OpenSearchDescription>	
 `
 	s := fmt.Sprintf("%s%s", xml.Header, data)
@@ -120,7 +120,7 @@ func (h *Handler) serach(w http.ResponseWriter, r *http.Request) {
 	case (authorCount == 0 && titleCount == 0 && keywordCount == 0): // nothing found
 		selfHref = fmt.Sprintf("/opds/search?language=%s&q={searchTerms}", lang)
 		f := NewFeed(h.MP[lang].Sprintf("Nothing found"), "", selfHref)
-		writeFeed(w, http.StatusOK, *f)
+		h.writeFeed(w, http.StatusOK, *f)
 	case authorCount > 0 && titleCount == 0 && keywordCount == 0: // show found authors
 		// h.listAuthors(w, r)
 		page, err := strconv.Atoi(r.FormValue("page"))
@@ -171,7 +171,7 @@ func (h *Handler) serach(w http.ResponseWriter, r *http.Request) {
 			}
 			f.Entry = append(f.Entry, entry)
 		}
-		writeFeed(w, http.StatusOK, *f)
+		h.writeFeed(w, http.StatusOK, *f)
 	case authorCount == 0 && titleCount > 0 && keywordCount == 0: // show books found by title
 		page, err := strconv.Atoi(r.FormValue("page"))
 		if err != nil {
@@ -206,7 +206,7 @@ func (h *Handler) serach(w http.ResponseWriter, r *http.Request) {
 		}
 
 		h.feedBookEntries(r, books, f)
-		writeFeed(w, http.StatusOK, *f)
+		h.writeFeed(w, http.StatusOK, *f)
 	case authorCount == 0 && titleCount == 0 && keywordCount > 0: // show books found by keyword
 		page, err := strconv.Atoi(r.FormValue("page"))
 		if err != nil {
@@ -241,7 +241,7 @@ func (h *Handler) serach(w http.ResponseWriter, r *http.Request) {
 		}
 
 		h.feedBookEntries(r, books, f)
-		writeFeed(w, http.StatusOK, *f)
+		h.writeFeed(w, http.StatusOK, *f)
 	default: // show chices for found items
 		selfHref = fmt.Sprintf("/opds/search?language=%s&q={searchTerms}", lang)
 		f := NewFeed(h.MP[lang].Sprintf("Choose from the found ones"), "", selfHref)
@@ -255,6 +255,6 @@ func (h *Handler) serach(w http.ResponseWriter, r *http.Request) {
 		if keywordCount > 0 {
 			f.Entry = append(f.Entry, h.foundKeywordsEntry(f, lang, queryString, keywordCount))
 		}
-		writeFeed(w, http.StatusOK, *f)
+		h.writeFeed(w, http.StatusOK, *f)
 	}
 }
@@ -96,7 +96,7 @@ func (h *Handler) listSeries(w http.ResponseWriter, r *http.Request) {
 			}
 			f.Entry = append(f.Entry, entry)
 		}
-		writeFeed(w, http.StatusOK, *f)
+		h.writeFeed(w, http.StatusOK, *f)
 	default:
 		for _, serie := range series {
 			entry := &Entry{
@@ -114,7 +114,7 @@ func (h *Handler) listSeries(w http.ResponseWriter, r *http.Request) {
 			f.Entry = append(f.Entry, entry)
 		}
 		addAllSeriesLink()
-		writeFeed(w, http.StatusOK, *f)
+		h.writeFeed(w, http.StatusOK, *f)
 	}
 }
 
@@ -139,7 +139,7 @@ func (h *Handler) serieBooks(w http.ResponseWriter, r *http.Request) {
 	}
 
 	h.feedBookEntries(r, books, f)
-	writeFeed(w, http.StatusOK, *f)
+	h.writeFeed(w, http.StatusOK, *f)
 }
 
 func sortSeries(s []*model.Serie, t language.Tag) {
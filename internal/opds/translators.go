@@ -0,0 +1,118 @@
+package opds
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/vinser/flibgolite/internal/core/model"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// Translators
+func (h *Handler) translators(w http.ResponseWriter, r *http.Request) {
+	switch {
+	default:
+		h.listTranslators(w, r)
+		h.LOG.D.Println("listTranslators")
+	case r.FormValue("id") != "":
+		h.translatorBooks(w, r)
+		h.LOG.D.Println("translatorBooks")
+	}
+}
+
+// GET /opds/translators?translator="" - all first translators letters
+func (h *Handler) listTranslators(w http.ResponseWriter, r *http.Request) {
+	lang := h.getLanguage(r)
+	prefix := r.FormValue("translator")
+	translators := h.DB.ListContributors(model.TranslatorRole, prefix)
+	if len(translators) == 0 {
+		writeMessage(w, http.StatusNotFound, h.MP[lang].Sprintf("Translators not found"))
+		return
+	}
+	sortContributors(translators, h.CFG.Locales.Languages[lang].Tag)
+	totalTranslators := 0
+	for _, t := range translators {
+		totalTranslators += t.Count
+	}
+	selfHref := fmt.Sprintf("/opds/translators?language=%s", lang)
+	if prefix != "" {
+		selfHref += "&translator=" + url.QueryEscape(prefix)
+	}
+
+	f := NewFeed(h.MP[lang].Sprintf("Translators"), "", selfHref)
+	if totalTranslators <= h.CFG.OPDS.PAGE_SIZE {
+		for _, t := range h.DB.ListContributorsWithTotals(model.TranslatorRole, prefix) {
+			entry := &Entry{
+				Title:   t.Sort,
+				ID:      fmt.Sprintf("/opds/translators/language=%s/translator=%d", lang, t.ID),
+				Updated: f.Time(time.Now()),
+				Links: []Link{
+					{Rel: FeedSubsectionLinkRel, Href: fmt.Sprintf("/opds/translators?language=%s&id=%d&page=1", lang, t.ID), Type: FeedNavigationLinkType},
+				},
+				Content: &Content{
+					Type:    FeedTextContentType,
+					Content: h.MP[lang].Sprintf("^Translator Total books - %d", t.Count),
+				},
+			}
+			f.Entry = append(f.Entry, entry)
+		}
+	} else {
+		for _, t := range translators {
+			entry := &Entry{
+				Title:   t.Sort,
+				ID:      fmt.Sprintf("/opds/translators/language=%s/translator=%s", lang, t.Sort),
+				Updated: f.Time(time.Now()),
+				Links: []Link{
+					{Rel: FeedSubsectionLinkRel, Href: fmt.Sprintf("/opds/translators?language=%s&translator=%s", lang, url.QueryEscape(t.Sort)), Type: FeedNavigationLinkType},
+				},
+				Content: &Content{
+					Type:    FeedTextContentType,
+					Content: h.MP[lang].Sprintf("^Found translators - %d", t.Count),
+				},
+			}
+			f.Entry = append(f.Entry, entry)
+		}
+	}
+	h.writeFeed(w, http.StatusOK, *f)
+}
+
+func (h *Handler) translatorBooks(w http.ResponseWriter, r *http.Request) {
+	lang := h.getLanguage(r)
+	translatorId, _ := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	translator := h.DB.ContributorByID(translatorId)
+	if translator == nil {
+		writeMessage(w, http.StatusNotFound, h.MP[lang].Sprintf("Translators not found"))
+		return
+	}
+	page, err := strconv.Atoi(r.FormValue("page"))
+	if err != nil {
+		page = 1
+	}
+	offset := (page - 1) * h.CFG.OPDS.PAGE_SIZE
+
+	books := h.DB.ListContributorBooks(translatorId, model.TranslatorRole, h.CFG.OPDS.PAGE_SIZE+1, offset)
+	selfHref := fmt.Sprintf("/opds/translators?language=%s&id=%d&page=%d", lang, translatorId, page)
+	f := NewFeed(translator.Name, h.MP[lang].Sprintf("Translator"), selfHref)
+	if len(books) > h.CFG.OPDS.PAGE_SIZE {
+		nextRef := fmt.Sprintf("/opds/translators?language=%s&id=%d&page=%d", lang, translatorId, page+1)
+		nextLink := &Link{Rel: FeedNextLinkRel, Href: nextRef, Type: FeedNavigationLinkType}
+		f.Link = append(f.Link, *nextLink)
+		books = books[:h.CFG.OPDS.PAGE_SIZE]
+	}
+
+	h.feedBookEntries(r, books, f)
+	h.writeFeed(w, http.StatusOK, *f)
+}
+
+func sortContributors(s []*model.Contributor, t language.Tag) {
+	c := collate.New(t, collate.Force)
+	sort.Slice(s, func(i, j int) bool {
+		return c.CompareString(s[i].Sort, s[j].Sort) < 0
+	})
+}
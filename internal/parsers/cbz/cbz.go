@@ -0,0 +1,313 @@
+// Package cbz parses comic book ZIP archives (CBZ) with optional ComicInfo.xml metadata.
+//
+// RAR based comics (CBR) are not supported: there is no RAR decoder in the standard library,
+// and pure-Go ones either decode RAR4 only or bring a large third-party dependency for RAR5 and solid archives.
+// CBR files are left in the new folder as files of unsupported format, they may be repacked to CBZ
+package cbz
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/vinser/flibgolite/internal/core/model"
+	"github.com/vinser/flibgolite/internal/parsers"
+	"golang.org/x/net/html/charset"
+)
+
+// ComicInfo is a part of ComicRack ComicInfo.xml schema used for cataloguing
+type ComicInfo struct {
+	XMLName     xml.Name `xml:"ComicInfo"`
+	Title       string   `xml:"Title"`
+	Series      string   `xml:"Series"`
+	Number      string   `xml:"Number"`
+	Volume      string   `xml:"Volume"`
+	Summary     string   `xml:"Summary"`
+	Year        string   `xml:"Year"`
+	Writer      string   `xml:"Writer"`
+	Publisher   string   `xml:"Publisher"`
+	GTIN        string   `xml:"GTIN"`
+	Genre       string   `xml:"Genre"`
+	Tags        string   `xml:"Tags"`
+	LanguageISO string   `xml:"LanguageISO"`
+	Pages       []struct {
+		Image int    `xml:"Image,attr"`
+		Type  string `xml:"Type,attr"`
+	} `xml:"Pages>Page"`
+}
+
+type CBZ struct {
+	Info      ComicInfo // ComicInfo.xml content
+	InfoError error     // ComicInfo.xml read error, the comic is catalogued by file name and pages then
+	Pages     []string  // Page image entries in reading order
+	Cover     string    // Cover image entry
+	FileName  string    // Title fallback
+}
+
+// ParseCBZ reads comic book archive page list and ComicInfo.xml metadata.
+// Malformed ComicInfo.xml is kept in InfoError and ignored
+func ParseCBZ(zr *zip.Reader, fileName string) (*CBZ, error) {
+	c := &CBZ{FileName: fileName}
+	for _, f := range Pages(zr) {
+		c.Pages = append(c.Pages, f.Name)
+	}
+	if len(c.Pages) == 0 {
+		return nil, fmt.Errorf("no page images found in %s", fileName)
+	}
+	for _, f := range zr.File {
+		if strings.EqualFold(path.Base(f.Name), "ComicInfo.xml") {
+			if err := c.readComicInfo(f); err != nil {
+				c.Info = ComicInfo{}
+				c.InfoError = fmt.Errorf("ComicInfo.xml: %v", err)
+			}
+			break
+		}
+	}
+	c.Cover = c.Pages[0]
+	for _, p := range c.Info.Pages {
+		if p.Type == "FrontCover" && p.Image >= 0 && p.Image < len(c.Pages) {
+			c.Cover = c.Pages[p.Image]
+			break
+		}
+	}
+	return c, nil
+}
+
+func (c *CBZ) readComicInfo(f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	decoder := xml.NewDecoder(rc)
+	decoder.Entity = xml.HTMLEntity
+	decoder.CharsetReader = charset.NewReaderLabel
+	return decoder.Decode(&c.Info)
+}
+
+// Pages returns archive image entries sorted in natural order
+func Pages(zr *zip.Reader) []*zip.File {
+	pages := []*zip.File{}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || strings.HasPrefix(path.Base(f.Name), ".") {
+			continue
+		}
+		switch strings.ToLower(path.Ext(f.Name)) {
+		case ".jpg", ".jpeg", ".png", ".gif":
+			pages = append(pages, f)
+		}
+	}
+	sort.Slice(pages, func(i, j int) bool { return naturalLess(pages[i].Name, pages[j].Name) })
+	return pages
+}
+
+// naturalLess compares strings treating digit runs as numbers, so "page2" goes before "page10"
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			na, ra := splitNumber(a)
+			nb, rb := splitNumber(b)
+			if na != nb {
+				return na < nb
+			}
+			a, b = ra, rb
+			continue
+		}
+		ca, cb := unicode.ToLower(rune(a[0])), unicode.ToLower(rune(b[0]))
+		if ca != cb {
+			return ca < cb
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func splitNumber(s string) (int, string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	n, _ := strconv.Atoi(s[:i])
+	return n, s[i:]
+}
+
+func (c *CBZ) GetFormat() string {
+	return "cbz"
+}
+
+func (c *CBZ) GetTitle() string {
+	switch {
+	case c.Info.Title != "":
+		return strings.TrimSpace(c.Info.Title)
+	case c.Info.Series != "" && c.Info.Number != "":
+		return fmt.Sprintf("%s #%s", strings.TrimSpace(c.Info.Series), strings.TrimSpace(c.Info.Number))
+	}
+	return parsers.FileNameTitle(c.FileName)
+}
+
+func (c *CBZ) GetSort() string {
+	return parsers.GetSortTitle(c.GetTitle(), parsers.GetLanguageTag(c.Info.LanguageISO))
+}
+
+func (c *CBZ) GetYear() string {
+	return parsers.PickYear(c.Info.Year)
+}
+
+func (c *CBZ) GetPlot() string {
+	return parsers.StripHTMLTags(c.Info.Summary)
+}
+
+func (c *CBZ) GetCover() string {
+	return c.Cover
+}
+
+func (c *CBZ) GetLanguage() *model.Language {
+	return parsers.GetLanguage(c.Info.LanguageISO)
+}
+
+func (c *CBZ) GetAuthors() []*model.Author {
+	authors := []*model.Author{}
+	for _, w := range strings.Split(c.Info.Writer, ",") {
+		author := parsers.AuthorByFullName(strings.TrimSpace(w))
+		if author.Sort != "" {
+			authors = append(authors, author)
+		}
+	}
+	return parsers.AuthorsOrUnknown(authors)
+}
+
+// GetGenres returns FB2 comics genre, so comics are listed in the genres tree
+func (c *CBZ) GetGenres() []string {
+	return append([]string{"entert_comics"}, strings.FieldsFunc(c.Info.Genre, parsers.IsSeparator)...)
+}
+
+func (c *CBZ) GetKeywords() string {
+	return strings.Join(strings.FieldsFunc(c.Info.Genre+","+c.Info.Tags, parsers.IsSeparator), " ")
+}
+
+func (c *CBZ) GetSerie() *model.Serie {
+	return &model.Serie{Name: strings.TrimSpace(c.Info.Series)}
+}
+
+// GetSerieNumber returns the integer part of issue number, e.g. 12 for "12.5"
+func (c *CBZ) GetSerieNumber() int {
+	n, _ := splitNumber(strings.TrimSpace(c.Info.Number))
+	return n
+}
+
+// GetISBN returns ISBN of the issue from its global trade item number
+func (c *CBZ) GetISBN() string {
+	return parsers.ISBNs(c.Info.GTIN)
+}
+
+func (c *CBZ) GetPublisher() string {
+	return strings.TrimSpace(c.Info.Publisher)
+}
+
+// GetPages returns the number of page images
+func (c *CBZ) GetPages() int {
+	return len(c.Pages)
+}
+
+func (c *CBZ) GetCity() string {
+	return ""
+}
+
+func (c *CBZ) GetSrcLanguage() string {
+	return ""
+}
+
+func (c *CBZ) GetSrcTitle() string {
+	return ""
+}
+
+func (c *CBZ) String() string {
+	return "" + fmt.Sprint(
+		"\n=========CBZ===================\n",
+		fmt.Sprintf("Info:       %#v\n", c.Info),
+		fmt.Sprintf("Pages:      %d\n", len(c.Pages)),
+		fmt.Sprintf("Cover:      %#v\n", c.Cover),
+		"===============================\n",
+	)
+}
+
+// OpenComic returns the comic book archive reader and the function to close it
+func OpenComic(stock string, book *model.Book) (*zip.Reader, func() error, error) {
+	return parsers.OpenZipBook(stock, book)
+}
+
+// PageCount returns the number of page images in the comic book archive
+func PageCount(stock string, book *model.Book) (int, error) {
+	zr, close, err := OpenComic(stock, book)
+	if err != nil {
+		return 0, err
+	}
+	defer close()
+	return len(Pages(zr)), nil
+}
+
+// OpenPage returns the reader of page image that closes the comic too and the image extension, pages are numbered from 0
+func OpenPage(stock string, book *model.Book, page int) (io.ReadCloser, string, error) {
+	zr, close, err := OpenComic(stock, book)
+	if err != nil {
+		return nil, "", err
+	}
+	pages := Pages(zr)
+	if page < 0 || page >= len(pages) {
+		close()
+		return nil, "", fmt.Errorf("page %d not found in %s", page, book.File)
+	}
+	f, err := pages[page].Open()
+	if err != nil {
+		close()
+		return nil, "", err
+	}
+	return &pageReader{ReadCloser: f, close: close}, strings.ToLower(path.Ext(pages[page].Name)), nil
+}
+
+// pageReader closes the comic with its page
+type pageReader struct {
+	io.ReadCloser
+	close func() error
+}
+
+func (p *pageReader) Close() error {
+	p.ReadCloser.Close()
+	return p.close()
+}
+
+// GetCoverImage decodes the cover page image
+func GetCoverImage(stock string, book *model.Book) (image.Image, error) {
+	zr, close, err := OpenComic(stock, book)
+	if err != nil {
+		return nil, err
+	}
+	defer close()
+	for _, p := range Pages(zr) {
+		if p.Name == book.Cover {
+			f, err := p.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			img, _, err := image.Decode(f)
+			return img, err
+		}
+	}
+	return nil, fmt.Errorf("cover %s not found in %s", book.Cover, book.File)
+}
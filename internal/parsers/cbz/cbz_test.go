@@ -0,0 +1,176 @@
+package cbz
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vinser/flibgolite/internal/core/model"
+)
+
+type entry struct {
+	name string
+	data []byte
+}
+
+func pngPage(t *testing.T) []byte {
+	img := image.NewGray(image.Rect(0, 0, 2, 3))
+	img.Set(0, 0, color.White)
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zipData(t *testing.T, method uint16, entries ...entry) []byte {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for _, e := range entries {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: e.name, Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(e.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zipReader(t *testing.T, entries ...entry) *zip.Reader {
+	data := zipData(t, zip.Deflate, entries...)
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr
+}
+
+func TestParseCBZ(t *testing.T) {
+	page := pngPage(t)
+	var testComics = []struct {
+		name      string
+		entries   []entry
+		title     string
+		pages     []string
+		cover     string
+		infoError bool
+		err       bool
+	}{
+		{
+			"natural page order",
+			[]entry{{"p10.png", page}, {"p2.png", page}, {"p1.png", page}, {"notes.txt", nil}},
+			"Comic", []string{"p1.png", "p2.png", "p10.png"}, "p1.png", false, false,
+		},
+		{
+			"comic info",
+			[]entry{{"a.png", page}, {"b.png", page}, {"ComicInfo.xml", []byte(`<ComicInfo><Series>Saga</Series><Number>7</Number><Pages><Page Image="1" Type="FrontCover"/></Pages></ComicInfo>`)}},
+			"Saga #7", []string{"a.png", "b.png"}, "b.png", false, false,
+		},
+		{
+			"malformed comic info",
+			[]entry{{"a.png", page}, {"ComicInfo.xml", []byte(`<ComicInfo><Title>Broken</Title>`)}},
+			"Comic", []string{"a.png"}, "a.png", true, false,
+		},
+		{
+			"invalid path names",
+			[]entry{{`dir\02.png`, page}, {"./01.png", page}},
+			"Comic", []string{"./01.png", `dir\02.png`}, "./01.png", false, false,
+		},
+		{
+			"no pages",
+			[]entry{{"ComicInfo.xml", []byte(`<ComicInfo/>`)}},
+			"", nil, "", false, true,
+		},
+	}
+
+	for _, c := range testComics {
+		comic, err := ParseCBZ(zipReader(t, c.entries...), "Comic.cbz")
+		if (err != nil) != c.err {
+			t.Errorf("%s: expecting error %v, got: %v", c.name, c.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if title := comic.GetTitle(); title != c.title {
+			t.Errorf("%s: expecting title %q, got: %q", c.name, c.title, title)
+		}
+		if len(comic.Pages) != len(c.pages) {
+			t.Errorf("%s: expecting pages %v, got: %v", c.name, c.pages, comic.Pages)
+		} else {
+			for i := range c.pages {
+				if comic.Pages[i] != c.pages[i] {
+					t.Errorf("%s: expecting pages %v, got: %v", c.name, c.pages, comic.Pages)
+					break
+				}
+			}
+		}
+		if comic.GetPages() != len(c.pages) {
+			t.Errorf("%s: expecting %d pages, got: %d", c.name, len(c.pages), comic.GetPages())
+		}
+		if comic.Cover != c.cover {
+			t.Errorf("%s: expecting cover %q, got: %q", c.name, c.cover, comic.Cover)
+		}
+		if (comic.InfoError != nil) != c.infoError {
+			t.Errorf("%s: expecting ComicInfo.xml error %v, got: %v", c.name, c.infoError, comic.InfoError)
+		}
+	}
+}
+
+func TestOpenComic(t *testing.T) {
+	page := pngPage(t)
+	comic := zipData(t, zip.Deflate, entry{"./01.png", page}, entry{`dir\02.png`, page})
+	stock := t.TempDir()
+	if err := os.WriteFile(filepath.Join(stock, "single.cbz"), comic, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, method := range []uint16{zip.Store, zip.Deflate} {
+		name := fmt.Sprintf("archive%d.zip", method)
+		archive := zipData(t, method, entry{"readme.txt", []byte("comics")}, entry{"comics/packed.cbz", comic})
+		if err := os.WriteFile(filepath.Join(stock, name), archive, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var testBooks = []model.Book{
+		{File: "single.cbz", Cover: `dir\02.png`},
+		{File: "packed.cbz", Archive: "archive0.zip", Cover: `dir\02.png`},
+		{File: "packed.cbz", Archive: "archive8.zip", Cover: `dir\02.png`},
+	}
+
+	for _, book := range testBooks {
+		count, err := PageCount(stock, &book)
+		if err != nil || count != 2 {
+			t.Errorf("%s %s: expecting 2 pages, got: %d %v", book.Archive, book.File, count, err)
+		}
+		rc, ext, err := OpenPage(stock, &book, 1)
+		if err != nil {
+			t.Errorf("%s %s: expecting page 1, got: %v", book.Archive, book.File, err)
+		} else {
+			data, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil || ext != ".png" || !bytes.Equal(data, page) {
+				t.Errorf("%s %s: expecting page 1 of png, got: %q %v", book.Archive, book.File, ext, err)
+			}
+		}
+		if _, _, err := OpenPage(stock, &book, 2); err == nil {
+			t.Errorf("%s %s: expecting error for page 2", book.Archive, book.File)
+		}
+		img, err := GetCoverImage(stock, &book)
+		if err != nil || img.Bounds().Dy() != 3 {
+			t.Errorf("%s %s: expecting cover image, got: %v", book.Archive, book.File, err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package epub
 
 import (
+	"strconv"
 	"strings"
 	"unicode"
 
@@ -35,6 +36,10 @@ func (ep *OPF) GetPlot() string {
 	return parsers.StripHTMLTags(strings.Join(ep.Metadata.Description, " "))
 }
 
+func (ep *OPF) GetTextSample() string {
+	return ep.TextSample
+}
+
 func (ep *OPF) GetCover() string {
 	if strings.TrimSpace(ep.Version) == "2.0" {
 		content := ""
@@ -73,44 +78,61 @@ func (ep *OPF) GetLanguage() *model.Language {
 func (ep *OPF) GetAuthors() []*model.Author {
 	authors := make([]*model.Author, 0)
 	for _, cr := range ep.Metadata.Creator {
-		a := &model.Author{}
-		for _, meta := range ep.Metadata.Meta {
-			if meta.Refines != "#"+cr.ID {
-				continue
+		role, fileAs := ep.creatorRole(cr.ID, cr.Role, cr.FileAs)
+		if role == "aut" || role == "" || len(ep.Metadata.Creator) == 1 {
+			if a := creatorName(cr.Text, fileAs); len(a.Sort) > 0 {
+				authors = append(authors, a)
 			}
+		}
+	}
+	return parsers.AuthorsOrUnknown(authors)
+}
 
-			switch {
-			case meta.Property == "role" && meta.Text == "aut":
-				cr.Role = "aut"
-			case meta.Property == "file-as":
-				cr.FileAs = meta.Text
+// GetContributors returns the creators with translator, illustrator and editor roles
+func (ep *OPF) GetContributors() []*model.Contributor {
+	contributors := make([]*model.Contributor, 0)
+	for _, cr := range ep.Metadata.Creator {
+		role, fileAs := ep.creatorRole(cr.ID, cr.Role, cr.FileAs)
+		switch role {
+		case model.TranslatorRole, model.IllustratorRole, model.EditorRole:
+			if a := creatorName(cr.Text, fileAs); len(a.Sort) > 0 {
+				contributors = append(contributors, &model.Contributor{Author: *a, Role: role})
 			}
 		}
-		if cr.Role == "aut" || cr.Role == "" || len(ep.Metadata.Creator) == 1 {
-			parts := strings.Split(cr.Text, ",")
-			name := parsers.ParseFullName(parts[0])
-			a.Name = strings.TrimSpace(strings.TrimSuffix(name.First+" "+name.Middle+" "+name.Last+" ("+name.Nick+")", " ()"))
-			if cr.FileAs != "" {
-				a.Sort = parsers.AddCommaAfterLastName(parsers.DelimitGluedName(cr.FileAs))
-			} else {
-				sortName := name.Last + ", " + name.First + " " + name.Middle + " (" + name.Nick + ")"
-				a.Sort = strings.TrimSuffix(strings.TrimSpace(strings.TrimSuffix(sortName, " ()")), ",")
-			}
-			if len(a.Sort) > 0 {
-				a.Sort = strings.ToUpper(a.Sort)
-				authors = append(authors, a)
-			}
+	}
+	return contributors
+}
+
+// creatorRole returns the creator role and file-as name given by OPF2 attributes or EPUB3 refining meta
+func (ep *OPF) creatorRole(id, role, fileAs string) (string, string) {
+	for _, meta := range ep.Metadata.Meta {
+		if id == "" || meta.Refines != "#"+id {
+			continue
+		}
+		switch meta.Property {
+		case "role":
+			role = strings.TrimSpace(meta.Text)
+		case "file-as":
+			fileAs = meta.Text
 		}
 	}
-	if len(authors) == 0 {
-		authors = append(authors,
-			&model.Author{
-				Name: "[author not specified]",
-				Sort: "[author not specified]",
-			},
-		)
+	return role, fileAs
+}
+
+// creatorName makes the author from the creator name and file-as name
+func creatorName(text, fileAs string) *model.Author {
+	a := &model.Author{}
+	parts := strings.Split(text, ",")
+	name := parsers.ParseFullName(parts[0])
+	a.Name = strings.TrimSpace(strings.TrimSuffix(name.First+" "+name.Middle+" "+name.Last+" ("+name.Nick+")", " ()"))
+	if fileAs != "" {
+		a.Sort = parsers.AddCommaAfterLastName(parsers.DelimitGluedName(fileAs))
+	} else {
+		sortName := name.Last + ", " + name.First + " " + name.Middle + " (" + name.Nick + ")"
+		a.Sort = strings.TrimSuffix(strings.TrimSpace(strings.TrimSuffix(sortName, " ()")), ",")
 	}
-	return authors
+	a.Sort = strings.ToUpper(a.Sort)
+	return a
 }
 
 func isSeparator(r rune) bool {
@@ -125,10 +147,79 @@ func (ep *OPF) GetKeywords() string {
 	return strings.Join(strings.FieldsFunc(strings.Join(ep.Metadata.Subject, " "), isSeparator), " ")
 }
 
+// GetSerie returns the calibre series (OPF2) or the EPUB3 collection the book belongs to
 func (ep *OPF) GetSerie() *model.Serie {
+	for _, meta := range ep.Metadata.Meta {
+		switch {
+		case meta.Name == "calibre:series" && strings.TrimSpace(meta.Content) != "":
+			return &model.Serie{Name: strings.TrimSpace(meta.Content)}
+		case meta.Property == "belongs-to-collection" && strings.TrimSpace(meta.Text) != "":
+			return &model.Serie{Name: strings.TrimSpace(meta.Text)}
+		}
+	}
 	return &model.Serie{}
 }
 
 func (ep *OPF) GetSerieNumber() int {
-	return 0
+	return parsers.SerieNumber(ep.serieIndex())
+}
+
+// GetSeries returns the book series with its text number, whole numbers written by calibre as 2.0 are returned as 2
+func (ep *OPF) GetSeries() []*model.BookSerie {
+	serie := ep.GetSerie()
+	if serie.Name == "" {
+		return []*model.BookSerie{}
+	}
+	return []*model.BookSerie{{Serie: *serie, Number: ep.serieIndex()}}
+}
+
+// GetISBN returns ISBNs of the identifiers with ISBN scheme or ISBN value
+func (ep *OPF) GetISBN() string {
+	ids := []string{}
+	for _, id := range ep.Metadata.Identifier {
+		text := strings.TrimSpace(id.Text)
+		if strings.EqualFold(id.Scheme, "ISBN") || strings.Contains(strings.ToLower(text), "isbn") || strings.Trim(text, "0123456789Xx- ") == "" {
+			ids = append(ids, text)
+		}
+	}
+	return parsers.ISBNs(strings.Join(ids, ", "))
+}
+
+func (ep *OPF) GetPublisher() string {
+	if len(ep.Metadata.Publisher) > 0 {
+		return strings.TrimSpace(ep.Metadata.Publisher[0])
+	}
+	return ""
+}
+
+func (ep *OPF) GetCity() string {
+	return ""
+}
+
+func (ep *OPF) GetSrcLanguage() string {
+	return ""
+}
+
+func (ep *OPF) GetSrcTitle() string {
+	return ""
+}
+
+// serieIndex returns the calibre series index (OPF2) or the EPUB3 collection position
+func (ep *OPF) serieIndex() string {
+	for _, meta := range ep.Metadata.Meta {
+		var index string
+		switch {
+		case meta.Name == "calibre:series_index":
+			index = strings.TrimSpace(meta.Content)
+		case meta.Property == "group-position":
+			index = strings.TrimSpace(meta.Text)
+		default:
+			continue
+		}
+		if n, err := strconv.ParseFloat(index, 64); err == nil {
+			return strconv.FormatFloat(n, 'f', -1, 64)
+		}
+		return index
+	}
+	return ""
 }
@@ -7,8 +7,7 @@ import (
 	"fmt"
 	"image"
 	"io"
-	"log"
-	"path"
+	pathpkg "path"
 	"strings"
 
 	_ "image/gif"
@@ -16,6 +15,7 @@ import (
 	_ "image/png"
 
 	"github.com/vinser/flibgolite/internal/core/model"
+	"github.com/vinser/flibgolite/internal/parsers"
 	"golang.org/x/net/html/charset"
 )
 
@@ -32,7 +32,7 @@ type OCF struct {
 }
 
 // Get OPF file path from OCF file
-func GetOPFPath(zr *zip.ReadCloser) (string, error) {
+func GetOPFPath(zr *zip.Reader) (string, error) {
 	f, err := zr.Open("META-INF/container.xml")
 	if err != nil {
 		return "", err
@@ -61,6 +61,8 @@ type OPF struct {
 		// Contains an identifier associated with the given Rendition, such as a UUID, DOI or ISBN.
 		Identifier []struct {
 			ID string `xml:"id,attr,omitempty"`
+			// Identifier system, e.g. ISBN - OPF2 extension
+			Scheme string `xml:"scheme,attr,omitempty"`
 			// ID value
 			Text string `xml:",chardata"`
 		} `xml:"identifier"`
@@ -114,6 +116,14 @@ type OPF struct {
 			Properties string `xml:"properties,attr,omitempty"`
 		} `xml:"item"`
 	} `xml:"manifest"`
+	// Defines an ordered list of manifest item references that represent the default reading order of the given Rendition.
+	Spine struct {
+		ItemRef []struct {
+			IDRef string `xml:"idref,attr"`
+		} `xml:"itemref"`
+	} `xml:"spine"`
+	// Beginning of the publication text, it is not a part of the Package Document
+	TextSample string `xml:"-"`
 }
 
 func (opf *OPF) String() string {
@@ -138,7 +148,7 @@ func (opf *OPF) String() string {
 }
 
 // Creates an opf package object from an OPF content.
-func NewOPF(zr *zip.ReadCloser, path string) (*OPF, error) {
+func NewOPF(zr *zip.Reader, path string) (*OPF, error) {
 	r, err := zr.Open(path)
 	if err != nil {
 		return nil, err
@@ -148,23 +158,80 @@ func NewOPF(zr *zip.ReadCloser, path string) (*OPF, error) {
 	if err := decodeXML(r, &opf); err != nil {
 		return nil, err
 	}
+	opf.TextSample = opf.readTextSample(zr, pathpkg.Dir(path))
 	return opf, nil
 }
 
+// ParseOPF creates an opf package object from a standalone OPF file, e.g. calibre metadata.opf
+func ParseOPF(r io.Reader) (*OPF, error) {
+	opf := &OPF{}
+	if err := decodeXML(r, opf); err != nil {
+		return nil, err
+	}
+	return opf, nil
+}
+
+// readTextSample returns up to parsers.TEXT_SAMPLE_LEN bytes of text of the first spine documents,
+// dir is the folder of OPF file the manifest hrefs are relative to
+func (opf *OPF) readTextSample(zr *zip.Reader, dir string) string {
+	href := make(map[string]string, len(opf.Manifest.Item))
+	for _, item := range opf.Manifest.Item {
+		href[item.ID] = item.Href
+	}
+	sample := ""
+	for _, ref := range opf.Spine.ItemRef {
+		if len(sample) >= parsers.TEXT_SAMPLE_LEN {
+			break
+		}
+		f, err := zr.Open(pathpkg.Join(dir, href[ref.IDRef]))
+		if err != nil {
+			continue
+		}
+		b, _ := io.ReadAll(io.LimitReader(f, 64*1024))
+		f.Close()
+		sample += " " + parsers.StripHTMLTags(string(b))
+	}
+	sample = strings.TrimSpace(parsers.CollapseSpaces(sample))
+	if len(sample) > parsers.TEXT_SAMPLE_LEN {
+		sample = sample[:parsers.TEXT_SAMPLE_LEN]
+	}
+	return sample
+}
+
 func GetCoverImage(stock string, book *model.Book) (image.Image, error) {
-	zr, _ := zip.OpenReader(path.Join(stock, book.File))
-	defer zr.Close()
+	var zr *zip.Reader
+	if book.Archive == "" {
+		zrc, err := zip.OpenReader(parsers.StockPath(stock, book.File))
+		if err != nil {
+			return nil, err
+		}
+		defer zrc.Close()
+		zr = &zrc.Reader
+	} else {
+		rc, err := parsers.OpenBook(stock, book)
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		zr, err = parsers.NewZipReader(rc)
+		if err != nil {
+			return nil, err
+		}
+	}
 	var rc io.ReadCloser
 	var err error
 	for _, file := range zr.File {
 		if strings.Contains(file.Name, book.Cover) {
 			rc, err = file.Open()
 			if err != nil {
-				log.Fatal(err)
+				return nil, err
 			}
 			break
 		}
 	}
+	if rc == nil {
+		return nil, fmt.Errorf("cover %s not found in %s", book.Cover, book.File)
+	}
 	defer rc.Close()
 	img, _, err := image.Decode(bufio.NewReader(rc))
 
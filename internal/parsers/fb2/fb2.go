@@ -37,6 +37,10 @@ func (fb *FB2) GetPlot() string {
 	return parsers.StripHTMLTags(strings.Join(fb.Description.TitleInfo.Annotation.P, " "))
 }
 
+func (fb *FB2) GetTextSample() string {
+	return fb.TextSample
+}
+
 func (fb *FB2) GetCover() string {
 	return strings.TrimPrefix(fb.Description.TitleInfo.CoverPage.Image.Href, "#")
 }
@@ -67,15 +71,19 @@ func (fb *FB2) GetAuthors() []*model.Author {
 			authors = append(authors, author)
 		}
 	}
-	if len(authors) == 0 {
-		authors = append(authors,
-			&model.Author{
-				Name: "[author not specified]",
-				Sort: "[author not specified]",
-			},
-		)
+	return parsers.AuthorsOrUnknown(authors)
+}
+
+// GetContributors returns the book translators
+func (fb *FB2) GetContributors() []*model.Contributor {
+	contributors := make([]*model.Contributor, 0, len(fb.Description.TitleInfo.Translators))
+	for _, t := range fb.Description.TitleInfo.Translators {
+		translator := parsers.AuthorByFullName(fmt.Sprintf("%s %s %s", t.FirstName, t.MiddleName, t.LastName))
+		if translator.Sort != "" {
+			contributors = append(contributors, &model.Contributor{Author: *translator, Role: model.TranslatorRole})
+		}
 	}
-	return authors
+	return contributors
 }
 
 func (fb *FB2) GetGenres() []string {
@@ -97,10 +105,56 @@ func (fb *FB2) GetSerie() *model.Serie {
 }
 func (fb *FB2) GetSerieNumber() int {
 	if len(fb.Description.PublishInfo.Series) > 0 {
-		return fb.Description.PublishInfo.Series[0].Number
+		return parsers.SerieNumber(fb.Description.PublishInfo.Series[0].Number)
 	} else if len(fb.Description.TitleInfo.Series) > 0 {
-		return fb.Description.TitleInfo.Series[0].Number
+		return parsers.SerieNumber(fb.Description.TitleInfo.Series[0].Number)
 	} else {
 		return 0
 	}
 }
+
+// GetSeries returns the author series of title-info followed by the publisher series of publish-info
+func (fb *FB2) GetSeries() []*model.BookSerie {
+	series := []*model.BookSerie{}
+	for _, info := range []struct {
+		role   string
+		series []Serie
+	}{
+		{model.AuthorSerie, fb.Description.TitleInfo.Series},
+		{model.PublisherSerie, fb.Description.PublishInfo.Series},
+	} {
+		for _, s := range info.series {
+			series = append(series, &model.BookSerie{
+				Serie:  model.Serie{Name: parsers.Title(s.Name, fb.Description.TitleInfo.Lang)},
+				Role:   info.role,
+				Number: s.Number,
+			})
+		}
+	}
+	return series
+}
+
+func (fb *FB2) GetISBN() string {
+	return parsers.ISBNs(fb.Description.PublishInfo.ISBN)
+}
+
+func (fb *FB2) GetPublisher() string {
+	return fb.Description.PublishInfo.Publisher
+}
+
+func (fb *FB2) GetCity() string {
+	return fb.Description.PublishInfo.City
+}
+
+// GetSrcLanguage returns the original language code of the translated book
+func (fb *FB2) GetSrcLanguage() string {
+	if lang := strings.TrimSpace(fb.Description.TitleInfo.SrcLang); lang != "" {
+		return strings.ToLower(lang)
+	}
+	return strings.ToLower(strings.TrimSpace(fb.Description.SrcTitleInfo.Lang))
+}
+
+// GetSrcTitle returns the original title of the translated book
+func (fb *FB2) GetSrcTitle() string {
+	return fb.Description.SrcTitleInfo.BookTitle
+}
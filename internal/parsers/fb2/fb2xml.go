@@ -26,7 +26,6 @@
 package fb2
 
 import (
-	"archive/zip"
 	"bytes"
 	"encoding/base64"
 	"encoding/xml"
@@ -34,8 +33,6 @@ import (
 	"fmt"
 	"image"
 	"io"
-	"os"
-	"path"
 	"strconv"
 	"strings"
 
@@ -44,30 +41,38 @@ import (
 	_ "image/png"
 
 	"github.com/vinser/flibgolite/internal/core/model"
+	"github.com/vinser/flibgolite/internal/parsers"
 	"github.com/vinser/u8xml"
 )
 
 type FB2 struct {
 	// FictionBook xml.Name `xml:"FictionBook"` // Root element
 	Description struct {
-		TitleInfo   TitleInfo   `xml:"title-info"`
-		PublishInfo PublishInfo `xml:"publish-info"`
+		TitleInfo    TitleInfo   `xml:"title-info"`
+		SrcTitleInfo TitleInfo   `xml:"src-title-info"` // Original book information if the book is a translation
+		PublishInfo  PublishInfo `xml:"publish-info"`
 	} `xml:"description"`
+	TextSample string // Beginning of the book body text
 }
 type TitleInfo struct { // Generic information about a book
-	Authors    []Author   `xml:"author"`     // Author(s) of a book
-	BookTitle  string     `xml:"book-title"` // Book title
-	Genres     []string   `xml:"genre"`      // Genre of a book
-	Annotation Annotation `xml:"annotation"` // Annotation of a book
-	Keywords   string     `xml:"keywords"`   // Any keywords of a book, intended for use in search engines
-	Date       string     `xml:"date"`       // Date a book was written, can be not exact, e.g. 1863-1867.
-	Lang       string     `xml:"lang"`       // Book language
-	Series     []Serie    `xml:"sequence"`   // Any sequences a book might be part of
-	CoverPage  CoverPage  `xml:"coverpage"`  // Any coverpage items, currently only images
+	Authors     []Author   `xml:"author"`     // Author(s) of a book
+	Translators []Author   `xml:"translator"` // Translator(s) of a book
+	BookTitle   string     `xml:"book-title"` // Book title
+	Genres      []string   `xml:"genre"`      // Genre of a book
+	Annotation  Annotation `xml:"annotation"` // Annotation of a book
+	Keywords    string     `xml:"keywords"`   // Any keywords of a book, intended for use in search engines
+	Date        string     `xml:"date"`       // Date a book was written, can be not exact, e.g. 1863-1867.
+	Lang        string     `xml:"lang"`       // Book language
+	SrcLang     string     `xml:"src-lang"`   // Original book language if the book is a translation
+	Series      []Serie    `xml:"sequence"`   // Any sequences a book might be part of
+	CoverPage   CoverPage  `xml:"coverpage"`  // Any coverpage items, currently only images
 }
 type PublishInfo struct { // Information about some paper/outher published document, that was used as a source of this xml document
-	Year   int     `xml:"year"`     // Year of the original (paper) publication
-	Series []Serie `xml:"sequence"` // Any sequences a book might be part of
+	Publisher string  `xml:"publisher"` // Publisher of the original (paper) publication
+	City      string  `xml:"city"`      // City of the original (paper) publication
+	Year      int     `xml:"year"`      // Year of the original (paper) publication
+	ISBN      string  `xml:"isbn"`      // ISBN of the original (paper) publication
+	Series    []Serie `xml:"sequence"`  // Any sequences a book might be part of
 }
 
 type Annotation struct { // Annotation of a book
@@ -82,7 +87,7 @@ type Author struct { // Author of a book
 
 type Serie struct { // Any sequences this book might be part of
 	Name   string `xml:"name,attr"`
-	Number int    `xml:"number,attr"`
+	Number string `xml:"number,attr"` // may be fractional or roman, e.g. 2.5 or III
 }
 
 type CoverPage struct { // Any coverpage items, currently only images
@@ -117,24 +122,48 @@ TokenLoop:
 				if err == nil {
 					fb.Description.TitleInfo = titleInfo
 				}
+			case "src-title-info":
+				srcTitleInfo, err := parseTitleInfo(d)
+				if err == nil {
+					fb.Description.SrcTitleInfo = srcTitleInfo
+				}
 			case "publish-info":
 				publishInfo, err := parsePublishInfo(d)
 				if err == nil {
 					fb.Description.PublishInfo = publishInfo
 				}
+			case "body":
+				fb.TextSample = parseTextSample(d)
+				break TokenLoop
 			default:
 				d.Skip()
 			}
-		case xml.EndElement:
-			switch t.Name.Local {
-			case "description":
-				break TokenLoop
-			}
 		}
 	}
 	return fb, nil
 }
 
+// parseTextSample returns up to parsers.TEXT_SAMPLE_LEN bytes of the body paragraphs text
+func parseTextSample(d *xml.Decoder) string {
+	var sample []byte
+	for len(sample) < parsers.TEXT_SAMPLE_LEN {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		if e, ok := tok.(xml.EndElement); ok && e.Name.Local == "body" {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			sample = append(sample, t...)
+		case xml.EndElement:
+			sample = append(sample, ' ')
+		}
+	}
+	return strings.TrimSpace(parsers.CollapseSpaces(string(sample)))
+}
+
 func parseTitleInfo(d *xml.Decoder) (TitleInfo, error) {
 	titleInfo := TitleInfo{}
 	for {
@@ -150,6 +179,11 @@ func parseTitleInfo(d *xml.Decoder) (TitleInfo, error) {
 				if err == nil {
 					titleInfo.Authors = append(titleInfo.Authors, author)
 				}
+			case "translator":
+				translator, err := parseAuthor(d)
+				if err == nil {
+					titleInfo.Translators = append(titleInfo.Translators, translator)
+				}
 			case "book-title":
 				titleInfo.BookTitle = getValue(d)
 			case "genre":
@@ -168,6 +202,8 @@ func parseTitleInfo(d *xml.Decoder) (TitleInfo, error) {
 				titleInfo.Date = getValue(d)
 			case "lang":
 				titleInfo.Lang = getValue(d)
+			case "src-lang":
+				titleInfo.SrcLang = getValue(d)
 			case "sequence":
 				serie, err := parseSerie(t)
 				if err == nil {
@@ -183,7 +219,7 @@ func parseTitleInfo(d *xml.Decoder) (TitleInfo, error) {
 			}
 		case xml.EndElement:
 			switch t.Name.Local {
-			case "title-info":
+			case "title-info", "src-title-info":
 				return titleInfo, nil
 			}
 		}
@@ -200,8 +236,14 @@ func parsePublishInfo(d *xml.Decoder) (PublishInfo, error) {
 		switch t := tok.(type) {
 		case xml.StartElement:
 			switch t.Name.Local {
+			case "publisher":
+				publishInfo.Publisher = getValue(d)
+			case "city":
+				publishInfo.City = getValue(d)
 			case "year":
 				publishInfo.Year, _ = strconv.Atoi(getValue(d))
+			case "isbn":
+				publishInfo.ISBN = getValue(d)
 			case "sequence":
 				serie, err := parseSerie(t)
 				if err == nil {
@@ -240,7 +282,7 @@ func parseAuthor(d *xml.Decoder) (Author, error) {
 			}
 		case xml.EndElement:
 			switch t.Name.Local {
-			case "author":
+			case "author", "translator":
 				return author, nil
 			}
 		}
@@ -277,10 +319,9 @@ func parseAnnotation(d *xml.Decoder) (Annotation, error) {
 func parseSerie(token xml.StartElement) (Serie, error) {
 	name := strings.Trim(getAttr(token, "name"), " \t\n\v\f\r\u0085\u00a0")
 	if name != "" {
-		number, _ := strconv.Atoi(getAttr(token, "number"))
 		return Serie{
 			Name:   name,
-			Number: number,
+			Number: strings.TrimSpace(getAttr(token, "number")),
 		}, nil
 	}
 	return Serie{}, ErrNoElement
@@ -339,16 +380,24 @@ func (fb *FB2) String() string {
 		"\n=========FB2===================\n",
 		"---------TitleInfo-------------\n",
 		fmt.Sprintf("Authors:    %#v\n", fb.Description.TitleInfo.Authors),
+		fmt.Sprintf("Translators: %#v\n", fb.Description.TitleInfo.Translators),
 		fmt.Sprintf("BookTitle:  %#v\n", fb.Description.TitleInfo.BookTitle),
 		fmt.Sprintf("Genres:    %#v\n", fb.Description.TitleInfo.Genres),
 		fmt.Sprintf("Annotation: %#v\n", fb.Description.TitleInfo.Annotation),
 		fmt.Sprintf("Keywords:   %#v\n", fb.Description.TitleInfo.Keywords),
 		fmt.Sprintf("Date:       %#v\n", fb.Description.TitleInfo.Date),
 		fmt.Sprintf("Lang:       %#v\n", fb.Description.TitleInfo.Lang),
+		fmt.Sprintf("SrcLang:    %#v\n", fb.Description.TitleInfo.SrcLang),
 		fmt.Sprintf("Series:     %#v\n", fb.Description.TitleInfo.Series),
 		fmt.Sprintf("CoverPage:  %#v\n", fb.Description.TitleInfo.CoverPage),
+		"---------SrcTitleInfo----------\n",
+		fmt.Sprintf("BookTitle:  %#v\n", fb.Description.SrcTitleInfo.BookTitle),
+		fmt.Sprintf("Lang:       %#v\n", fb.Description.SrcTitleInfo.Lang),
 		"---------PublishInfo-----------\n",
+		fmt.Sprintf("Publisher:  %#v\n", fb.Description.PublishInfo.Publisher),
+		fmt.Sprintf("City:       %#v\n", fb.Description.PublishInfo.City),
 		fmt.Sprintf("Year:       %#v\n", fb.Description.PublishInfo.Year),
+		fmt.Sprintf("ISBN:       %#v\n", fb.Description.PublishInfo.ISBN),
 		fmt.Sprintf("Series:     %#v\n", fb.Description.PublishInfo.Series),
 		"===============================\n",
 	)
@@ -400,21 +449,9 @@ func (b *Binary) String() string {
 }
 
 func GetCoverImage(stock string, book *model.Book) (image.Image, error) {
-	var rc io.ReadCloser
-	if book.Archive == "" {
-		rc, _ = os.Open(path.Join(stock, book.File))
-	} else {
-		zr, err := zip.OpenReader(path.Join(stock, book.Archive))
-		if err != nil {
-			return nil, err
-		}
-		defer zr.Close()
-		for _, file := range zr.File {
-			if file.Name == book.File {
-				rc, _ = file.Open()
-				break
-			}
-		}
+	rc, err := parsers.OpenBook(stock, book)
+	if err != nil {
+		return nil, err
 	}
 	defer rc.Close()
 	b, err := getCoverPageBinary(book.Cover, rc)
@@ -0,0 +1,395 @@
+package inpx
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/vinser/flibgolite/internal/core/model"
+	"github.com/vinser/flibgolite/internal/parsers"
+)
+
+// DefaultStructure is the .inp record fields order used when structure.info is absent
+const DefaultStructure = "AUTHOR;GENRE;TITLE;SERIES;SERNO;FILE;SIZE;LIBID;DEL;EXT;DATE;LANG;LIBRATE;KEYWORDS;"
+
+// ExportStructure is the .inp record fields order of exported catalogs, FOLDER keeps archive path
+const ExportStructure = "AUTHOR;GENRE;TITLE;SERIES;SERNO;FILE;SIZE;LIBID;DEL;EXT;DATE;INSNO;FOLDER;LANG;LIBRATE;KEYWORDS;"
+
+const (
+	fieldSeparator = "\x04"
+	listSeparator  = ":"
+)
+
+// valueReplacer removes separators of records and fields from exported values
+var valueReplacer = strings.NewReplacer(fieldSeparator, " ", "\r", " ", "\n", " ")
+
+// Catalog is an opened INPX file
+type Catalog struct {
+	zr     *zip.ReadCloser
+	Fields []string    // .inp record fields order
+	Inps   []*zip.File // .inp files, one per archive
+}
+
+// Open opens INPX catalog and reads its structure
+func Open(inpxPath string) (*Catalog, error) {
+	zr, err := zip.OpenReader(inpxPath)
+	if err != nil {
+		return nil, err
+	}
+	c := &Catalog{
+		zr:     zr,
+		Fields: splitList(DefaultStructure, ";"),
+	}
+	for _, f := range zr.File {
+		switch {
+		case strings.EqualFold(f.Name, "structure.info"):
+			s, err := readText(f)
+			if err != nil {
+				zr.Close()
+				return nil, fmt.Errorf("structure.info: %v", err)
+			}
+			c.Fields = splitList(strings.ToUpper(strings.TrimSpace(s)), ";")
+		case strings.EqualFold(path.Ext(f.Name), ".inp"):
+			c.Inps = append(c.Inps, f)
+		}
+	}
+	return c, nil
+}
+
+func (c *Catalog) Close() error {
+	return c.zr.Close()
+}
+
+// ReadInp calls fn for each record of .inp file
+func (c *Catalog) ReadInp(inp *zip.File, fn func(*Record) error) error {
+	rc, err := inp.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	archive := strings.TrimSuffix(path.Base(inp.Name), path.Ext(inp.Name)) + ".zip"
+	scanner := bufio.NewScanner(rc)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		r := NewRecord(c.Fields, strings.Split(line, fieldSeparator))
+		if r.Archive == "" {
+			r.Archive = archive
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func readText(f *zip.File) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	return string(b), err
+}
+
+// splitList splits s by sep dropping empty items
+func splitList(s, sep string) []string {
+	list := []string{}
+	for _, item := range strings.Split(s, sep) {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// Writer builds INPX catalog
+type Writer struct {
+	zw     *zip.Writer
+	inp    io.Writer
+	Fields []string // .inp record fields order
+}
+
+// NewWriter starts INPX catalog with ExportStructure records
+func NewWriter(w io.Writer) (*Writer, error) {
+	iw := &Writer{
+		zw:     zip.NewWriter(w),
+		Fields: splitList(ExportStructure, ";"),
+	}
+	if err := iw.WriteInfo("structure.info", ExportStructure); err != nil {
+		return nil, err
+	}
+	return iw, nil
+}
+
+// WriteInfo adds text file like collection.info or version.info to the catalog
+func (w *Writer) WriteInfo(name, text string) error {
+	f, err := w.zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, text)
+	return err
+}
+
+// StartInp starts new .inp file, following records are written to it
+func (w *Writer) StartInp(name string) error {
+	f, err := w.zw.Create(name)
+	if err != nil {
+		return err
+	}
+	w.inp = f
+	return nil
+}
+
+// WriteRecord adds the record to current .inp file
+func (w *Writer) WriteRecord(r *Record) error {
+	if w.inp == nil {
+		return fmt.Errorf("no .inp file started")
+	}
+	_, err := io.WriteString(w.inp, strings.Join(r.Values(w.Fields), fieldSeparator)+fieldSeparator+"\r\n")
+	return err
+}
+
+func (w *Writer) Close() error {
+	return w.zw.Close()
+}
+
+// Record ----------------------------------
+
+// Record is a book description from .inp file
+type Record struct {
+	Authors  [][]string // Last, first and middle names of each author
+	Genres   []string
+	Title    string
+	Series   string
+	SerNo    string
+	File     string // File name without extension
+	Size     int64
+	LibID    string
+	Deleted  bool
+	Ext      string
+	Date     string // Date the book was added to the library
+	Year     string
+	Lang     string
+	Keywords string
+	Archive  string // Archive file name (FOLDER field)
+}
+
+// NewRecord makes a record from values ordered by fields
+func NewRecord(fields, values []string) *Record {
+	r := &Record{}
+	for i, field := range fields {
+		if i >= len(values) {
+			break
+		}
+		v := strings.TrimSpace(values[i])
+		switch field {
+		case "AUTHOR":
+			for _, a := range splitList(v, listSeparator) {
+				r.Authors = append(r.Authors, strings.Split(a, ","))
+			}
+		case "GENRE":
+			r.Genres = splitList(v, listSeparator)
+		case "TITLE":
+			r.Title = v
+		case "SERIES":
+			r.Series = v
+		case "SERNO":
+			r.SerNo = v
+		case "FILE":
+			r.File = v
+		case "SIZE":
+			r.Size, _ = strconv.ParseInt(v, 10, 64)
+		case "LIBID":
+			r.LibID = v
+		case "DEL":
+			r.Deleted = v == "1"
+		case "EXT":
+			r.Ext = strings.ToLower(v)
+		case "DATE":
+			r.Date = v
+		case "YEAR":
+			r.Year = v
+		case "LANG":
+			r.Lang = strings.ToLower(v)
+		case "KEYWORDS":
+			r.Keywords = v
+		case "FOLDER":
+			r.Archive = v
+		}
+	}
+	return r
+}
+
+// Values returns record values ordered by fields
+func (r *Record) Values(fields []string) []string {
+	values := make([]string, len(fields))
+	for i, field := range fields {
+		switch field {
+		case "AUTHOR":
+			for _, a := range r.Authors {
+				values[i] += strings.Join(a, ",") + listSeparator
+			}
+		case "GENRE":
+			for _, g := range r.Genres {
+				values[i] += g + listSeparator
+			}
+		case "TITLE":
+			values[i] = r.Title
+		case "SERIES":
+			values[i] = r.Series
+		case "SERNO":
+			values[i] = r.SerNo
+		case "FILE":
+			values[i] = r.File
+		case "SIZE":
+			values[i] = strconv.FormatInt(r.Size, 10)
+		case "LIBID":
+			values[i] = r.LibID
+		case "DEL":
+			values[i] = "0"
+			if r.Deleted {
+				values[i] = "1"
+			}
+		case "EXT":
+			values[i] = r.Ext
+		case "DATE":
+			values[i] = r.Date
+		case "YEAR":
+			values[i] = r.Year
+		case "LANG":
+			values[i] = r.Lang
+		case "KEYWORDS":
+			values[i] = r.Keywords
+		case "FOLDER":
+			values[i] = r.Archive
+		}
+		values[i] = valueReplacer.Replace(values[i])
+	}
+	return values
+}
+
+// FileName returns the book file name inside the archive
+func (r *Record) FileName() string {
+	if r.Ext == "" {
+		return r.File
+	}
+	return r.File + "." + r.Ext
+}
+
+func (r *Record) GetFormat() string {
+	return r.Ext
+}
+
+func (r *Record) GetTitle() string {
+	return r.Title
+}
+
+func (r *Record) GetSort() string {
+	return parsers.GetSortTitle(r.Title, parsers.GetLanguageTag(r.Lang))
+}
+
+func (r *Record) GetYear() string {
+	return parsers.PickYear(r.Year)
+}
+
+// GetPlot returns nothing, annotation is loaded from the book file later
+func (r *Record) GetPlot() string {
+	return ""
+}
+
+// GetCover returns nothing, cover is loaded from the book file later
+func (r *Record) GetCover() string {
+	return ""
+}
+
+func (r *Record) GetLanguage() *model.Language {
+	return parsers.GetLanguage(r.Lang)
+}
+
+func (r *Record) GetAuthors() []*model.Author {
+	authors := make([]*model.Author, 0, len(r.Authors))
+	for _, names := range r.Authors {
+		for len(names) < 3 {
+			names = append(names, "")
+		}
+		author := parsers.AuthorByFullName(fmt.Sprintf("%s %s %s", names[1], names[2], names[0]))
+		if author.Sort != "" {
+			authors = append(authors, author)
+		}
+	}
+	return parsers.AuthorsOrUnknown(authors)
+}
+
+func (r *Record) GetGenres() []string {
+	return r.Genres
+}
+
+func (r *Record) GetKeywords() string {
+	return r.Keywords
+}
+
+func (r *Record) GetSerie() *model.Serie {
+	if r.Series == "" {
+		return &model.Serie{}
+	}
+	return &model.Serie{Name: parsers.Title(r.Series, r.Lang)}
+}
+
+func (r *Record) GetSerieNumber() int {
+	n, _ := strconv.Atoi(r.SerNo)
+	return n
+}
+
+func (r *Record) GetISBN() string {
+	return ""
+}
+
+func (r *Record) GetPublisher() string {
+	return ""
+}
+
+func (r *Record) GetCity() string {
+	return ""
+}
+
+func (r *Record) GetSrcLanguage() string {
+	return ""
+}
+
+func (r *Record) GetSrcTitle() string {
+	return ""
+}
+
+func (r *Record) GetSeries() []*model.BookSerie {
+	if r.Series == "" {
+		return []*model.BookSerie{}
+	}
+	num := strings.TrimSpace(r.SerNo)
+	if num == "0" {
+		num = ""
+	}
+	return []*model.BookSerie{{Serie: *r.GetSerie(), Number: num}}
+}
+
+func (r *Record) String() string {
+	return "" + fmt.Sprint(
+		"\n=========INP===================\n",
+		fmt.Sprintf("Authors:    %#v\n", r.Authors),
+		fmt.Sprintf("Genres:     %#v\n", r.Genres),
+		fmt.Sprintf("Title:      %#v\n", r.Title),
+		fmt.Sprintf("Series:     %#v #%s\n", r.Series, r.SerNo),
+		fmt.Sprintf("File:       %#v in %#v\n", r.FileName(), r.Archive),
+		fmt.Sprintf("Lang:       %#v\n", r.Lang),
+		"===============================\n",
+	)
+}
@@ -0,0 +1,157 @@
+package inpx
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteRead(t *testing.T) {
+	var testInps = []struct {
+		name    string
+		records []*Record
+	}{
+		{
+			"fb2-000001-000002.inp",
+			[]*Record{
+				{
+					Authors: [][]string{{"Толстой", "Лев", "Николаевич"}, {"Doe", "Jane", ""}},
+					Genres:  []string{"prose_rus_classic", "prose_history"},
+					Title:   "Война и мир",
+					Series:  "Собрание сочинений",
+					SerNo:   "5",
+					File:    "000001",
+					Size:    123456,
+					LibID:   "1",
+					Ext:     "fb2",
+					Date:    "2024-01-31",
+					Lang:    "ru",
+					Archive: "stock/fb2-000001-000002.zip",
+				},
+				{
+					Authors:  [][]string{{"Roe", "John", ""}},
+					Genres:   []string{"sf"},
+					Title:    "Title with\x04separators\r\nremoved",
+					File:     "book name",
+					Size:     1,
+					LibID:    "2",
+					Ext:      "epub",
+					Date:     "2024-02-01",
+					Lang:     "en",
+					Keywords: "space, robots",
+					Archive:  "stock/sub/fb2-000001-000002.zip",
+				},
+			},
+		},
+		{
+			"sub_other.inp",
+			[]*Record{
+				{Genres: []string{}, Title: "No authors", File: "x", Ext: "pdf", LibID: "3", Archive: "stock/sub/other.zip"},
+			},
+		},
+	}
+
+	inpxPath := filepath.Join(t.TempDir(), "library.inpx")
+	f, err := os.Create(inpxPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, inp := range testInps {
+		if err := w.StartInp(inp.name); err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range inp.records {
+			if err := w.WriteRecord(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.WriteInfo("collection.info", "Library\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	c, err := Open(inpxPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if fields := strings.Join(c.Fields, ";") + ";"; fields != ExportStructure {
+		t.Errorf("Expecting fields %s, got: %s", ExportStructure, fields)
+	}
+	if len(c.Inps) != len(testInps) {
+		t.Fatalf("Expecting %d .inp files, got: %d", len(testInps), len(c.Inps))
+	}
+	for i, inp := range testInps {
+		read := []*Record{}
+		err := c.ReadInp(c.Inps[i], func(r *Record) error {
+			read = append(read, r)
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%s: %v", inp.name, err)
+			continue
+		}
+		if len(read) != len(inp.records) {
+			t.Errorf("%s: expecting %d records, got: %d", inp.name, len(inp.records), len(read))
+			continue
+		}
+		for j, r := range inp.records {
+			want := *r
+			want.Title = valueReplacer.Replace(want.Title)
+			if !reflect.DeepEqual(read[j], &want) {
+				t.Errorf("%s: expecting record %+v, got: %+v", inp.name, want, *read[j])
+			}
+		}
+	}
+}
+
+func TestDefaultStructure(t *testing.T) {
+	inpxPath := filepath.Join(t.TempDir(), "library.inpx")
+	f, err := os.Create(inpxPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	inp, err := zw.Create("fb2-000001-000002.inp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inp.Write([]byte("Толстой,Лев,Николаевич:\x04prose_rus_classic:\x04Война и мир\x04Собрание\x040\x04000001\x04123\x041\x040\x04FB2\x042024-01-31\x04RU\x045\x04\x04\r\n\r\n"))
+	zw.Close()
+	f.Close()
+
+	c, err := Open(inpxPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	records := []*Record{}
+	c.ReadInp(c.Inps[0], func(r *Record) error {
+		records = append(records, r)
+		return nil
+	})
+	if len(records) != 1 {
+		t.Fatalf("Expecting 1 record, got: %d", len(records))
+	}
+	r := records[0]
+	if r.Archive != "fb2-000001-000002.zip" || r.FileName() != "000001.fb2" || r.GetLanguage().Code != "ru" {
+		t.Errorf("Expecting 000001.fb2 in fb2-000001-000002.zip of language ru, got: %s in %s of %s", r.FileName(), r.Archive, r.Lang)
+	}
+	if authors := r.GetAuthors(); len(authors) != 1 || authors[0].Name != "Лев Николаевич Толстой" {
+		t.Errorf("Expecting author Лев Николаевич Толстой, got: %+v", authors)
+	}
+	if series := r.GetSeries(); len(series) != 1 || series[0].Name != "Собрание" || series[0].Number != "" {
+		t.Errorf("Expecting series Собрание without number, got: %+v", series)
+	}
+}
@@ -0,0 +1,221 @@
+package mobi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/vinser/flibgolite/internal/core/model"
+	"github.com/vinser/flibgolite/internal/parsers"
+)
+
+type MOBI struct {
+	Header      *Header
+	Format      string   // File extension: mobi, azw or azw3
+	Title       string   // Updated title or full name
+	Authors     []string // EXTH authors
+	Publisher   string   // EXTH publisher
+	ISBN        string   // EXTH ISBN
+	Description string   // EXTH description
+	Subjects    []string // EXTH subjects
+	PublishDate string   // EXTH publishing date
+	Language    string   // EXTH language or header locale
+	CoverRecord int      // Cover image record index, 0 if not found
+	CoverExt    string   // Cover image extension
+}
+
+// ParseMOBI reads MOBI/AZW3 metadata from the PalmDB header, the MOBI header and EXTH records
+func ParseMOBI(r io.Reader, fileName string) (*MOBI, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	db, err := newPalmDB(data)
+	if err != nil {
+		return nil, err
+	}
+	h, exth, err := parseHeader(db.record(0))
+	if err != nil {
+		return nil, err
+	}
+	m := &MOBI{
+		Header: h,
+		Format: "mobi",
+	}
+	switch ext := strings.ToLower(strings.TrimPrefix(path.Ext(fileName), ".")); ext {
+	case "azw", "azw3":
+		m.Format = ext
+	}
+	text := func(t uint32) string {
+		if len(exth[t]) == 0 {
+			return ""
+		}
+		return h.decodeText(exth[t][0])
+	}
+	m.Title = text(exthUpdatedTitle)
+	if m.Title == "" {
+		m.Title = h.FullName
+	}
+	if m.Title == "" {
+		m.Title = strings.ReplaceAll(db.Name, "_", " ")
+	}
+	for _, a := range exth[exthAuthor] {
+		for _, name := range strings.Split(h.decodeText(a), "&") {
+			if name = strings.TrimSpace(name); name != "" {
+				m.Authors = append(m.Authors, name)
+			}
+		}
+	}
+	for _, s := range exth[exthSubject] {
+		m.Subjects = append(m.Subjects, h.decodeText(s))
+	}
+	m.Publisher = text(exthPublisher)
+	m.ISBN = text(exthISBN)
+	m.Description = text(exthDescription)
+	m.PublishDate = text(exthPublishDate)
+	m.Language = text(exthLanguage)
+	if m.Language == "" {
+		m.Language = h.language()
+	}
+	if h.FirstImageIndex != noIndex {
+		for _, t := range []uint32{exthCoverOffset, exthThumbOffset} {
+			if len(exth[t]) == 0 || len(exth[t][0]) < 4 {
+				continue
+			}
+			offset := binary.BigEndian.Uint32(exth[t][0])
+			if offset == noIndex {
+				continue
+			}
+			i := int(h.FirstImageIndex + offset)
+			if ext := imageExt(db.record(i)); ext != "" {
+				m.CoverRecord, m.CoverExt = i, ext
+				break
+			}
+		}
+	}
+	return m, nil
+}
+
+func (m *MOBI) GetFormat() string {
+	return m.Format
+}
+
+func (m *MOBI) GetTitle() string {
+	return m.Title
+}
+
+func (m *MOBI) GetSort() string {
+	return parsers.GetSortTitle(m.Title, parsers.GetLanguageTag(m.Language))
+}
+
+func (m *MOBI) GetYear() string {
+	return parsers.PickYear(m.PublishDate)
+}
+
+func (m *MOBI) GetPlot() string {
+	return parsers.StripHTMLTags(m.Description)
+}
+
+func (m *MOBI) GetCover() string {
+	if m.CoverRecord == 0 {
+		return ""
+	}
+	return strconv.Itoa(m.CoverRecord) + m.CoverExt
+}
+
+func (m *MOBI) GetLanguage() *model.Language {
+	return parsers.GetLanguage(m.Language)
+}
+
+func (m *MOBI) GetAuthors() []*model.Author {
+	authors := make([]*model.Author, 0, len(m.Authors))
+	for _, a := range m.Authors {
+		author := parsers.AuthorByFullName(a)
+		if author.Sort != "" {
+			authors = append(authors, author)
+		}
+	}
+	return parsers.AuthorsOrUnknown(authors)
+}
+
+func (m *MOBI) GetGenres() []string {
+	return strings.FieldsFunc(strings.Join(m.Subjects, " "), parsers.IsSeparator)
+}
+
+func (m *MOBI) GetKeywords() string {
+	return strings.Join(strings.FieldsFunc(strings.Join(m.Subjects, " "), parsers.IsSeparator), " ")
+}
+
+func (m *MOBI) GetSerie() *model.Serie {
+	return &model.Serie{}
+}
+
+func (m *MOBI) GetSerieNumber() int {
+	return 0
+}
+
+func (m *MOBI) GetISBN() string {
+	return parsers.ISBNs(m.ISBN)
+}
+
+func (m *MOBI) GetPublisher() string {
+	return strings.TrimSpace(m.Publisher)
+}
+
+func (m *MOBI) GetCity() string {
+	return ""
+}
+
+func (m *MOBI) GetSrcLanguage() string {
+	return ""
+}
+
+func (m *MOBI) GetSrcTitle() string {
+	return ""
+}
+
+func (m *MOBI) String() string {
+	return "" + fmt.Sprint(
+		"\n=========MOBI==================\n",
+		fmt.Sprintf("Format:      %#v\n", m.Format),
+		fmt.Sprintf("Title:       %#v\n", m.Title),
+		fmt.Sprintf("Authors:     %#v\n", m.Authors),
+		fmt.Sprintf("Publisher:   %#v\n", m.Publisher),
+		fmt.Sprintf("ISBN:        %#v\n", m.ISBN),
+		fmt.Sprintf("Subjects:    %#v\n", m.Subjects),
+		fmt.Sprintf("PublishDate: %#v\n", m.PublishDate),
+		fmt.Sprintf("Language:    %#v\n", m.Language),
+		fmt.Sprintf("Cover:       %#v\n", m.GetCover()),
+		"===============================\n",
+	)
+}
+
+// GetCoverImage decodes the embedded image record stored in the book cover
+func GetCoverImage(stock string, book *model.Book) (image.Image, error) {
+	i, err := strconv.Atoi(strings.TrimSuffix(book.Cover, path.Ext(book.Cover)))
+	if err != nil {
+		return nil, fmt.Errorf("wrong MOBI cover reference %s", book.Cover)
+	}
+	rc, err := parsers.OpenBook(stock, book)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	db, err := newPalmDB(data)
+	if err != nil {
+		return nil, err
+	}
+	rec := db.record(i)
+	if rec == nil {
+		return nil, fmt.Errorf("cover record %d not found in %s", i, book.File)
+	}
+	return decodeImage(rec)
+}
@@ -0,0 +1,242 @@
+package mobi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vinser/flibgolite/internal/core/model"
+	"github.com/vinser/flibgolite/internal/parsers"
+)
+
+type exthRecord struct {
+	t    uint32
+	data string
+}
+
+// book describes MOBI file to be assembled, images are the records following the text record
+type book struct {
+	name     string // PalmDB name
+	encoding uint32
+	locale   uint32
+	fullName string
+	exth     []exthRecord
+	images   [][]byte
+}
+
+func u32(v uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, v)
+}
+
+// mobiData assembles PalmDB file of MOBI header record, text record and image records
+func mobiData(b book) []byte {
+	const headerLen = 0xe8
+	rec0 := make([]byte, palmDocHeaderLen+headerLen)
+	copy(rec0[16:], "MOBI")
+	copy(rec0[20:], u32(headerLen))
+	copy(rec0[28:], u32(b.encoding))
+	copy(rec0[36:], u32(6))
+	copy(rec0[92:], u32(b.locale))
+	copy(rec0[108:], u32(noIndex))
+	if len(b.images) > 0 {
+		copy(rec0[108:], u32(2))
+	}
+	if b.exth != nil {
+		copy(rec0[128:], u32(0x40))
+		exth := &bytes.Buffer{}
+		for _, r := range b.exth {
+			exth.Write(u32(r.t))
+			exth.Write(u32(uint32(8 + len(r.data))))
+			exth.WriteString(r.data)
+		}
+		rec0 = append(rec0, "EXTH"...)
+		rec0 = append(rec0, u32(uint32(12+exth.Len()))...)
+		rec0 = append(rec0, u32(uint32(len(b.exth)))...)
+		rec0 = append(rec0, exth.Bytes()...)
+	}
+	copy(rec0[84:], u32(uint32(len(rec0))))
+	copy(rec0[88:], u32(uint32(len(b.fullName))))
+	rec0 = append(rec0, b.fullName...)
+
+	records := append([][]byte{rec0, []byte("text")}, b.images...)
+	header := make([]byte, palmDBHeaderLen+8*len(records))
+	copy(header, b.name)
+	copy(header[60:], "BOOKMOBI")
+	binary.BigEndian.PutUint16(header[76:], uint16(len(records)))
+	offset := len(header)
+	for i, r := range records {
+		copy(header[palmDBHeaderLen+8*i:], u32(uint32(offset)))
+		offset += len(r)
+	}
+	return append(header, bytes.Join(records, nil)...)
+}
+
+func pngImage(t *testing.T) []byte {
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, image.NewGray(image.Rect(0, 0, 3, 2))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseMOBI(t *testing.T) {
+	cover := pngImage(t)
+	var testBooks = []struct {
+		name      string
+		file      string
+		data      []byte
+		title     string
+		authors   string
+		lang      string
+		year      string
+		plot      string
+		isbn      string
+		publisher string
+		cover     string
+		format    string
+		err       error
+	}{
+		{
+			"exth metadata",
+			"book.mobi",
+			mobiData(book{name: "Book", encoding: 65001, locale: 0x09, fullName: "Full Name",
+				exth: []exthRecord{
+					{exthUpdatedTitle, "Updated Title"},
+					{exthAuthor, "Jane Doe & John Roe"},
+					{exthPublisher, " Publisher "},
+					{exthISBN, "978-0-306-40615-7"},
+					{exthDescription, "<p>About the <b>book</b></p>"},
+					{exthSubject, "sf; fantasy"},
+					{exthPublishDate, "2019-05-01T00:00:00+00:00"},
+					{exthLanguage, "ru"},
+					{exthCoverOffset, string(u32(1))},
+				},
+				images: [][]byte{[]byte("not an image"), cover},
+			}),
+			"Updated Title", "DOE, JANE; ROE, JOHN", "ru", "2019", "About the book", "9780306406157", "Publisher", "3.png", "mobi", nil,
+		},
+		{
+			"full name and locale",
+			"book.azw3",
+			mobiData(book{name: "Book", encoding: 65001, locale: 0x0419, fullName: "Полное имя", exth: []exthRecord{}}),
+			"Полное имя", parsers.NO_AUTHOR, "ru", "", "", "", "", "", "azw3", nil,
+		},
+		{
+			"palm database name",
+			"book.azw",
+			mobiData(book{name: "Palm_Book_Name", encoding: 65001}),
+			"Palm Book Name", parsers.NO_AUTHOR, "en", "", "", "", "", "", "azw", nil,
+		},
+		{
+			"windows-1252 text",
+			"book.mobi",
+			mobiData(book{name: "Book", encoding: 1252, fullName: "Caf\xe9", exth: []exthRecord{{exthAuthor, "Ren\xe9e Dupont"}}}),
+			"Café", "DUPONT, RENÉE", "en", "", "", "", "", "", "mobi", nil,
+		},
+		{
+			"cover offset out of records",
+			"book.mobi",
+			mobiData(book{name: "Book", encoding: 65001, fullName: "Title", exth: []exthRecord{{exthCoverOffset, string(u32(7))}, {exthThumbOffset, string(u32(0))}}, images: [][]byte{cover}}),
+			"Title", parsers.NO_AUTHOR, "en", "", "", "", "", "2.png", "mobi", nil,
+		},
+		{
+			"exth records beyond header",
+			"book.mobi",
+			append(mobiData(book{name: "Book", encoding: 65001, fullName: "Title"}), "EXTH\x00\x00\x00\xff\x00\x00\xff\xff"...),
+			"Title", parsers.NO_AUTHOR, "en", "", "", "", "", "", "mobi", nil,
+		},
+		{"not palm database", "book.mobi", []byte("BOOKMOBI"), "", "", "", "", "", "", "", "", "", ErrNotMOBI},
+		{"no records", "book.mobi", mobiData(book{name: "Book"})[:palmDBHeaderLen], "", "", "", "", "", "", "", "", "", ErrNotMOBI},
+		{"not mobi", "book.mobi", bytes.Replace(mobiData(book{name: "Book"}), []byte("BOOKMOBI"), []byte("TEXtREAd"), 1), "", "", "", "", "", "", "", "", "", ErrNotMOBI},
+		{"empty", "book.mobi", nil, "", "", "", "", "", "", "", "", "", ErrNotMOBI},
+	}
+
+	for _, b := range testBooks {
+		m, err := ParseMOBI(bytes.NewReader(b.data), b.file)
+		if !errors.Is(err, b.err) {
+			t.Errorf("%s: expecting error %v, got: %v", b.name, b.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if title := m.GetTitle(); title != b.title {
+			t.Errorf("%s: expecting title %q, got: %q", b.name, b.title, title)
+		}
+		authors := []string{}
+		for _, a := range m.GetAuthors() {
+			authors = append(authors, a.Sort)
+		}
+		if s := strings.Join(authors, "; "); s != b.authors {
+			t.Errorf("%s: expecting authors %q, got: %q", b.name, b.authors, s)
+		}
+		if lang := m.GetLanguage().Code; lang != b.lang {
+			t.Errorf("%s: expecting language %q, got: %q", b.name, b.lang, lang)
+		}
+		if year := m.GetYear(); year != b.year {
+			t.Errorf("%s: expecting year %q, got: %q", b.name, b.year, year)
+		}
+		if plot := m.GetPlot(); plot != b.plot {
+			t.Errorf("%s: expecting plot %q, got: %q", b.name, b.plot, plot)
+		}
+		if isbn := m.GetISBN(); isbn != b.isbn {
+			t.Errorf("%s: expecting ISBN %q, got: %q", b.name, b.isbn, isbn)
+		}
+		if publisher := m.GetPublisher(); publisher != b.publisher {
+			t.Errorf("%s: expecting publisher %q, got: %q", b.name, b.publisher, publisher)
+		}
+		if cover := m.GetCover(); cover != b.cover {
+			t.Errorf("%s: expecting cover %q, got: %q", b.name, b.cover, cover)
+		}
+		if format := m.GetFormat(); format != b.format {
+			t.Errorf("%s: expecting format %q, got: %q", b.name, b.format, format)
+		}
+	}
+}
+
+func TestGetCoverImage(t *testing.T) {
+	data := mobiData(book{name: "Book", encoding: 65001, fullName: "Title", images: [][]byte{pngImage(t), []byte("not an image")}})
+	stock := t.TempDir()
+	if err := os.WriteFile(filepath.Join(stock, "book.mobi"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var testCovers = []struct {
+		cover string
+		err   bool
+	}{
+		{"2.png", false},
+		{"3.jpg", true}, // not an image
+		{"9.png", true},
+		{"x.png", true},
+	}
+
+	for _, c := range testCovers {
+		img, err := GetCoverImage(stock, &model.Book{File: "book.mobi", Cover: c.cover})
+		if (err != nil) != c.err {
+			t.Errorf("%s: expecting error %v, got: %v", c.cover, c.err, err)
+			continue
+		}
+		if err == nil && (img.Bounds().Dx() != 3 || img.Bounds().Dy() != 2) {
+			t.Errorf("%s: expecting 3x2 image, got: %v", c.cover, img.Bounds())
+		}
+	}
+}
+
+func FuzzParseMOBI(f *testing.F) {
+	f.Add(mobiData(book{name: "Book", encoding: 65001, fullName: "Title", exth: []exthRecord{{exthAuthor, "Author"}, {exthCoverOffset, string(u32(0))}}, images: [][]byte{{0xff, 0xd8, 0xff}}}))
+	f.Add(mobiData(book{name: "Book", encoding: 1252}))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if m, err := ParseMOBI(bytes.NewReader(data), "book.mobi"); err == nil {
+			m.GetTitle()
+			m.GetAuthors()
+			m.GetPlot()
+		}
+	})
+}
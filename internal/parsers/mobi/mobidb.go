@@ -0,0 +1,194 @@
+package mobi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"strings"
+
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// PalmDB ----------------------------------
+
+const (
+	palmDBHeaderLen  = 78
+	palmDocHeaderLen = 16
+	noIndex          = 0xffffffff
+)
+
+var ErrNotMOBI = errors.New("not a MOBI file")
+
+// palmDB keeps Palm database records
+type palmDB struct {
+	Name    string
+	Type    string
+	Creator string
+	records [][]byte
+}
+
+func newPalmDB(data []byte) (*palmDB, error) {
+	if len(data) < palmDBHeaderLen {
+		return nil, ErrNotMOBI
+	}
+	db := &palmDB{
+		Name:    string(bytes.TrimRight(data[:32], "\x00")),
+		Type:    string(data[60:64]),
+		Creator: string(data[64:68]),
+	}
+	if db.Type+db.Creator != "BOOKMOBI" {
+		return nil, ErrNotMOBI
+	}
+	n := int(binary.BigEndian.Uint16(data[76:78]))
+	if palmDBHeaderLen+8*n > len(data) {
+		return nil, ErrNotMOBI
+	}
+	offsets := make([]int, n+1)
+	for i := 0; i < n; i++ {
+		offsets[i] = int(binary.BigEndian.Uint32(data[palmDBHeaderLen+8*i:]))
+	}
+	offsets[n] = len(data)
+	db.records = make([][]byte, n)
+	for i := 0; i < n; i++ {
+		start, end := offsets[i], offsets[i+1]
+		if start > end || end > len(data) {
+			return nil, fmt.Errorf("record %d has wrong offset", i)
+		}
+		db.records[i] = data[start:end]
+	}
+	if n == 0 {
+		return nil, ErrNotMOBI
+	}
+	return db, nil
+}
+
+func (db *palmDB) record(i int) []byte {
+	if i < 0 || i >= len(db.records) {
+		return nil
+	}
+	return db.records[i]
+}
+
+// MOBI header ----------------------------------
+
+// Header is a part of MOBI header used for cataloguing
+type Header struct {
+	Version         uint32
+	TextEncoding    uint32
+	FullName        string
+	Locale          uint32
+	FirstImageIndex uint32
+	HasEXTH         bool
+}
+
+// EXTH record types
+const (
+	exthAuthor       = 100
+	exthPublisher    = 101
+	exthDescription  = 103
+	exthISBN         = 104
+	exthSubject      = 105
+	exthPublishDate  = 106
+	exthCoverOffset  = 201
+	exthThumbOffset  = 202
+	exthUpdatedTitle = 503
+	exthLanguage     = 524
+)
+
+func parseHeader(rec0 []byte) (*Header, map[uint32][][]byte, error) {
+	if len(rec0) < palmDocHeaderLen+24 || string(rec0[16:20]) != "MOBI" {
+		return nil, nil, ErrNotMOBI
+	}
+	u32 := func(offset int) uint32 {
+		if offset+4 > len(rec0) {
+			return 0
+		}
+		return binary.BigEndian.Uint32(rec0[offset:])
+	}
+	headerLen := int(u32(20))
+	h := &Header{
+		TextEncoding:    u32(28),
+		Version:         u32(36),
+		Locale:          u32(92),
+		FirstImageIndex: noIndex,
+	}
+	if headerLen >= 0x5c {
+		h.FirstImageIndex = u32(108)
+	}
+	if nameOffset, nameLen := int(u32(84)), int(u32(88)); nameOffset > 0 && nameOffset+nameLen <= len(rec0) {
+		h.FullName = h.decodeText(rec0[nameOffset : nameOffset+nameLen])
+	}
+	h.HasEXTH = u32(128)&0x40 != 0
+	exth := map[uint32][][]byte{}
+	if h.HasEXTH {
+		exth = parseEXTH(rec0[min(palmDocHeaderLen+headerLen, len(rec0)):])
+	}
+	return h, exth, nil
+}
+
+// parseEXTH returns EXTH records data by record type
+func parseEXTH(data []byte) map[uint32][][]byte {
+	exth := map[uint32][][]byte{}
+	if len(data) < 12 || string(data[:4]) != "EXTH" {
+		return exth
+	}
+	count := int(binary.BigEndian.Uint32(data[8:12]))
+	pos := 12
+	for i := 0; i < count && pos+8 <= len(data); i++ {
+		recType := binary.BigEndian.Uint32(data[pos:])
+		recLen := int(binary.BigEndian.Uint32(data[pos+4:]))
+		if recLen < 8 || pos+recLen > len(data) {
+			break
+		}
+		exth[recType] = append(exth[recType], data[pos+8:pos+recLen])
+		pos += recLen
+	}
+	return exth
+}
+
+// decodeText converts MOBI text to UTF-8 string
+func (h *Header) decodeText(b []byte) string {
+	if h.TextEncoding == 1252 {
+		if s, err := charmap.Windows1252.NewDecoder().Bytes(b); err == nil {
+			b = s
+		}
+	}
+	return strings.TrimSpace(strings.ReplaceAll(string(b), "\x00", ""))
+}
+
+// localeLanguages maps MOBI (Windows LCID) primary language identifiers to language codes
+var localeLanguages = map[uint32]string{
+	0x01: "ar", 0x02: "bg", 0x03: "ca", 0x04: "zh", 0x05: "cs", 0x06: "da", 0x07: "de", 0x08: "el",
+	0x09: "en", 0x0a: "es", 0x0b: "fi", 0x0c: "fr", 0x0d: "he", 0x0e: "hu", 0x0f: "is", 0x10: "it",
+	0x11: "ja", 0x12: "ko", 0x13: "nl", 0x14: "no", 0x15: "pl", 0x16: "pt", 0x18: "ro", 0x19: "ru",
+	0x1a: "hr", 0x1b: "sk", 0x1d: "sv", 0x1f: "tr", 0x22: "uk", 0x23: "be", 0x24: "sl", 0x25: "et",
+	0x26: "lv", 0x27: "lt", 0x2a: "vi", 0x37: "ka", 0x3f: "kk",
+}
+
+func (h *Header) language() string {
+	return localeLanguages[h.Locale&0xff]
+}
+
+// imageExt detects image format by its signature
+func imageExt(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte{0xff, 0xd8, 0xff}):
+		return ".jpg"
+	case bytes.HasPrefix(b, []byte("\x89PNG")):
+		return ".png"
+	case bytes.HasPrefix(b, []byte("GIF8")):
+		return ".gif"
+	}
+	return ""
+}
+
+func decodeImage(b []byte) (image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(b))
+	return img, err
+}
@@ -369,6 +369,17 @@ func AuthorByFullName(fullName string) *model.Author {
 	return author
 }
 
+// NO_AUTHOR is the name and sort name of the author of books without known authors
+const NO_AUTHOR = "[author not specified]"
+
+// AuthorsOrUnknown returns the authors, the only unknown author if there are none
+func AuthorsOrUnknown(authors []*model.Author) []*model.Author {
+	if len(authors) == 0 {
+		authors = append(authors, &model.Author{Name: NO_AUTHOR, Sort: NO_AUTHOR})
+	}
+	return authors
+}
+
 var reDelimGlued = regexp.MustCompile(`\p{Ll}\p{Lu}|[^ ]\(|,[^ \r\n]|\.[^ ,\r\n]|\)[^ ,\r\n]`)
 
 // DelimitGluedName changes "CamelCase" to "Camel Case".
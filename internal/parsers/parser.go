@@ -1,9 +1,19 @@
 package parsers
 
 import (
+	"archive/zip"
 	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/vinser/flibgolite/internal/core/model"
 	"golang.org/x/net/html"
@@ -25,6 +35,257 @@ type Parser interface {
 	GetKeywords() string
 	GetSerie() *model.Serie
 	GetSerieNumber() int
+	GetISBN() string
+	GetPublisher() string
+	GetCity() string
+	GetSrcLanguage() string
+	GetSrcTitle() string
+}
+
+// TEXT_SAMPLE_LEN is the maximum length in bytes of the book text beginning used to identify the book language
+const TEXT_SAMPLE_LEN = 2000
+
+// TextSampler is implemented by parsers that read the beginning of the book text
+type TextSampler interface {
+	GetTextSample() string
+}
+
+// SeriesLister is implemented by parsers that read all the book series with their roles and text numbers
+type SeriesLister interface {
+	GetSeries() []*model.BookSerie
+}
+
+// Series returns all the book series, the series of parsers that do not list them is the main one
+func Series(p Parser) []*model.BookSerie {
+	if sl, ok := p.(SeriesLister); ok {
+		return sl.GetSeries()
+	}
+	serie := p.GetSerie()
+	if serie.Name == "" {
+		return []*model.BookSerie{}
+	}
+	bs := &model.BookSerie{Serie: *serie}
+	if n := p.GetSerieNumber(); n > 0 {
+		bs.Number = strconv.Itoa(n)
+	}
+	return []*model.BookSerie{bs}
+}
+
+// ContributorsLister is implemented by parsers that read translators, illustrators and editors of the book
+type ContributorsLister interface {
+	GetContributors() []*model.Contributor
+}
+
+// Contributors returns the book contributors, none for parsers that do not read them
+func Contributors(p Parser) []*model.Contributor {
+	if cl, ok := p.(ContributorsLister); ok {
+		return cl.GetContributors()
+	}
+	return []*model.Contributor{}
+}
+
+// PageCounter is implemented by parsers of image-based books that count their pages
+type PageCounter interface {
+	GetPages() int
+}
+
+// Pages returns the number of page images of image-based book, 0 for parsers that do not count them
+func Pages(p Parser) int {
+	if pc, ok := p.(PageCounter); ok {
+		return pc.GetPages()
+	}
+	return 0
+}
+
+// SerieNumber returns the integer part of the book number in series, e.g. 2 for 2.5, 0 if the number is not decimal
+func SerieNumber(num string) int {
+	n, err := strconv.ParseFloat(strings.Replace(strings.TrimSpace(num), ",", ".", 1), 64)
+	if err != nil || !(math.Abs(n) <= math.MaxInt32) { // NaN is not comparable
+		return 0
+	}
+	return int(n)
+}
+
+// StockPath resolves book file or archive path stored relative to the stock folder
+func StockPath(stock, rel string) string {
+	return filepath.Join(stock, filepath.FromSlash(rel))
+}
+
+// OpenBook opens book file from the stock folder or its entry from the stock archive
+func OpenBook(stock string, book *model.Book) (io.ReadCloser, error) {
+	if book.Archive == "" {
+		return os.Open(StockPath(stock, book.File))
+	}
+	zr, err := zip.OpenReader(StockPath(stock, book.Archive))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range zr.File {
+		if file.Name == book.File || path.Base(file.Name) == book.File {
+			rc, err := file.Open()
+			if err != nil {
+				zr.Close()
+				return nil, err
+			}
+			return &archiveEntry{ReadCloser: rc, zr: zr}, nil
+		}
+	}
+	zr.Close()
+	return nil, fmt.Errorf("file %s not found in archive %s", book.File, book.Archive)
+}
+
+// OpenBookAt returns the random access reader of the book from the stock folder or the stock archive
+// and the function to close it, see OpenEntryAt
+func OpenBookAt(stock string, book *model.Book) (*io.SectionReader, func() error, error) {
+	if book.Archive == "" {
+		f, err := os.Open(StockPath(stock, book.File))
+		if err != nil {
+			return nil, nil, err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		return io.NewSectionReader(f, 0, fi.Size()), f.Close, nil
+	}
+	archivePath := StockPath(stock, book.Archive)
+	zrc, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer zrc.Close()
+	for _, file := range zrc.File {
+		if file.Name == book.File || path.Base(file.Name) == book.File {
+			return OpenEntryAt(archivePath, file)
+		}
+	}
+	return nil, nil, fmt.Errorf("file %s not found in archive %s", book.File, book.Archive)
+}
+
+// OpenEntryAt returns the random access reader of archive entry and the function to close it.
+// Stored entry is read in place from the archive file, compressed one is decompressed to temporary file
+func OpenEntryAt(archivePath string, entry *zip.File) (*io.SectionReader, func() error, error) {
+	if entry.Method != zip.Store {
+		rc, err := entry.Open()
+		if err != nil {
+			return nil, nil, err
+		}
+		defer rc.Close()
+		return SpoolReader(rc)
+	}
+	offset, err := entry.DataOffset()
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return io.NewSectionReader(f, offset, int64(entry.UncompressedSize64)), f.Close, nil
+}
+
+// SpoolReader copies the content to temporary file and returns its random access reader
+// and the function to close and remove the file
+func SpoolReader(r io.Reader) (*io.SectionReader, func() error, error) {
+	f, err := os.CreateTemp("", "flibgolite-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	remove := func() error {
+		f.Close()
+		return os.Remove(f.Name())
+	}
+	size, err := io.Copy(f, r)
+	if err != nil {
+		remove()
+		return nil, nil, err
+	}
+	return io.NewSectionReader(f, 0, size), remove, nil
+}
+
+// OpenZipBook returns the zip reader of zip based book (EPUB, CBZ) from the stock folder or the stock archive
+// and the function to close it, see OpenZipEntry
+func OpenZipBook(stock string, book *model.Book) (*zip.Reader, func() error, error) {
+	if book.Archive == "" {
+		zrc, err := zip.OpenReader(StockPath(stock, book.File))
+		if err != nil {
+			return nil, nil, err
+		}
+		return &zrc.Reader, zrc.Close, nil
+	}
+	archivePath := StockPath(stock, book.Archive)
+	zrc, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, file := range zrc.File {
+		if file.Name == book.File || path.Base(file.Name) == book.File {
+			zr, close, err := OpenZipEntry(archivePath, file)
+			if err != nil {
+				zrc.Close()
+				return nil, nil, err
+			}
+			return zr, func() error {
+				close()
+				return zrc.Close()
+			}, nil
+		}
+	}
+	zrc.Close()
+	return nil, nil, fmt.Errorf("file %s not found in archive %s", book.File, book.Archive)
+}
+
+// OpenZipEntry returns the zip reader of zip based book that is the entry of archive and the function to close it.
+// Stored entry is read in place from the archive file, compressed one has to be decompressed to memory
+func OpenZipEntry(archivePath string, entry *zip.File) (*zip.Reader, func() error, error) {
+	if entry.Method != zip.Store {
+		rc, err := entry.Open()
+		if err != nil {
+			return nil, nil, err
+		}
+		defer rc.Close()
+		zr, err := NewZipReader(rc)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, func() error { return nil }, nil
+	}
+	offset, err := entry.DataOffset()
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	size := int64(entry.UncompressedSize64)
+	zr, err := zip.NewReader(io.NewSectionReader(f, offset, size), size)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return zr, f.Close, nil
+}
+
+// archiveEntry closes the archive together with its entry
+type archiveEntry struct {
+	io.ReadCloser
+	zr *zip.ReadCloser
+}
+
+func (e *archiveEntry) Close() error {
+	e.ReadCloser.Close()
+	return e.zr.Close()
+}
+
+// NewZipReader makes zip reader from zip content that is not seekable, e.g. EPUB inside zip archive
+func NewZipReader(r io.Reader) (*zip.Reader, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return zip.NewReader(bytes.NewReader(b), int64(len(b)))
 }
 
 func RefineName(n, lang string) string {
@@ -80,6 +341,18 @@ func CollapseSpaces(s string) string {
 	return rxSpaces.ReplaceAllString(s, ` `)
 }
 
+// IsSeparator reports whether r separates items of subjects, tags and keywords lists
+func IsSeparator(r rune) bool {
+	return r == ',' || r == ';' || unicode.IsSpace(r)
+}
+
+// FileNameTitle returns the title made of the book file name without folders and extension,
+// it is used when the book has no title metadata
+func FileNameTitle(fileName string) string {
+	base := path.Base(strings.ReplaceAll(fileName, "\\", "/"))
+	return strings.TrimSpace(strings.ReplaceAll(strings.TrimSuffix(base, path.Ext(base)), "_", " "))
+}
+
 // RegExp Find first genre in a string
 var rxGenre = regexp.MustCompile(`[\pL\pN_]{2,}`)
 
@@ -101,6 +374,49 @@ func Keywords(s string) string {
 	return strings.Join(rxKeyword.FindAllString(s, -1), ` `)
 }
 
+// RegExp Find ISBN-10 or ISBN-13 with optional hyphens and spaces
+var rxISBN = regexp.MustCompile(`(?:97[89][- ]?)?(?:\d[- ]?){9}[\dXx]`)
+
+// ISBNs returns comma separated ISBNs found in a string without hyphens and spaces, ISBNs with wrong check digit are skipped
+func ISBNs(s string) string {
+	isbns := []string{}
+	for _, isbn := range rxISBN.FindAllString(s, -1) {
+		isbn = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(isbn))
+		if validISBN(isbn) && !slices.Contains(isbns, isbn) {
+			isbns = append(isbns, isbn)
+		}
+	}
+	return strings.Join(isbns, ", ")
+}
+
+// validISBN checks ISBN-10 or ISBN-13 check digit
+func validISBN(isbn string) bool {
+	sum := 0
+	switch len(isbn) {
+	case 10:
+		for i, c := range isbn {
+			d := int(c - '0')
+			if c == 'X' {
+				if i != 9 {
+					return false
+				}
+				d = 10
+			}
+			sum += d * (10 - i)
+		}
+		return sum%11 == 0
+	case 13:
+		for i, c := range isbn {
+			if c == 'X' {
+				return false
+			}
+			sum += int(c-'0') * (1 + 2*(i%2))
+		}
+		return sum%10 == 0
+	}
+	return false
+}
+
 // RegExp Find English article at the beginning of the string
 var rx1stArticle = regexp.MustCompile(`(?i)^An? |^The `)
 
@@ -0,0 +1,72 @@
+package parsers
+
+import "testing"
+
+func TestSerieNumber(t *testing.T) {
+	var testNumbers = []struct {
+		num string
+		n   int
+	}{
+		{"", 0},
+		{"3", 3},
+		{" 2.5 ", 2},
+		{"2,5", 2},
+		{"IV", 0},
+		{"2a", 0},
+		{"Inf", 0},
+		{"NaN", 0},
+		{"1e30", 0},
+	}
+
+	for _, n := range testNumbers {
+		if got := SerieNumber(n.num); got != n.n {
+			t.Errorf("%q: expecting %d, got: %d", n.num, n.n, got)
+		}
+	}
+}
+
+func TestISBNs(t *testing.T) {
+	var testISBNs = []struct {
+		s     string
+		isbns string
+	}{
+		{"978-0-306-40615-7", "9780306406157"},
+		{"ISBN 978 0 306 40615 7", "9780306406157"},
+		{"0-306-40615-2", "0306406152"},
+		{"ISBN: 0-8044-2957-x", "080442957X"},
+		{"978-0-306-40615-7, 5-17-118366-4; 978-0-306-40615-7", "9780306406157"},
+		{"978-5-17-118366-0 (hardcover), 0-306-40615-2 (paper)", "9785171183660, 0306406152"},
+		{"978-0-306-40615-8", ""},
+		{"0-306-40615-X", ""},
+		{"12345", ""},
+		{"", ""},
+	}
+
+	for _, i := range testISBNs {
+		if isbns := ISBNs(i.s); isbns != i.isbns {
+			t.Errorf("%q: expecting %q, got: %q", i.s, i.isbns, isbns)
+		}
+	}
+}
+
+func TestValidISBN(t *testing.T) {
+	var testISBNs = []struct {
+		isbn  string
+		valid bool
+	}{
+		{"9780306406157", true},
+		{"9780306406150", false},
+		{"0306406152", true},
+		{"080442957X", true},
+		{"08044295X7", false},
+		{"978030640615X", false},
+		{"030640615", false},
+		{"", false},
+	}
+
+	for _, i := range testISBNs {
+		if valid := validISBN(i.isbn); valid != i.valid {
+			t.Errorf("%q: expecting valid %v, got: %v", i.isbn, i.valid, valid)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package pdf
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/vinser/flibgolite/internal/core/model"
+	"github.com/vinser/flibgolite/internal/parsers"
+)
+
+type PDF struct {
+	Info     map[string]string // Info dictionary text entries
+	XMP      XMP               // XMP metadata
+	Lang     string            // Document catalog language
+	CoverObj int               // First page image object number
+	CoverExt string            // First page image extension
+	FileName string            // Title fallback
+}
+
+// ParsePDF reads PDF metadata from the Info dictionary and the XMP metadata stream,
+// the content of size bytes is read on demand
+func ParsePDF(r io.ReaderAt, size int64, fileName string) (*PDF, error) {
+	doc, err := newDocument(r, size)
+	if err != nil {
+		return nil, err
+	}
+	p := &PDF{
+		Info:     doc.info(),
+		XMP:      parseXMP(doc.xmp()),
+		FileName: fileName,
+	}
+	if lang, ok := doc.resolve(doc.catalog()["Lang"]).(string); ok {
+		p.Lang = textString(lang)
+	}
+	p.CoverObj, p.CoverExt = doc.coverObject()
+	return p, nil
+}
+
+func (p *PDF) GetFormat() string {
+	return "pdf"
+}
+
+func (p *PDF) GetTitle() string {
+	if len(p.XMP.Title) > 0 {
+		return p.XMP.Title[0]
+	}
+	if t := p.Info["Title"]; t != "" && !isFileName(t) {
+		return t
+	}
+	return parsers.FileNameTitle(p.FileName)
+}
+
+func (p *PDF) GetSort() string {
+	return parsers.GetSortTitle(p.GetTitle(), parsers.GetLanguageTag(p.lang()))
+}
+
+func (p *PDF) GetYear() string {
+	if y := parsers.PickYear(p.XMP.CreateDate); y != "" {
+		return y
+	}
+	return parsers.PickYear(strings.TrimPrefix(p.Info["CreationDate"], "D:"))
+}
+
+func (p *PDF) GetPlot() string {
+	if len(p.XMP.Description) > 0 {
+		return parsers.StripHTMLTags(strings.Join(p.XMP.Description, " "))
+	}
+	return p.Info["Subject"]
+}
+
+func (p *PDF) GetCover() string {
+	if p.CoverObj == 0 {
+		return ""
+	}
+	return strconv.Itoa(p.CoverObj) + p.CoverExt
+}
+
+func (p *PDF) lang() string {
+	if len(p.XMP.Language) > 0 {
+		return p.XMP.Language[0]
+	}
+	return p.Lang
+}
+
+func (p *PDF) GetLanguage() *model.Language {
+	return parsers.GetLanguage(p.lang())
+}
+
+func (p *PDF) GetAuthors() []*model.Author {
+	names := p.XMP.Creator
+	if len(names) == 0 && p.Info["Author"] != "" {
+		names = strings.FieldsFunc(p.Info["Author"], func(r rune) bool { return r == ';' || r == '&' })
+	}
+	authors := make([]*model.Author, 0, len(names))
+	for _, n := range names {
+		author := parsers.AuthorByFullName(n)
+		if author.Sort != "" {
+			authors = append(authors, author)
+		}
+	}
+	return parsers.AuthorsOrUnknown(authors)
+}
+
+func (p *PDF) GetGenres() []string {
+	return strings.FieldsFunc(strings.Join(p.XMP.Subject, " "), parsers.IsSeparator)
+}
+
+func (p *PDF) GetKeywords() string {
+	keywords := p.XMP.Keywords
+	if keywords == "" {
+		keywords = p.Info["Keywords"]
+	}
+	if keywords == "" {
+		keywords = strings.Join(p.XMP.Subject, " ")
+	}
+	return strings.Join(strings.FieldsFunc(keywords, parsers.IsSeparator), " ")
+}
+
+func (p *PDF) GetSerie() *model.Serie {
+	return &model.Serie{}
+}
+
+func (p *PDF) GetSerieNumber() int {
+	return 0
+}
+
+func (p *PDF) GetISBN() string {
+	return ""
+}
+
+func (p *PDF) GetPublisher() string {
+	return ""
+}
+
+func (p *PDF) GetCity() string {
+	return ""
+}
+
+func (p *PDF) GetSrcLanguage() string {
+	return ""
+}
+
+func (p *PDF) GetSrcTitle() string {
+	return ""
+}
+
+func (p *PDF) String() string {
+	return "" + fmt.Sprint(
+		"\n=========PDF===================\n",
+		fmt.Sprintf("Info:       %#v\n", p.Info),
+		fmt.Sprintf("XMP:        %#v\n", p.XMP),
+		fmt.Sprintf("Lang:       %#v\n", p.Lang),
+		fmt.Sprintf("Cover:      %#v\n", p.GetCover()),
+		"===============================\n",
+	)
+}
+
+// isFileName reports whether title is just a source document file name, e.g. "Microsoft Word - book.doc"
+func isFileName(title string) bool {
+	ext := strings.ToLower(path.Ext(title))
+	return ext == ".doc" || ext == ".docx" || ext == ".pdf" || ext == ".tex" || ext == ".dvi" || ext == ".indd"
+}
+
+// GetCoverImage decodes the first page image stored in the book cover
+func GetCoverImage(stock string, book *model.Book) (image.Image, error) {
+	num, err := strconv.Atoi(strings.TrimSuffix(book.Cover, path.Ext(book.Cover)))
+	if err != nil {
+		return nil, fmt.Errorf("wrong PDF cover reference %s", book.Cover)
+	}
+	r, close, err := parsers.OpenBookAt(stock, book)
+	if err != nil {
+		return nil, err
+	}
+	defer close()
+	doc, err := newDocument(r, r.Size())
+	if err != nil {
+		return nil, err
+	}
+	return doc.image(num)
+}
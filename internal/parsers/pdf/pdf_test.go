@@ -0,0 +1,169 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vinser/flibgolite/internal/core/model"
+)
+
+// pdfData assembles PDF file of numbered objects with the tail, e.g. cross-reference table and trailer
+func pdfData(tail string, objects ...string) []byte {
+	b := &bytes.Buffer{}
+	b.WriteString("%PDF-1.7\n")
+	for i, o := range objects {
+		fmt.Fprintf(b, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	b.WriteString(tail)
+	return b.Bytes()
+}
+
+const (
+	info    = `<< /Title (Classic Title) /Author (Jane Doe; John Roe) /Subject (About) >>`
+	catalog = `<< /Type /Catalog /Lang (de) >>`
+	trailer = "xref\n0 3\n0000000000 65535 f \ntrailer\n<< /Root 2 0 R /Info 1 0 R >>\nstartxref\n9\n%%EOF\n"
+)
+
+func parse(data []byte) (*PDF, error) {
+	return ParsePDF(bytes.NewReader(data), int64(len(data)), "File Name.pdf")
+}
+
+func TestParsePDF(t *testing.T) {
+	objStm := "3 0 10 40 "
+	objStmData := objStm + `<< /Title (Packed Title) >>` + "          " + `<< /Type /Catalog >>`
+	deep := strings.Repeat("[", 100000) + strings.Repeat("<<", 100000)
+	padding := "%" + strings.Repeat("x", SCAN_CHUNK-len("%PDF-1.7\n")-len("1 0 obj\n"+info+"\nendobj\n")-3) + "\n"
+
+	var testPDFs = []struct {
+		name    string
+		data    []byte
+		title   string
+		authors int
+		lang    string
+		err     error
+	}{
+		{"classic", pdfData(trailer, info, catalog), "Classic Title", 2, "de", nil},
+		{"truncated trailer", pdfData("xref\n0 3\n0000000000 65535 f \ntrailer\n<< /Root 2 0 R /Info 1 0 R", info, catalog), "Classic Title", 2, "de", nil},
+		{"truncated xref", pdfData("xref\n0 3\n00000", info, catalog), "File Name", 1, "", nil},
+		{"truncated object", pdfData("", info, `<< /Type /Catalog /Lang (d`), "File Name", 1, "", nil},
+		{
+			"object stream",
+			pdfData("",
+				`<< /Type /XRef /Root 4 0 R /Info 3 0 R /Size 5 >>
+stream
+endstream`,
+				fmt.Sprintf("<< /Type /ObjStm /N 2 /First %d /Length %d >>\nstream\n%s\nendstream", len(objStm), len(objStmData), objStmData),
+			),
+			"Packed Title", 1, "", nil,
+		},
+		{
+			"object stream with wrong length",
+			pdfData("trailer << /Info 3 0 R >>",
+				"",
+				fmt.Sprintf("<< /Type /ObjStm /N 2 /First %d /Length 99999 >>\nstream\n%s\nendstream", len(objStm), objStmData),
+			),
+			"Packed Title", 1, "", nil,
+		},
+		{
+			"negative object stream offsets",
+			pdfData("trailer << /Info 3 0 R >>",
+				"",
+				"<< /Type /ObjStm /N 2 /First -100 >>\nstream\n3 -10 4 -99999999 << /Title (Negative) >>\nendstream",
+			),
+			"File Name", 1, "", nil,
+		},
+		{"negative stream length", pdfData(trailer, info, "<< /Type /Catalog /Metadata 3 0 R >>", "<< /Length -5 >>\nstream\n<x:xmpmeta/>\nendstream"), "Classic Title", 2, "", nil},
+		{"deep nesting", pdfData(trailer, info, catalog, deep), "Classic Title", 2, "de", nil},
+		{"deep nesting trailer", pdfData("trailer\n"+deep, info, catalog), "File Name", 1, "", nil},
+		{"object header across chunks", pdfData(padding+"2 0 obj\n"+catalog+"\nendobj\n"+trailer, info), "Classic Title", 2, "de", nil},
+		{
+			"xmp packet",
+			pdfData(trailer, info, catalog, `<< >> <x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns:dc="http://purl.org/dc/elements/1.1/"><rdf:Description><dc:title><rdf:Alt><rdf:li>XMP Title</rdf:li></rdf:Alt></dc:title></rdf:Description></rdf:RDF></x:xmpmeta>`),
+			"XMP Title", 2, "de", nil,
+		},
+		{"no objects", []byte("%PDF-1.7\ntrailer << >>"), "", 0, "", ErrNotPDF},
+		{"not pdf", []byte("1 0 obj << >> endobj"), "", 0, "", ErrNotPDF},
+		{"empty", nil, "", 0, "", ErrNotPDF},
+	}
+
+	for _, p := range testPDFs {
+		doc, err := parse(p.data)
+		if !errors.Is(err, p.err) {
+			t.Errorf("%s: expecting error %v, got: %v", p.name, p.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if title := doc.GetTitle(); title != p.title {
+			t.Errorf("%s: expecting title %q, got: %q", p.name, p.title, title)
+		}
+		if authors := doc.GetAuthors(); len(authors) != p.authors {
+			t.Errorf("%s: expecting %d authors, got: %d", p.name, p.authors, len(authors))
+		}
+		if lang := doc.lang(); lang != p.lang {
+			t.Errorf("%s: expecting language %q, got: %q", p.name, p.lang, lang)
+		}
+	}
+}
+
+func TestGetCoverImage(t *testing.T) {
+	pixels := "\x00\x40\x80\xff\x10\x20"
+	data := pdfData(trailer,
+		info,
+		`<< /Type /Catalog /Pages 3 0 R >>`,
+		`<< /Type /Pages /Kids [4 0 R] /Count 1 /Resources << /XObject << /Im1 5 0 R /Im2 6 0 R >> >> >>`,
+		`<< /Type /Page /Parent 3 0 R >>`,
+		fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width 3 /Height 2 /ColorSpace /DeviceGray /BitsPerComponent 8 /Length %d >>\nstream\n%s\nendstream", len(pixels), pixels),
+		"<< /Type /XObject /Subtype /Image /Width 100000 /Height 100000 /ColorSpace /DeviceGray /BitsPerComponent 8 /Length 1 >>\nstream\nx\nendstream",
+	)
+	doc, err := parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cover := doc.GetCover(); cover != "6.png" {
+		t.Errorf("Expecting cover 6.png, got: %q", cover)
+	}
+	stock := t.TempDir()
+	if err := os.WriteFile(filepath.Join(stock, "book.pdf"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var testCovers = []struct {
+		cover string
+		err   bool
+	}{
+		{"5.png", false},
+		{"6.png", true}, // too large to decode
+		{"1.png", true}, // not an image
+		{"x.png", true},
+	}
+
+	for _, c := range testCovers {
+		img, err := GetCoverImage(stock, &model.Book{File: "book.pdf", Cover: c.cover})
+		if (err != nil) != c.err {
+			t.Errorf("%s: expecting error %v, got: %v", c.cover, c.err, err)
+			continue
+		}
+		if err == nil && (img.Bounds().Dx() != 3 || img.Bounds().Dy() != 2) {
+			t.Errorf("%s: expecting 3x2 image, got: %v", c.cover, img.Bounds())
+		}
+	}
+}
+
+func FuzzParsePDF(f *testing.F) {
+	f.Add(pdfData(trailer, info, catalog))
+	f.Add(pdfData("", "<< /Type /ObjStm /N 1 /First 4 >>\nstream\n3 0 << /Title (T) >>\nendstream"))
+	f.Add(pdfData("trailer << /Info 1 0 R >>", "<< /Length 3 >>\nstream\nabc\nendstream"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if p, err := parse(data); err == nil {
+			p.GetTitle()
+			p.GetAuthors()
+		}
+	})
+}
@@ -0,0 +1,797 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	_ "image/jpeg"
+)
+
+// PDF objects ----------------------------------
+
+type name string
+
+type ref struct {
+	num int
+	gen int
+}
+
+type dict map[name]any
+
+type stream struct {
+	dict   dict
+	offset int64 // raw (encoded) stream data offset
+	length int64 // raw stream data length
+}
+
+// document reads PDF file content on demand and keeps offsets of its objects.
+// Objects are located by scanning the content, so broken or missing cross-reference tables are not a problem.
+type document struct {
+	r          io.ReaderAt
+	size       int64
+	offsets    map[int]int64      // object number -> offset of the object value
+	compressed map[int]compressed // object number -> place in the object stream
+	objStms    map[int][]byte     // decoded object streams cache
+	trailers   []int64            // offsets of classic trailer dictionaries
+	xmpOffset  int64              // offset of the first XMP packet, -1 if there is none
+	trailer    dict
+}
+
+type compressed struct {
+	stm    int
+	offset int
+}
+
+const (
+	SCAN_CHUNK     = 1 << 20  // content is scanned for objects by chunks of this size
+	SCAN_OVERLAP   = 256      // chunks overlap, so matches up to this length are not cut
+	OBJECT_WINDOW  = 64 << 10 // maximum length of object value read at once
+	MAX_STREAM_LEN = 64 << 20 // longer streams are not decoded
+	MAX_NESTING    = 64       // deeper nested arrays and dictionaries are not parsed
+	MAX_IMAGE_SIDE = 1 << 15  // larger images are not decoded
+)
+
+// RegExp Find indirect object header, trailer or XMP packet
+var rxObj = regexp.MustCompile(`(\d+)[ \t\r\n\f\x00]+(\d+)[ \t\r\n\f\x00]+obj\b|trailer|<x:xmpmeta`)
+
+var ErrNotPDF = errors.New("not a PDF file")
+
+func newDocument(r io.ReaderAt, size int64) (*document, error) {
+	doc := &document{
+		r:          r,
+		size:       size,
+		offsets:    make(map[int]int64),
+		compressed: make(map[int]compressed),
+		objStms:    make(map[int][]byte),
+		xmpOffset:  -1,
+		trailer:    dict{},
+	}
+	if !bytes.Contains(doc.read(0, 1024), []byte("%PDF-")) {
+		return nil, ErrNotPDF
+	}
+	if err := doc.scan(); err != nil {
+		return nil, err
+	}
+	if len(doc.offsets) == 0 {
+		return nil, ErrNotPDF
+	}
+	doc.readTrailers()
+	doc.readObjectStreams()
+	return doc, nil
+}
+
+// read returns up to n bytes of the content at offset, less at the end of the content or on read error
+func (doc *document) read(offset int64, n int) []byte {
+	if offset < 0 || offset >= doc.size || n <= 0 {
+		return nil
+	}
+	b := make([]byte, min(int64(n), doc.size-offset))
+	k, _ := doc.r.ReadAt(b, offset)
+	return b[:k]
+}
+
+// scan finds object headers, trailers and XMP packet reading the content by overlapping chunks.
+// The match is taken from the chunk it starts in, so it is neither cut nor taken twice
+func (doc *document) scan() error {
+	for start := int64(0); start < doc.size; start += SCAN_CHUNK {
+		from := max(start-SCAN_OVERLAP, 0)
+		buf := make([]byte, min(start+SCAN_CHUNK+SCAN_OVERLAP, doc.size)-from)
+		if n, err := doc.r.ReadAt(buf, from); n < len(buf) {
+			return fmt.Errorf("read at %d: %w", from+int64(n), err)
+		}
+		for _, m := range rxObj.FindAllSubmatchIndex(buf, -1) {
+			at := from + int64(m[0])
+			if at < start || at >= start+SCAN_CHUNK {
+				continue
+			}
+			switch {
+			case m[2] >= 0:
+				num, err := strconv.Atoi(string(buf[m[2]:m[3]]))
+				if err == nil {
+					doc.offsets[num] = from + int64(m[1]) // later definitions (incremental updates) win
+				}
+			case buf[m[0]] == 't':
+				doc.trailers = append(doc.trailers, from+int64(m[1]))
+			case doc.xmpOffset < 0:
+				doc.xmpOffset = at
+			}
+		}
+	}
+	return nil
+}
+
+// index returns the offset of sep in the content starting at offset up to limit bytes, -1 if there is none
+func (doc *document) index(offset int64, sep []byte, limit int64) int64 {
+	end := min(offset+limit, doc.size)
+	for start := offset; start < end; start += SCAN_CHUNK {
+		buf := doc.read(start, int(min(SCAN_CHUNK+int64(len(sep)), end-start)))
+		if i := bytes.Index(buf, sep); i >= 0 {
+			return start + int64(i)
+		}
+	}
+	return -1
+}
+
+// readTrailers collects trailer entries from classic trailers and cross-reference streams
+func (doc *document) readTrailers() {
+	for _, offset := range doc.trailers {
+		l := &lexer{data: doc.read(offset, OBJECT_WINDOW)}
+		if d, ok := l.value().(dict); ok {
+			for k, v := range d {
+				doc.trailer[k] = v
+			}
+		}
+	}
+	for num := range doc.offsets {
+		if s, ok := doc.object(num).(stream); ok && s.dict["Type"] == name("XRef") {
+			for _, k := range []name{"Root", "Info"} {
+				if v, ok := s.dict[k]; ok {
+					doc.trailer[k] = v
+				}
+			}
+		}
+	}
+}
+
+// readObjectStreams indexes objects packed into object streams (PDF 1.5+)
+func (doc *document) readObjectStreams() {
+	for num := range doc.offsets {
+		s, ok := doc.object(num).(stream)
+		if !ok || s.dict["Type"] != name("ObjStm") {
+			continue
+		}
+		data, err := doc.decode(s)
+		if err != nil {
+			continue
+		}
+		doc.objStms[num] = data
+		n, _ := doc.resolve(s.dict["N"]).(int)
+		l := &lexer{data: data}
+		for i := 0; i < n; i++ {
+			objNum, ok1 := l.value().(int)
+			offset, ok2 := l.value().(int)
+			if !ok1 || !ok2 || offset < 0 {
+				break
+			}
+			if _, ok := doc.offsets[objNum]; !ok {
+				doc.compressed[objNum] = compressed{stm: num, offset: offset}
+			}
+		}
+	}
+}
+
+// object returns indirect object value by its number
+func (doc *document) object(num int) any {
+	if offset, ok := doc.offsets[num]; ok {
+		l := &lexer{data: doc.read(offset, OBJECT_WINDOW)}
+		v := l.value()
+		if d, ok := v.(dict); ok && l.keyword("stream") {
+			return doc.stream(d, offset+int64(l.pos))
+		}
+		return v
+	}
+	if c, ok := doc.compressed[num]; ok {
+		data := doc.objStms[c.stm]
+		s, _ := doc.object(c.stm).(stream)
+		first, _ := doc.resolve(s.dict["First"]).(int)
+		if first >= 0 && first < len(data) && c.offset < len(data)-first {
+			l := &lexer{data: data, pos: first + c.offset}
+			return l.value()
+		}
+	}
+	return nil
+}
+
+// stream locates raw stream data that starts right after the stream keyword at offset
+func (doc *document) stream(d dict, offset int64) stream {
+	s := stream{dict: d, offset: offset}
+	eol := doc.read(offset, 2)
+	if len(eol) > 0 && eol[0] == '\r' {
+		s.offset++
+		eol = eol[1:]
+	}
+	if len(eol) > 0 && eol[0] == '\n' {
+		s.offset++
+	}
+	if length, ok := doc.resolve(d["Length"]).(int); ok && length >= 0 && int64(length) <= doc.size-s.offset {
+		end := s.offset + int64(length)
+		if bytes.HasPrefix(bytes.TrimLeft(doc.read(end, 32), " \t\r\n"), []byte("endstream")) {
+			s.length = int64(length)
+			return s
+		}
+	}
+	if end := doc.index(s.offset, []byte("endstream"), MAX_STREAM_LEN); end >= 0 {
+		eol := doc.read(max(end-2, s.offset), int(min(2, end-s.offset)))
+		s.length = end - s.offset - int64(len(eol)-len(bytes.TrimRight(eol, "\r\n")))
+	}
+	return s
+}
+
+// data returns raw stream data
+func (doc *document) data(s stream) ([]byte, error) {
+	if s.length > MAX_STREAM_LEN {
+		return nil, fmt.Errorf("stream of %d bytes is too long", s.length)
+	}
+	data := doc.read(s.offset, int(s.length))
+	if int64(len(data)) < s.length {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return data, nil
+}
+
+// resolve follows indirect reference
+func (doc *document) resolve(v any) any {
+	for i := 0; i < 8; i++ { // guard against reference loops
+		r, ok := v.(ref)
+		if !ok {
+			return v
+		}
+		v = doc.object(r.num)
+	}
+	return nil
+}
+
+func (doc *document) dict(v any) dict {
+	switch t := doc.resolve(v).(type) {
+	case dict:
+		return t
+	case stream:
+		return t.dict
+	}
+	return nil
+}
+
+// filters returns stream filter names
+func (doc *document) filters(s stream) []name {
+	switch f := doc.resolve(s.dict["Filter"]).(type) {
+	case name:
+		return []name{f}
+	case []any:
+		filters := []name{}
+		for _, v := range f {
+			if n, ok := doc.resolve(v).(name); ok {
+				filters = append(filters, n)
+			}
+		}
+		return filters
+	}
+	return nil
+}
+
+// decode applies stream filters, only FlateDecode without predictors is supported
+func (doc *document) decode(s stream) ([]byte, error) {
+	data, err := doc.data(s)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range doc.filters(s) {
+		switch f {
+		case "FlateDecode", "Fl":
+			zr, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			data, err = io.ReadAll(io.LimitReader(zr, MAX_STREAM_LEN))
+			if err != nil && len(data) == 0 {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unsupported stream filter %s", f)
+		}
+	}
+	return data, nil
+}
+
+// Metadata ----------------------------------
+
+// info returns text entries of the document Info dictionary
+func (doc *document) info() map[string]string {
+	info := map[string]string{}
+	for k, v := range doc.dict(doc.trailer["Info"]) {
+		if s, ok := doc.resolve(v).(string); ok {
+			info[string(k)] = textString(s)
+		}
+	}
+	return info
+}
+
+func (doc *document) catalog() dict {
+	return doc.dict(doc.trailer["Root"])
+}
+
+// xmp returns document level XMP metadata packet
+func (doc *document) xmp() []byte {
+	if s, ok := doc.resolve(doc.catalog()["Metadata"]).(stream); ok {
+		if data, err := doc.decode(s); err == nil {
+			return data
+		}
+	}
+	if doc.xmpOffset >= 0 {
+		if end := doc.index(doc.xmpOffset, []byte("</x:xmpmeta>"), MAX_STREAM_LEN); end >= 0 {
+			return doc.read(doc.xmpOffset, int(end-doc.xmpOffset)+len("</x:xmpmeta>"))
+		}
+	}
+	return nil
+}
+
+// textString decodes PDF text string from UTF-16BE, UTF-8 or PDFDocEncoding
+func textString(s string) string {
+	b := []byte(s)
+	switch {
+	case bytes.HasPrefix(b, []byte{0xfe, 0xff}):
+		u := make([]uint16, 0, len(b)/2)
+		for i := 2; i+1 < len(b); i += 2 {
+			u = append(u, uint16(b[i])<<8|uint16(b[i+1]))
+		}
+		s = string(utf16.Decode(u))
+	case bytes.HasPrefix(b, []byte{0xef, 0xbb, 0xbf}):
+		s = string(b[3:])
+	default:
+		r := make([]rune, len(b))
+		for i, c := range b {
+			r[i] = rune(c) // PDFDocEncoding is close to Latin-1 for printable characters
+		}
+		s = string(r)
+	}
+	return strings.TrimSpace(strings.ReplaceAll(s, "\x00", ""))
+}
+
+// XMP is a part of XMP metadata packet used for cataloguing
+type XMP struct {
+	Title       []string
+	Creator     []string
+	Language    []string
+	Subject     []string
+	Description []string
+	Keywords    string
+	CreateDate  string
+}
+
+const (
+	nsDC  = "http://purl.org/dc/elements/1.1/"
+	nsXMP = "http://ns.adobe.com/xap/1.0/"
+	nsPDF = "http://ns.adobe.com/pdf/1.3/"
+)
+
+func parseXMP(data []byte) XMP {
+	x := XMP{}
+	if len(data) == 0 {
+		return x
+	}
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+	setSimple := func(space, local, value string) {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return
+		}
+		switch {
+		case space == nsXMP && local == "CreateDate":
+			x.CreateDate = value
+		case space == nsPDF && local == "Keywords":
+			x.Keywords = value
+		}
+	}
+	var field *[]string // dc element that is being read now
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "Description" {
+				for _, a := range t.Attr {
+					setSimple(a.Name.Space, a.Name.Local, a.Value)
+				}
+				continue
+			}
+			if t.Name.Space == nsDC {
+				switch t.Name.Local {
+				case "title":
+					field = &x.Title
+				case "creator":
+					field = &x.Creator
+				case "language":
+					field = &x.Language
+				case "subject":
+					field = &x.Subject
+				case "description":
+					field = &x.Description
+				default:
+					field = nil
+				}
+				continue
+			}
+			if t.Name.Local == "li" && field != nil {
+				var li string
+				if err := d.DecodeElement(&li, &t); err == nil && strings.TrimSpace(li) != "" {
+					*field = append(*field, strings.TrimSpace(li))
+				}
+				continue
+			}
+			if t.Name.Space == nsXMP || t.Name.Space == nsPDF {
+				var v string
+				if err := d.DecodeElement(&v, &t); err == nil {
+					setSimple(t.Name.Space, t.Name.Local, v)
+				}
+			}
+		case xml.EndElement:
+			if t.Name.Space == nsDC {
+				field = nil
+			}
+		}
+	}
+	return x
+}
+
+// Cover ----------------------------------
+
+// firstPage returns the first page dictionary with inherited resources
+func (doc *document) firstPage() (page dict, resources dict) {
+	node := doc.dict(doc.catalog()["Pages"])
+	for depth := 0; node != nil && depth < 32; depth++ {
+		if r := doc.dict(node["Resources"]); r != nil {
+			resources = r
+		}
+		if node["Type"] == name("Page") {
+			return node, resources
+		}
+		kids, _ := doc.resolve(node["Kids"]).([]any)
+		if len(kids) == 0 {
+			return nil, nil
+		}
+		node = doc.dict(kids[0])
+	}
+	return nil, nil
+}
+
+// coverObject finds the largest supported image of the first page and returns its object number and extension
+func (doc *document) coverObject() (int, string) {
+	_, resources := doc.firstPage()
+	xobjects := doc.dict(resources["XObject"])
+	num, ext, maxArea := 0, "", 0
+	for _, v := range xobjects {
+		r, ok := v.(ref)
+		if !ok {
+			continue
+		}
+		s, ok := doc.object(r.num).(stream)
+		if !ok || s.dict["Subtype"] != name("Image") {
+			continue
+		}
+		w, _ := doc.resolve(s.dict["Width"]).(int)
+		h, _ := doc.resolve(s.dict["Height"]).(int)
+		imgExt := doc.imageExt(s)
+		if imgExt != "" && w*h > maxArea {
+			num, ext, maxArea = r.num, imgExt, w*h
+		}
+	}
+	return num, ext
+}
+
+// imageExt returns extension for image stream that can be decoded or empty string
+func (doc *document) imageExt(s stream) string {
+	filters := doc.filters(s)
+	switch {
+	case len(filters) == 1 && (filters[0] == "DCTDecode" || filters[0] == "DCT"):
+		return ".jpg"
+	case len(filters) <= 1 && (len(filters) == 0 || filters[0] == "FlateDecode" || filters[0] == "Fl"):
+		if _, ok := s.dict["DecodeParms"]; ok {
+			return ""
+		}
+		bpc, _ := doc.resolve(s.dict["BitsPerComponent"]).(int)
+		cs, _ := doc.resolve(s.dict["ColorSpace"]).(name)
+		if bpc == 8 && (cs == "DeviceRGB" || cs == "DeviceGray") {
+			return ".png"
+		}
+	}
+	return ""
+}
+
+// image decodes image object
+func (doc *document) image(num int) (image.Image, error) {
+	s, ok := doc.object(num).(stream)
+	if !ok || s.dict["Subtype"] != name("Image") {
+		return nil, fmt.Errorf("object %d is not an image", num)
+	}
+	switch doc.imageExt(s) {
+	case ".jpg":
+		data, err := doc.data(s)
+		if err != nil {
+			return nil, err
+		}
+		img, _, err := image.Decode(bytes.NewReader(data))
+		return img, err
+	case ".png":
+		data, err := doc.decode(s)
+		if err != nil {
+			return nil, err
+		}
+		w, _ := doc.resolve(s.dict["Width"]).(int)
+		h, _ := doc.resolve(s.dict["Height"]).(int)
+		cs, _ := doc.resolve(s.dict["ColorSpace"]).(name)
+		channels := 1
+		if cs == "DeviceRGB" {
+			channels = 3
+		}
+		if w <= 0 || h <= 0 || w > MAX_IMAGE_SIDE || h > MAX_IMAGE_SIDE || len(data) < w*h*channels {
+			return nil, fmt.Errorf("image %d has wrong size", num)
+		}
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				i := (y*w + x) * channels
+				if channels == 3 {
+					img.Set(x, y, color.RGBA{data[i], data[i+1], data[i+2], 0xff})
+				} else {
+					img.Set(x, y, color.Gray{data[i]})
+				}
+			}
+		}
+		return img, nil
+	}
+	return nil, fmt.Errorf("image %d has unsupported format", num)
+}
+
+// Lexer ----------------------------------
+
+type lexer struct {
+	data  []byte
+	pos   int
+	depth int // nesting depth of arrays and dictionaries
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
+
+func isDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.data) {
+		switch c := l.data[l.pos]; {
+		case isSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// keyword consumes kw if it is the next token
+func (l *lexer) keyword(kw string) bool {
+	l.skipSpace()
+	if bytes.HasPrefix(l.data[l.pos:], []byte(kw)) {
+		end := l.pos + len(kw)
+		if end == len(l.data) || isSpace(l.data[end]) || isDelimiter(l.data[end]) {
+			l.pos = end
+			return true
+		}
+	}
+	return false
+}
+
+func (l *lexer) token() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isSpace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+// value parses the next PDF object, nil is returned for null and unknown tokens
+func (l *lexer) value() any {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil
+	}
+	switch c := l.data[l.pos]; {
+	case bytes.HasPrefix(l.data[l.pos:], []byte("<<")):
+		l.pos += 2
+		if l.depth >= MAX_NESTING {
+			return nil
+		}
+		l.depth++
+		defer func() { l.depth-- }()
+		d := dict{}
+		for {
+			l.skipSpace()
+			if l.pos >= len(l.data) {
+				return d
+			}
+			if bytes.HasPrefix(l.data[l.pos:], []byte(">>")) {
+				l.pos += 2
+				return d
+			}
+			key, ok := l.value().(name)
+			if !ok {
+				return d
+			}
+			d[key] = l.value()
+		}
+	case c == '<':
+		l.pos++
+		end := bytes.IndexByte(l.data[l.pos:], '>')
+		if end < 0 {
+			return nil
+		}
+		hex := bytes.Map(func(r rune) rune {
+			if isSpace(byte(r)) {
+				return -1
+			}
+			return r
+		}, l.data[l.pos:l.pos+end])
+		l.pos += end + 1
+		if len(hex)%2 == 1 {
+			hex = append(hex, '0')
+		}
+		b := make([]byte, len(hex)/2)
+		for i := range b {
+			v, _ := strconv.ParseUint(string(hex[2*i:2*i+2]), 16, 8)
+			b[i] = byte(v)
+		}
+		return string(b)
+	case c == '[':
+		l.pos++
+		if l.depth >= MAX_NESTING {
+			return nil
+		}
+		l.depth++
+		defer func() { l.depth-- }()
+		a := []any{}
+		for {
+			l.skipSpace()
+			if l.pos >= len(l.data) {
+				return a
+			}
+			if l.data[l.pos] == ']' {
+				l.pos++
+				return a
+			}
+			a = append(a, l.value())
+		}
+	case c == '(':
+		return l.literalString()
+	case c == '/':
+		l.pos++
+		n := l.token()
+		if strings.Contains(n, "#") {
+			var b strings.Builder
+			for i := 0; i < len(n); i++ {
+				if n[i] == '#' && i+2 < len(n) {
+					if v, err := strconv.ParseUint(n[i+1:i+3], 16, 8); err == nil {
+						b.WriteByte(byte(v))
+						i += 2
+						continue
+					}
+				}
+				b.WriteByte(n[i])
+			}
+			n = b.String()
+		}
+		return name(n)
+	case c == ']' || c == '>' || c == ')' || c == '{' || c == '}':
+		l.pos++
+		return nil
+	}
+	tok := l.token()
+	if tok == "" {
+		l.pos++
+		return nil
+	}
+	switch tok {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	if i, err := strconv.Atoi(tok); err == nil {
+		// check for indirect reference "num gen R"
+		save := l.pos
+		l.skipSpace()
+		if gen, err := strconv.Atoi(l.token()); err == nil && l.keyword("R") {
+			return ref{num: i, gen: gen}
+		}
+		l.pos = save
+		return i
+	}
+	if f, err := strconv.ParseFloat(tok, 64); err == nil {
+		return f
+	}
+	return nil
+}
+
+func (l *lexer) literalString() string {
+	l.pos++ // skip (
+	var b bytes.Buffer
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return b.String()
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return b.String()
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+			case '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					b.WriteByte(byte(v))
+				} else {
+					b.WriteByte(e)
+				}
+			}
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
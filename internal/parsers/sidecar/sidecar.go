@@ -0,0 +1,277 @@
+package sidecar
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/vinser/flibgolite/internal/core/model"
+	"github.com/vinser/flibgolite/internal/parsers"
+	"github.com/vinser/flibgolite/internal/parsers/epub"
+	"gopkg.in/yaml.v3"
+)
+
+// Extensions of sidecar files, they are added to the full book file name, e.g. book.fb2.yml or book.pdf.opf
+var Extensions = []string{".yml", ".opf"}
+
+// Metadata are the book fields that override the book file ones, empty fields are kept from the book file
+type Metadata struct {
+	Title      string   `yaml:"title"`
+	Authors    []string `yaml:"authors"`
+	Series     string   `yaml:"series"`
+	SerieNum   string   `yaml:"series_number"`
+	Language   string   `yaml:"language"`
+	Year       string   `yaml:"year"`
+	Annotation string   `yaml:"annotation"`
+	Keywords   string   `yaml:"keywords"`
+	Genres     []string `yaml:"genres"`
+	ISBN       string   `yaml:"isbn"`
+	Publisher  string   `yaml:"publisher"`
+	City       string   `yaml:"city"`
+	SrcLang    string   `yaml:"src_language"`
+	SrcTitle   string   `yaml:"src_title"`
+}
+
+// BookName returns the name of the book file the sidecar file belongs to,
+// ok is false if name is not a sidecar file name
+func BookName(name string) (book string, ok bool) {
+	ext := strings.ToLower(path.Ext(name))
+	if !slices.Contains(Extensions, ext) {
+		return "", false
+	}
+	book = name[:len(name)-len(ext)]
+	if path.Ext(book) == "" {
+		return "", false
+	}
+	return book, true
+}
+
+// Names returns the possible sidecar file names of the book file in the order they are looked for
+func Names(book string) []string {
+	names := make([]string, 0, len(Extensions))
+	for _, ext := range Extensions {
+		names = append(names, book+ext)
+	}
+	return names
+}
+
+// Find reads the first sidecar file found next to the book file, metadata are nil if there is none
+func Find(bookPath string) (*Metadata, error) {
+	for _, name := range Names(bookPath) {
+		f, err := os.Open(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return Parse(name, f)
+	}
+	return nil, nil
+}
+
+// Parse reads YAML or OPF sidecar file content according to the file name extension
+func Parse(name string, r io.Reader) (*Metadata, error) {
+	if strings.ToLower(path.Ext(name)) == ".opf" {
+		opf, err := epub.ParseOPF(r)
+		if err != nil {
+			return nil, err
+		}
+		return fromOPF(opf), nil
+	}
+	m := &Metadata{}
+	if err := yaml.NewDecoder(r).Decode(m); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return m, nil
+}
+
+// fromOPF takes the metadata present in OPF file, OPF subjects are free keywords but not genres.
+// Creators of other roles than author do not override the book authors
+func fromOPF(opf *epub.OPF) *Metadata {
+	m := &Metadata{
+		Title:     opf.GetTitle(),
+		Year:      opf.GetYear(),
+		Keywords:  opf.GetKeywords(),
+		ISBN:      opf.GetISBN(),
+		Publisher: opf.GetPublisher(),
+	}
+	if series := opf.GetSeries(); len(series) > 0 {
+		m.Series, m.SerieNum = series[0].Name, series[0].Number
+	}
+	if len(opf.Metadata.Description) > 0 {
+		m.Annotation = opf.GetPlot()
+	}
+	if len(opf.Metadata.Language) > 0 {
+		m.Language = opf.Metadata.Language[0]
+	}
+	for _, a := range opf.GetAuthors() {
+		if a.Name != parsers.NO_AUTHOR {
+			m.Authors = append(m.Authors, strings.Join(strings.Fields(a.Name), " "))
+		}
+	}
+	return m
+}
+
+// Override returns parser p with the fields replaced by the sidecar metadata
+func Override(p parsers.Parser, m *Metadata) *Book {
+	return &Book{Parser: p, Metadata: m}
+}
+
+// Book is the book file parser with the fields overridden by sidecar metadata
+type Book struct {
+	parsers.Parser
+	Metadata *Metadata
+}
+
+func (b *Book) GetTitle() string {
+	if title := strings.TrimSpace(b.Metadata.Title); title != "" {
+		return title
+	}
+	return b.Parser.GetTitle()
+}
+
+func (b *Book) GetSort() string {
+	if strings.TrimSpace(b.Metadata.Title) == "" && strings.TrimSpace(b.Metadata.Language) == "" {
+		return b.Parser.GetSort()
+	}
+	return parsers.GetSortTitle(b.GetTitle(), parsers.GetLanguageTag(b.GetLanguage().Code))
+}
+
+func (b *Book) GetYear() string {
+	if year := parsers.PickYear(b.Metadata.Year); year != "" {
+		return year
+	}
+	return b.Parser.GetYear()
+}
+
+func (b *Book) GetPlot() string {
+	if plot := strings.TrimSpace(b.Metadata.Annotation); plot != "" {
+		return plot
+	}
+	return b.Parser.GetPlot()
+}
+
+func (b *Book) GetLanguage() *model.Language {
+	if lang := strings.TrimSpace(b.Metadata.Language); lang != "" {
+		return parsers.GetLanguage(lang)
+	}
+	return b.Parser.GetLanguage()
+}
+
+func (b *Book) GetAuthors() []*model.Author {
+	authors := []*model.Author{}
+	for _, name := range b.Metadata.Authors {
+		if a := parsers.AuthorByFullName(name); a.Sort != "" {
+			authors = append(authors, a)
+		}
+	}
+	if len(authors) == 0 {
+		return b.Parser.GetAuthors()
+	}
+	return authors
+}
+
+func (b *Book) GetContributors() []*model.Contributor {
+	return parsers.Contributors(b.Parser)
+}
+
+func (b *Book) GetPages() int {
+	return parsers.Pages(b.Parser)
+}
+
+func (b *Book) GetGenres() []string {
+	if len(b.Metadata.Genres) > 0 {
+		return b.Metadata.Genres
+	}
+	return b.Parser.GetGenres()
+}
+
+func (b *Book) GetKeywords() string {
+	if keywords := strings.TrimSpace(b.Metadata.Keywords); keywords != "" {
+		return keywords
+	}
+	return b.Parser.GetKeywords()
+}
+
+func (b *Book) GetSerie() *model.Serie {
+	if serie := strings.TrimSpace(b.Metadata.Series); serie != "" {
+		return &model.Serie{Name: serie}
+	}
+	return b.Parser.GetSerie()
+}
+
+func (b *Book) GetSerieNumber() int {
+	if num := strings.TrimSpace(b.Metadata.SerieNum); num != "" {
+		return parsers.SerieNumber(num)
+	}
+	return b.Parser.GetSerieNumber()
+}
+
+// GetSeries returns the sidecar series instead of all the book file ones,
+// the sidecar series number alone replaces the number of the main book file series
+func (b *Book) GetSeries() []*model.BookSerie {
+	num := strings.TrimSpace(b.Metadata.SerieNum)
+	if serie := strings.TrimSpace(b.Metadata.Series); serie != "" {
+		return []*model.BookSerie{{Serie: model.Serie{Name: serie}, Number: num}}
+	}
+	series := parsers.Series(b.Parser)
+	if num != "" {
+		main := b.Parser.GetSerie().Name
+		for _, s := range series {
+			if s.Name == main {
+				s.Number = num
+				break
+			}
+		}
+	}
+	return series
+}
+
+func (b *Book) GetISBN() string {
+	if isbn := parsers.ISBNs(b.Metadata.ISBN); isbn != "" {
+		return isbn
+	}
+	return b.Parser.GetISBN()
+}
+
+func (b *Book) GetPublisher() string {
+	if publisher := strings.TrimSpace(b.Metadata.Publisher); publisher != "" {
+		return publisher
+	}
+	return b.Parser.GetPublisher()
+}
+
+func (b *Book) GetCity() string {
+	if city := strings.TrimSpace(b.Metadata.City); city != "" {
+		return city
+	}
+	return b.Parser.GetCity()
+}
+
+func (b *Book) GetSrcLanguage() string {
+	if lang := strings.TrimSpace(b.Metadata.SrcLang); lang != "" {
+		return strings.ToLower(lang)
+	}
+	return b.Parser.GetSrcLanguage()
+}
+
+func (b *Book) GetSrcTitle() string {
+	if title := strings.TrimSpace(b.Metadata.SrcTitle); title != "" {
+		return title
+	}
+	return b.Parser.GetSrcTitle()
+}
+
+// GetTextSample passes the book text beginning through for language detection
+func (b *Book) GetTextSample() string {
+	if ts, ok := b.Parser.(parsers.TextSampler); ok {
+		return ts.GetTextSample()
+	}
+	return ""
+}
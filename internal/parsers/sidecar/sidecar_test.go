@@ -0,0 +1,272 @@
+package sidecar
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/vinser/flibgolite/internal/core/model"
+	"github.com/vinser/flibgolite/internal/parsers"
+)
+
+func TestBookName(t *testing.T) {
+	var testNames = []struct {
+		name string
+		book string
+		ok   bool
+	}{
+		{"book.fb2.yml", "book.fb2", true},
+		{"book.pdf.opf", "book.pdf", true},
+		{"Book.EPUB.YML", "Book.EPUB", true},
+		{"dir/book.fb2.yml", "dir/book.fb2", true},
+		{"book.yml", "", false},
+		{"book.fb2", "", false},
+		{"metadata.opf", "", false},
+		{"book.fb2.yaml", "", false},
+	}
+
+	for _, n := range testNames {
+		if book, ok := BookName(n.name); book != n.book || ok != n.ok {
+			t.Errorf("%s: expecting %q %v, got: %q %v", n.name, n.book, n.ok, book, ok)
+		}
+	}
+}
+
+const testYAML = `
+title: Новое название
+authors:
+  - Лев Толстой
+  - Jane Doe
+series: Собрание сочинений
+series_number: "5"
+language: ru
+year: "1869"
+annotation: Роман-эпопея
+keywords: война, мир
+genres: [prose_rus_classic]
+isbn: 978-0-306-40615-7
+publisher: Наука
+city: Москва
+src_language: EN
+src_title: War and Peace
+`
+
+const testOPF = `<?xml version="1.0" encoding="utf-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:opf="http://www.idpf.org/2007/opf">
+    <dc:title>OPF Title</dc:title>
+    <dc:creator opf:role="aut">Jane Doe</dc:creator>
+    <dc:language>en</dc:language>
+    <dc:date>2001-02-03</dc:date>
+    <dc:description>&lt;p&gt;About the &lt;b&gt;book&lt;/b&gt;&lt;/p&gt;</dc:description>
+    <dc:subject>sf</dc:subject>
+    <dc:subject>robots</dc:subject>
+    <dc:identifier opf:scheme="ISBN">978-0-306-40615-7</dc:identifier>
+    <dc:publisher>Publisher</dc:publisher>
+    <meta name="calibre:series" content="OPF Series"/>
+    <meta name="calibre:series_index" content="2.0"/>
+  </metadata>
+</package>`
+
+func TestParse(t *testing.T) {
+	var testSidecars = []struct {
+		name string
+		data string
+		meta *Metadata
+		err  bool
+	}{
+		{
+			"book.fb2.yml", testYAML,
+			&Metadata{
+				Title: "Новое название", Authors: []string{"Лев Толстой", "Jane Doe"}, Series: "Собрание сочинений", SerieNum: "5",
+				Language: "ru", Year: "1869", Annotation: "Роман-эпопея", Keywords: "война, мир", Genres: []string{"prose_rus_classic"},
+				ISBN: "978-0-306-40615-7", Publisher: "Наука", City: "Москва", SrcLang: "EN", SrcTitle: "War and Peace",
+			},
+			false,
+		},
+		{"book.fb2.yml", "", &Metadata{}, false},
+		{"book.fb2.yml", "title: [unclosed", nil, true},
+		{
+			"book.pdf.OPF", testOPF,
+			&Metadata{
+				Title: "OPF Title", Authors: []string{"Jane Doe"}, Series: "OPF Series", SerieNum: "2", Language: "en", Year: "2001",
+				Annotation: "About the book", Keywords: "sf robots", ISBN: "9780306406157", Publisher: "Publisher",
+			},
+			false,
+		},
+		{
+			"book.pdf.opf",
+			strings.Replace(testOPF, `<dc:creator opf:role="aut">Jane Doe</dc:creator>`, `<dc:creator opf:role="trl">Jane Doe</dc:creator><dc:creator opf:role="ill">John Roe</dc:creator>`, 1),
+			&Metadata{
+				Title: "OPF Title", Series: "OPF Series", SerieNum: "2", Language: "en", Year: "2001",
+				Annotation: "About the book", Keywords: "sf robots", ISBN: "9780306406157", Publisher: "Publisher",
+			},
+			false,
+		},
+		{"book.pdf.opf", "<package", nil, true},
+	}
+
+	for _, s := range testSidecars {
+		m, err := Parse(s.name, strings.NewReader(s.data))
+		if (err != nil) != s.err {
+			t.Errorf("%s %.20q: expecting error %v, got: %v", s.name, s.data, s.err, err)
+			continue
+		}
+		if !reflect.DeepEqual(m, s.meta) {
+			t.Errorf("%s %.20q: expecting %+v, got: %+v", s.name, s.data, s.meta, m)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	dir := t.TempDir()
+	book := filepath.Join(dir, "book.fb2")
+	if m, err := Find(book); m != nil || err != nil {
+		t.Errorf("Expecting no sidecar, got: %+v %v", m, err)
+	}
+	os.WriteFile(book+".opf", []byte(testOPF), 0644)
+	if m, err := Find(book); err != nil || m == nil || m.Title != "OPF Title" {
+		t.Errorf("Expecting OPF sidecar, got: %+v %v", m, err)
+	}
+	os.WriteFile(book+".yml", []byte("title: YAML Title"), 0644)
+	if m, err := Find(book); err != nil || m == nil || m.Title != "YAML Title" {
+		t.Errorf("Expecting YAML sidecar found first, got: %+v %v", m, err)
+	}
+}
+
+// testParser is the book file parser the sidecar metadata override
+type testParser struct {
+	series []*model.BookSerie
+}
+
+func (p *testParser) GetFormat() string            { return "fb2" }
+func (p *testParser) GetTitle() string             { return "The Title" }
+func (p *testParser) GetSort() string              { return "PARSER SORT" }
+func (p *testParser) GetYear() string              { return "2000" }
+func (p *testParser) GetPlot() string              { return "Parser plot" }
+func (p *testParser) GetCover() string             { return "cover.jpg" }
+func (p *testParser) GetLanguage() *model.Language { return parsers.GetLanguage("en") }
+func (p *testParser) GetAuthors() []*model.Author {
+	return []*model.Author{parsers.AuthorByFullName("John Roe")}
+}
+func (p *testParser) GetGenres() []string           { return []string{"sf"} }
+func (p *testParser) GetKeywords() string           { return "parser keywords" }
+func (p *testParser) GetSerie() *model.Serie        { return &p.series[0].Serie }
+func (p *testParser) GetSerieNumber() int           { return 1 }
+func (p *testParser) GetSeries() []*model.BookSerie { return p.series }
+func (p *testParser) GetISBN() string               { return "0306406152" }
+func (p *testParser) GetPublisher() string          { return "Parser Publisher" }
+func (p *testParser) GetCity() string               { return "London" }
+func (p *testParser) GetSrcLanguage() string        { return "" }
+func (p *testParser) GetSrcTitle() string           { return "" }
+
+func newTestParser() *testParser {
+	return &testParser{series: []*model.BookSerie{
+		{Serie: model.Serie{Name: "Main Series"}, Number: "1"},
+		{Serie: model.Serie{Name: "Publisher Series"}, Role: "publisher", Number: "12"},
+	}}
+}
+
+// bookFields returns the book fields in the form they are compared
+func bookFields(b parsers.Parser) map[string]string {
+	authors := []string{}
+	for _, a := range b.GetAuthors() {
+		authors = append(authors, a.Sort)
+	}
+	series := []string{}
+	for _, s := range parsers.Series(b) {
+		series = append(series, s.Name+" #"+s.Number)
+	}
+	return map[string]string{
+		"title":     b.GetTitle(),
+		"sort":      b.GetSort(),
+		"year":      b.GetYear(),
+		"plot":      b.GetPlot(),
+		"cover":     b.GetCover(),
+		"language":  b.GetLanguage().Code,
+		"authors":   strings.Join(authors, "; "),
+		"genres":    strings.Join(b.GetGenres(), " "),
+		"keywords":  b.GetKeywords(),
+		"serie":     b.GetSerie().Name,
+		"number":    strconv.Itoa(b.GetSerieNumber()),
+		"series":    strings.Join(series, "; "),
+		"isbn":      b.GetISBN(),
+		"publisher": b.GetPublisher(),
+		"city":      b.GetCity(),
+		"srcLang":   b.GetSrcLanguage(),
+		"srcTitle":  b.GetSrcTitle(),
+	}
+}
+
+func TestOverride(t *testing.T) {
+	parser := bookFields(newTestParser())
+	var testOverrides = []struct {
+		name    string
+		meta    *Metadata
+		changed map[string]string // fields other than parser ones
+	}{
+		{"empty sidecar", &Metadata{}, nil},
+		{
+			"blank fields",
+			&Metadata{Title: " ", Authors: []string{" "}, Series: " ", SerieNum: " ", Language: " ", Year: "unknown", ISBN: "none"},
+			nil,
+		},
+		{
+			"title",
+			&Metadata{Title: " A New Title "},
+			map[string]string{"title": "A New Title", "sort": "NEW TITLE"},
+		},
+		{
+			"language",
+			&Metadata{Language: "ru"},
+			map[string]string{"language": "ru", "sort": "THE TITLE"},
+		},
+		{
+			"authors",
+			&Metadata{Authors: []string{"Jane Doe", "", "Лев Толстой"}},
+			map[string]string{"authors": "DOE, JANE; ТОЛСТОЙ, ЛЕВ"},
+		},
+		{
+			"series",
+			&Metadata{Series: "Sidecar Series", SerieNum: "3"},
+			map[string]string{"serie": "Sidecar Series", "number": "3", "series": "Sidecar Series #3"},
+		},
+		{
+			"series without number",
+			&Metadata{Series: "Sidecar Series"},
+			map[string]string{"serie": "Sidecar Series", "series": "Sidecar Series #"},
+		},
+		{
+			"series number alone",
+			&Metadata{SerieNum: "2"},
+			map[string]string{"number": "2", "series": "Main Series #2; Publisher Series #12"},
+		},
+		{
+			"other fields",
+			&Metadata{
+				Year: "published in 1999", Annotation: "Sidecar plot", Keywords: "sidecar", Genres: []string{"prose", "humor"},
+				ISBN: "ISBN 978-0-306-40615-7", Publisher: "Sidecar Publisher", City: "Paris", SrcLang: "FR", SrcTitle: "Le Titre",
+			},
+			map[string]string{
+				"year": "1999", "plot": "Sidecar plot", "keywords": "sidecar", "genres": "prose humor", "isbn": "9780306406157",
+				"publisher": "Sidecar Publisher", "city": "Paris", "srcLang": "fr", "srcTitle": "Le Titre",
+			},
+		},
+	}
+
+	for _, o := range testOverrides {
+		fields := bookFields(Override(newTestParser(), o.meta))
+		for name, value := range fields {
+			want, ok := o.changed[name]
+			if !ok {
+				want = parser[name]
+			}
+			if value != want {
+				t.Errorf("%s: expecting %s %q, got: %q", o.name, name, want, value)
+			}
+		}
+	}
+}
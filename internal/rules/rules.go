@@ -0,0 +1,279 @@
+package rules
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/vinser/flibgolite/internal/core/model"
+	"github.com/vinser/flibgolite/internal/parsers"
+	"gopkg.in/yaml.v3"
+)
+
+// See rules.yml for comments about these structs
+
+type Rules struct {
+	Rules []*Rule `yaml:"rules"`
+}
+
+type Rule struct {
+	Name    string  `yaml:"name"`
+	Match   Match   `yaml:"match"`
+	Actions Actions `yaml:"actions"`
+
+	author, title, series, genre, language, archive *regexp.Regexp
+}
+
+type Match struct {
+	Author   string `yaml:"author"`
+	Title    string `yaml:"title"`
+	Series   string `yaml:"series"`
+	Genre    string `yaml:"genre"`
+	Language string `yaml:"language"`
+	Archive  string `yaml:"archive"`
+}
+
+type Actions struct {
+	RenameAuthor    string   `yaml:"rename_author"`
+	SetSeries       string   `yaml:"set_series"`
+	SetSeriesNumber string   `yaml:"set_series_number"`
+	AddGenres       []string `yaml:"add_genres"`
+	ReplaceGenres   []string `yaml:"replace_genres"`
+	Reject          bool     `yaml:"reject"`
+}
+
+// Change is a book field changed by the rule, rejected book has "reject" field changed
+type Change struct {
+	Rule  string
+	Field string
+	Old   string
+	New   string
+}
+
+//go:embed rules.yml
+var RULES_YML string
+
+// LoadRules reads and checks the rules file, the file with commented examples is created if it does not exist
+func LoadRules(rulesFile string) (*Rules, error) {
+	b, err := os.ReadFile(rulesFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		if err := os.WriteFile(rulesFile, []byte(RULES_YML), 0664); err != nil {
+			return nil, err
+		}
+		b = []byte(RULES_YML)
+	} else if err != nil {
+		return nil, err
+	}
+	rs := &Rules{}
+	if err := yaml.Unmarshal(b, rs); err != nil {
+		return nil, fmt.Errorf("rules file %s: %s", rulesFile, err)
+	}
+	for i, r := range rs.Rules {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if err := r.compile(); err != nil {
+			return nil, fmt.Errorf("rules file %s, %s: %s", rulesFile, r.Name, err)
+		}
+	}
+	return rs, nil
+}
+
+// compile compiles the match conditions and checks that actions have the conditions they refer to
+func (r *Rule) compile() error {
+	for _, c := range []struct {
+		name string
+		expr string
+		re   **regexp.Regexp
+	}{
+		{"author", r.Match.Author, &r.author},
+		{"title", r.Match.Title, &r.title},
+		{"series", r.Match.Series, &r.series},
+		{"genre", r.Match.Genre, &r.genre},
+		{"language", r.Match.Language, &r.language},
+		{"archive", r.Match.Archive, &r.archive},
+	} {
+		if c.expr == "" {
+			continue
+		}
+		re, err := regexp.Compile(c.expr)
+		if err != nil {
+			return fmt.Errorf("%s condition: %s", c.name, err)
+		}
+		*c.re = re
+	}
+	switch {
+	case r.Actions.RenameAuthor != "" && r.author == nil:
+		return fmt.Errorf("rename_author action needs author condition")
+	case len(r.Actions.ReplaceGenres) > 0 && r.genre == nil:
+		return fmt.Errorf("replace_genres action needs genre condition")
+	}
+	return nil
+}
+
+// Apply changes the book with the matching rules in order and returns the changes made,
+// rejectedBy is the name of the rule that rejected the book, no rules are applied after it
+func (rs *Rules) Apply(b *model.Book) (changes []Change, rejectedBy string) {
+	if rs == nil {
+		return nil, ""
+	}
+	for _, r := range rs.Rules {
+		if !r.matches(b) {
+			continue
+		}
+		if r.Actions.Reject {
+			return append(changes, Change{Rule: r.Name, Field: "reject", New: "true"}), r.Name
+		}
+		changes = append(changes, r.apply(b)...)
+	}
+	return changes, ""
+}
+
+// Len returns the number of rules
+func (rs *Rules) Len() int {
+	if rs == nil {
+		return 0
+	}
+	return len(rs.Rules)
+}
+
+// matches reports whether the book meets all the rule conditions
+func (r *Rule) matches(b *model.Book) bool {
+	switch {
+	case r.title != nil && !r.title.MatchString(b.Title),
+		r.series != nil && !r.series.MatchString(serieName(b)),
+		r.language != nil && (b.Language == nil || !r.language.MatchString(b.Language.Code)),
+		r.archive != nil && !r.archive.MatchString(b.Archive):
+		return false
+	case r.author != nil && !slices.ContainsFunc(b.Authors, func(a *model.Author) bool { return r.author.MatchString(authorName(a)) }),
+		r.genre != nil && !slices.ContainsFunc(b.Genres, r.genre.MatchString):
+		return false
+	}
+	return true
+}
+
+// apply runs the rule actions on the matched book
+func (r *Rule) apply(b *model.Book) (changes []Change) {
+	change := func(field, old, new string) {
+		if old != new {
+			changes = append(changes, Change{Rule: r.Name, Field: field, Old: old, New: new})
+		}
+	}
+	if r.Actions.RenameAuthor != "" {
+		old := authorNames(b.Authors)
+		authors := make([]*model.Author, 0, len(b.Authors))
+		for _, a := range b.Authors {
+			if m := r.author.FindStringSubmatchIndex(authorName(a)); m != nil {
+				if name := string(r.author.ExpandString(nil, r.Actions.RenameAuthor, authorName(a), m)); strings.TrimSpace(name) != "" {
+					a = parsers.AuthorByFullName(name)
+				}
+			}
+			if !slices.ContainsFunc(authors, func(other *model.Author) bool { return other.Sort == a.Sort }) {
+				authors = append(authors, a)
+			}
+		}
+		b.Authors = authors
+		change("authors", old, authorNames(b.Authors))
+	}
+	if r.Actions.SetSeries != "" || r.Actions.SetSeriesNumber != "" {
+		old, oldNum := serieName(b), serieNumber(b)
+		name, num := r.expandSeries(b, r.Actions.SetSeries), r.expandSeries(b, r.Actions.SetSeriesNumber)
+		main := mainSerie(b)
+		if name != "" {
+			b.Serie = &model.Serie{Name: name}
+			if main == nil {
+				main = &model.BookSerie{}
+				b.Series = append(b.Series, main)
+			}
+			main.Name = name
+		}
+		if num != "" {
+			b.SerieNum = parsers.SerieNumber(num)
+			if main != nil {
+				main.Number = num
+			}
+		}
+		change("series", old, serieName(b))
+		change("series number", oldNum, serieNumber(b))
+	}
+	if len(r.Actions.AddGenres) > 0 || len(r.Actions.ReplaceGenres) > 0 {
+		old := strings.Join(b.Genres, ", ")
+		genres := make([]string, 0, len(b.Genres)+len(r.Actions.AddGenres)+len(r.Actions.ReplaceGenres))
+		for _, g := range b.Genres {
+			if len(r.Actions.ReplaceGenres) > 0 && r.genre.MatchString(g) {
+				continue
+			}
+			genres = append(genres, g)
+		}
+		for _, g := range slices.Concat(r.Actions.ReplaceGenres, r.Actions.AddGenres) {
+			if !slices.Contains(genres, g) {
+				genres = append(genres, g)
+			}
+		}
+		b.Genres = genres
+		change("genres", old, strings.Join(b.Genres, ", "))
+	}
+	return changes
+}
+
+// expandSeries replaces $1, $2... in template with the groups matched by series condition
+func (r *Rule) expandSeries(b *model.Book, template string) string {
+	if template == "" || r.series == nil {
+		return template
+	}
+	name := serieName(b)
+	m := r.series.FindStringSubmatchIndex(name)
+	if m == nil {
+		return template
+	}
+	return strings.TrimSpace(string(r.series.ExpandString(nil, template, name, m)))
+}
+
+func serieName(b *model.Book) string {
+	if b.Serie == nil {
+		return ""
+	}
+	return b.Serie.Name
+}
+
+// mainSerie returns the main series entry of the book series list, nil if there is none
+func mainSerie(b *model.Book) *model.BookSerie {
+	name := serieName(b)
+	if name == "" {
+		return nil
+	}
+	if i := slices.IndexFunc(b.Series, func(s *model.BookSerie) bool { return s.Name == name }); i >= 0 {
+		return b.Series[i]
+	}
+	return nil
+}
+
+// serieNumber is the main series number as it is in the book
+func serieNumber(b *model.Book) string {
+	if s := mainSerie(b); s != nil && s.Number != "" {
+		return s.Number
+	}
+	if b.SerieNum > 0 {
+		return strconv.Itoa(b.SerieNum)
+	}
+	return ""
+}
+
+// authorName is the author full name with collapsed spaces as it is matched by author condition
+func authorName(a *model.Author) string {
+	return strings.TrimSpace(parsers.CollapseSpaces(a.Name))
+}
+
+func authorNames(authors []*model.Author) string {
+	names := make([]string, 0, len(authors))
+	for _, a := range authors {
+		names = append(names, authorName(a))
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,169 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vinser/flibgolite/internal/core/model"
+	"github.com/vinser/flibgolite/internal/parsers"
+)
+
+func loadRules(t *testing.T, yml string) *Rules {
+	file := filepath.Join(t.TempDir(), "rules.yml")
+	if err := os.WriteFile(file, []byte(yml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rs, err := LoadRules(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rs
+}
+
+func newBook(authors []string, serie, num string, genres ...string) *model.Book {
+	b := &model.Book{
+		Title:    "Book",
+		Language: &model.Language{Code: "ru"},
+		Serie:    &model.Serie{Name: serie},
+		Genres:   genres,
+		Series:   []*model.BookSerie{},
+	}
+	for _, a := range authors {
+		b.Authors = append(b.Authors, parsers.AuthorByFullName(a))
+	}
+	if serie != "" {
+		b.Series = append(b.Series, &model.BookSerie{Serie: model.Serie{Name: serie}, Number: num})
+		b.SerieNum = parsers.SerieNumber(num)
+	}
+	return b
+}
+
+func TestApply(t *testing.T) {
+	var testRules = []struct {
+		name     string
+		rules    string
+		book     *model.Book
+		authors  string
+		serie    string
+		num      string
+		genres   string
+		changes  int
+		rejected string
+	}{
+		{
+			"rename author with groups",
+			`rules: [{match: {author: '^(\pL)\. ?(\pL+)$'}, actions: {rename_author: '${1}ev $2'}}]`,
+			newBook([]string{"L. Tolstoy", "Anna Karenina"}, "", ""),
+			"Lev Tolstoy, Anna Karenina", "", "", "", 1, "",
+		},
+		{
+			"rename authors to the same one",
+			`rules: [{match: {author: '(?i)^(л\.? ?н\.?|лев) толстой$'}, actions: {rename_author: 'Лев Николаевич Толстой'}}]`,
+			newBook([]string{"Л.Н. Толстой", "Лев Толстой"}, "", ""),
+			"Лев Николаевич Толстой", "", "", "", 1, "",
+		},
+		{
+			"empty new author name",
+			`rules: [{match: {author: '^(X*)Anon$'}, actions: {rename_author: '$1'}}]`,
+			newBook([]string{"Anon"}, "", ""),
+			"Anon", "", "", "", 0, "",
+		},
+		{
+			"set series and number",
+			`rules: [{match: {series: '^(.+?)[ .,-]*(?:#|№|vol\.?|том) ?(\d+)$'}, actions: {set_series: '$1', set_series_number: '$2'}}]`,
+			newBook([]string{"Author"}, "Saga vol. 3", ""),
+			"Author", "Saga", "3", "", 2, "",
+		},
+		{
+			"set series number only",
+			`rules: [{match: {series: '^Saga$'}, actions: {set_series_number: '2.5'}}]`,
+			newBook([]string{"Author"}, "Saga", "2"),
+			"Author", "Saga", "2.5", "", 1, "",
+		},
+		{
+			"set series of book without series",
+			`rules: [{match: {title: '^Book$'}, actions: {set_series: 'New', set_series_number: 'IV'}}]`,
+			newBook([]string{"Author"}, "", ""),
+			"Author", "New", "IV", "", 2, "",
+		},
+		{
+			"replace genres",
+			`rules: [{match: {genre: '^(sf_etc|science_fiction)$'}, actions: {replace_genres: [sf, sf_space]}}]`,
+			newBook([]string{"Author"}, "", "", "science_fiction", "sf_etc", "prose", "sf"),
+			"Author", "", "", "prose, sf, sf_space", 1, "",
+		},
+		{
+			"add genres",
+			`rules: [{match: {language: '^ru$'}, actions: {add_genres: [prose, prose_rus]}}]`,
+			newBook([]string{"Author"}, "", "", "prose"),
+			"Author", "", "", "prose, prose_rus", 1, "",
+		},
+		{
+			"rules see previous changes",
+			`rules: [{match: {genre: '^unknown$'}, actions: {replace_genres: [sf]}}, {match: {genre: '^sf$'}, actions: {set_series: 'Fantastic'}}]`,
+			newBook([]string{"Author"}, "", "", "unknown"),
+			"Author", "Fantastic", "", "sf", 2, "",
+		},
+		{
+			"all conditions must match",
+			`rules: [{match: {genre: '^sf$', archive: '^kids/'}, actions: {reject: true}}]`,
+			newBook([]string{"Author"}, "", "", "sf"),
+			"Author", "", "", "sf", 0, "",
+		},
+		{
+			"reject stops rules",
+			`rules: [{name: kids, match: {genre: '^comics$'}, actions: {reject: true}}, {actions: {add_genres: [sf]}}]`,
+			newBook([]string{"Author"}, "", "", "comics"),
+			"Author", "", "", "comics", 1, "kids",
+		},
+	}
+
+	for _, r := range testRules {
+		changes, rejectedBy := loadRules(t, r.rules).Apply(r.book)
+		if authors := authorNames(r.book.Authors); authors != r.authors {
+			t.Errorf("%s: expecting authors %q, got: %q", r.name, r.authors, authors)
+		}
+		if serie := serieName(r.book); serie != r.serie {
+			t.Errorf("%s: expecting series %q, got: %q", r.name, r.serie, serie)
+		}
+		if num := serieNumber(r.book); num != r.num {
+			t.Errorf("%s: expecting series number %q, got: %q", r.name, r.num, num)
+		}
+		if r.genres != "" {
+			if genres := strings.Join(r.book.Genres, ", "); genres != r.genres {
+				t.Errorf("%s: expecting genres %q, got: %q", r.name, r.genres, genres)
+			}
+		}
+		if len(changes) != r.changes {
+			t.Errorf("%s: expecting %d changes, got: %v", r.name, r.changes, changes)
+		}
+		if rejectedBy != r.rejected {
+			t.Errorf("%s: expecting rejected by %q, got: %q", r.name, r.rejected, rejectedBy)
+		}
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	var testFiles = []struct {
+		rules string
+		err   bool
+	}{
+		{`rules: [{match: {author: '('}}]`, true},
+		{`rules: [{actions: {rename_author: 'X'}}]`, true},
+		{`rules: [{match: {title: 'X'}, actions: {replace_genres: [sf]}}]`, true},
+		{`rules: [{match: {title: 'X'}, actions: {add_genres: [sf]}}]`, false},
+		{RULES_YML, false},
+	}
+
+	for _, f := range testFiles {
+		file := filepath.Join(t.TempDir(), "rules.yml")
+		if err := os.WriteFile(file, []byte(f.rules), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadRules(file); (err != nil) != f.err {
+			t.Errorf("%s: expecting error %v, got: %v", f.rules, f.err, err)
+		}
+	}
+}
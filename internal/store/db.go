@@ -2,10 +2,14 @@ package store
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	// "sync"
 
@@ -13,7 +17,7 @@ import (
 
 	_ "embed"
 
-	_ "modernc.org/sqlite"
+	"modernc.org/sqlite"
 )
 
 const SQLITE_DB_BUSY_TIMEOUT = 10000
@@ -24,8 +28,17 @@ var SQLITE_DB_INIT string
 //go:embed sqlite_db_drop.sql
 var SQLITE_DB_DROP string
 
+//go:embed sqlite_db_upgrade.sql
+var SQLITE_DB_UPGRADE string
+
+// AllLibraries is the library of database handle that reads the books of all libraries
+const AllLibraries = -1
+
 type DB struct {
 	*sqlx.DB
+	Library int64 // id of the library the books are read from and written to, see ForLibrary
+
+	writer *sync.Mutex // serializes index transactions of the handles sharing the database
 }
 
 // ==================================
@@ -44,18 +57,141 @@ func NewDB(dsn string) (*DB, error) {
 	}
 
 	DB := &DB{
-		DB: db,
+		DB:      db,
+		Library: AllLibraries,
+		writer:  &sync.Mutex{},
 	}
 
 	return DB, nil
 }
 
+// ForLibrary returns the handle sharing the database connections that reads and writes the books of the library
+func (db *DB) ForLibrary(id int64) *DB {
+	return &DB{
+		DB:      db.DB,
+		Library: id,
+		writer:  db.writer,
+	}
+}
+
+// inLibrary returns the condition selecting the books or ingest statuses of the handle library, t is table alias
+func (db *DB) inLibrary(t string) string {
+	if db.Library == AllLibraries {
+		return "1"
+	}
+	return fmt.Sprintf("%s.library_id=%d", t, db.Library)
+}
+
+// visibleBooks returns the condition selecting the books shown in feeds, b is books table alias
+func (db *DB) visibleBooks(b string) string {
+	return fmt.Sprintf("%s.id NOT IN (SELECT book_id FROM versions WHERE canonical=0) AND %s", b, db.inLibrary(b))
+}
+
+// LibraryID returns the id of the library with the name, a new library is added to database
+func (db *DB) LibraryID(name string) (int64, error) {
+	if _, err := db.Exec(`INSERT OR IGNORE INTO libraries (name) VALUES (?)`, name); err != nil {
+		return 0, err
+	}
+	var id int64
+	err := db.QueryRow(`SELECT id FROM libraries WHERE name=?`, name).Scan(&id)
+	return id, err
+}
+
+// SetLibraryID stores the library with the id, e.g. to keep ids of the database being rebuilt
+func (db *DB) SetLibraryID(id int64, name string) error {
+	_, err := db.Exec(`INSERT OR REPLACE INTO libraries (id, name) VALUES (?, ?)`, id, name)
+	return err
+}
+
+// MoveLibrary moves the books and ingest statuses of the library to the library with id to unless the latter has books,
+// e.g. the books indexed before libraries were named. It returns the number of moved books
+func (db *DB) MoveLibrary(from, to int64) (int64, error) {
+	db.writer.Lock()
+	defer db.writer.Unlock()
+	tx, err := db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	var n int64
+	if err := tx.QueryRow(`SELECT count(*) FROM books WHERE library_id=?`, to).Scan(&n); err != nil || n > 0 {
+		return 0, err
+	}
+	res, err := tx.Exec(`UPDATE books SET library_id=? WHERE library_id=?`, to, from)
+	if err != nil {
+		return 0, err
+	}
+	if n, err = res.RowsAffected(); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`UPDATE OR REPLACE ingest_status SET library_id=? WHERE library_id=?`, to, from); err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
 func (db *DB) Close() {
 	db.DB.Close()
 }
 
 func (db *DB) InitDB() {
 	db.execFile(SQLITE_DB_INIT)
+	db.SetCoversID()
+}
+
+// UpgradeDB adds tables missing in databases created by previous versions
+// Upgrade statements must be safe to run on every start
+func (db *DB) UpgradeDB() error {
+	if err := db.execFile(SQLITE_DB_UPGRADE); err != nil {
+		return err
+	}
+	if err := db.addColumn("books", "sha256", "TEXT"); err != nil {
+		return err
+	}
+	if err := db.addColumn("books", "lang_confidence", "REAL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := db.addColumn("books", "library_id", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := db.addColumn("ingest_status", "library_id", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	for _, column := range []string{"isbn", "publisher", "city", "src_lang", "src_title"} {
+		if err := db.addColumn("books", column, "TEXT DEFAULT ''"); err != nil {
+			return err
+		}
+	}
+	if err := db.addColumn("books", "pages", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	for _, q := range []string{
+		`CREATE INDEX IF NOT EXISTS book_sha256_idx ON books (sha256)`,
+		`CREATE INDEX IF NOT EXISTS book_library_idx ON books (library_id)`,
+		`CREATE INDEX IF NOT EXISTS book_isbn_idx ON books (isbn)`,
+		`DROP INDEX IF EXISTS ingest_status_file_idx`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS ingest_status_library_file_idx ON ingest_status (library_id, archive, file)`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			return err
+		}
+	}
+	// databases created before the cover cache had id get a new one
+	_, err := db.Exec(`INSERT OR IGNORE INTO meta (key, value) VALUES ('covers', ?)`, newCoversID())
+	return err
+}
+
+// addColumn adds the column to the table unless it exists, SQLite has no ADD COLUMN IF NOT EXISTS
+func (db *DB) addColumn(table, column, decl string) error {
+	var n int
+	if err := db.QueryRow(`SELECT count(*) FROM pragma_table_info(?) WHERE name=?`, table, column).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	_, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, decl))
+	return err
 }
 
 func (db *DB) DropDB() {
@@ -79,6 +215,71 @@ func (db *DB) IsReady() (bool, error) {
 	return rows.Next(), nil
 }
 
+// BuildID returns the identifier of the index build, it is changed by every full reindex and files requeue
+func (db *DB) BuildID() string {
+	id := ""
+	db.QueryRow(`SELECT value FROM meta WHERE key='build'`).Scan(&id)
+	return id
+}
+
+// SetBuildID stores a new identifier of the index build
+func (db *DB) SetBuildID() error {
+	_, err := db.Exec(`INSERT OR REPLACE INTO meta (key, value) VALUES ('build', ?)`, time.Now().Format(time.RFC3339Nano))
+	return err
+}
+
+// CoversID returns the identifier of the cover cache of the index, it is changed when the index is created or rebuilt,
+// so covers cached by book ids of other index are never served
+func (db *DB) CoversID() string {
+	id := ""
+	db.QueryRow(`SELECT value FROM meta WHERE key='covers'`).Scan(&id)
+	return id
+}
+
+// SetCoversID stores a new identifier of the cover cache
+func (db *DB) SetCoversID() error {
+	_, err := db.Exec(`INSERT OR REPLACE INTO meta (key, value) VALUES ('covers', ?)`, newCoversID())
+	return err
+}
+
+func newCoversID() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// Restore replaces the database content with the content of database file src in one transaction
+// so readers see either the old or the new content and no handles need to be reopened
+func (db *DB) Restore(src string) error {
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(driverConn any) error {
+		c, ok := driverConn.(interface {
+			NewRestore(srcUri string) (*sqlite.Backup, error)
+		})
+		if !ok {
+			return fmt.Errorf("database driver does not support restore")
+		}
+		b, err := c.NewRestore(src)
+		if err != nil {
+			return err
+		}
+		if _, err := b.Step(-1); err != nil {
+			b.Finish()
+			return err
+		}
+		return b.Finish()
+	})
+}
+
+// RemoveFiles removes the database file with its journal files
+func RemoveFiles(dsn string) {
+	for _, suffix := range []string{"", "-wal", "-shm", "-journal"} {
+		os.Remove(dsn + suffix)
+	}
+}
+
 func (db *DB) execFile(sql string) error {
 	scanner := bufio.NewScanner(strings.NewReader(sql))
 	scanner.Split(bufio.ScanLines)
@@ -100,19 +301,32 @@ func (db *DB) execFile(sql string) error {
 // ==================================
 type TX struct {
 	*sqlx.Tx
-	Stmt map[string]*sqlx.Stmt
+	Stmt    map[string]*sqlx.Stmt
+	Library int64 // id of the library new books are added to
+
+	unlock func()
 }
 
+// TxBegin starts the transaction, it waits for the transactions of other libraries to end
 func (db *DB) TxBegin() *TX {
+	db.writer.Lock()
 	TX := &TX{
-		Tx:   db.DB.MustBegin(),
-		Stmt: map[string]*sqlx.Stmt{},
+		Tx:      db.DB.MustBegin(),
+		Stmt:    map[string]*sqlx.Stmt{},
+		Library: max(db.Library, 0), // handle of all libraries writes to the default one
+		unlock:  db.writer.Unlock,
 	}
 	TX.PrepareStatements()
 	return TX
 }
 
 func (tx *TX) TxEnd() {
+	defer func() {
+		if tx.unlock != nil {
+			tx.unlock()
+			tx.unlock = nil
+		}
+	}()
 	defer func() {
 		for _, stmt := range tx.Stmt {
 			stmt.Close()
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpgradeDB(t *testing.T) {
+	baseline, err := os.ReadFile(filepath.Join("testdata", "baseline_db_init.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewDB(filepath.Join(t.TempDir(), "books.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.execFile(string(baseline)); err != nil {
+		t.Fatal(err)
+	}
+	// previous versions added a rejected book row on every scan of the same bad file
+	_, err = db.Exec(`INSERT INTO books (file, archive, crc32, title, serie_id, updated) VALUES
+		('good.fb2', 'a.zip', 1, 'Good', 0, 1700000000),
+		('bad.fb2', 'a.zip', 2, '', 0, -1),
+		('bad.fb2', 'a.zip', 2, '', 0, -2),
+		('bad.fb2', '', 3, '', 0, -1),
+		('', 'bad.zip', 0, '', 0, -3),
+		('', 'bad.zip', 0, '', 0, -3)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := db.UpgradeDB(); err != nil {
+			t.Fatalf("Expecting upgrade %d without error, got: %v", i+1, err)
+		}
+	}
+
+	var testStatuses = []struct {
+		file, archive string
+		state         int
+	}{
+		{"bad.fb2", "a.zip", -2},
+		{"bad.fb2", "", -1},
+		{"", "bad.zip", -3},
+	}
+	n := 0
+	db.QueryRow(`SELECT count(*) FROM ingest_status`).Scan(&n)
+	if n != len(testStatuses) {
+		t.Errorf("Expecting %d ingest statuses, got: %d", len(testStatuses), n)
+	}
+	for _, s := range testStatuses {
+		state := 0
+		db.QueryRow(`SELECT state FROM ingest_status WHERE file=? AND archive=?`, s.file, s.archive).Scan(&state)
+		if state != s.state {
+			t.Errorf("%s %s: expecting state %d, got: %d", s.archive, s.file, s.state, state)
+		}
+	}
+	db.QueryRow(`SELECT count(*) FROM books`).Scan(&n)
+	if n != 1 {
+		t.Errorf("Expecting only good book left, got: %d books", n)
+	}
+}
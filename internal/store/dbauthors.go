@@ -0,0 +1,90 @@
+package store
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/vinser/flibgolite/internal/core/model"
+)
+
+// FindAuthorID returns the author id by the id itself, the exact author name or its alias, 0 if there is no such author
+func (db *DB) FindAuthorID(author string) int64 {
+	var id int64
+	if n, err := strconv.ParseInt(author, 10, 64); err == nil && db.AuthorByID(n) != nil {
+		return n
+	}
+	q := `SELECT id FROM authors WHERE name=ifnull((SELECT name FROM author_aliases WHERE alias=?1), ?1)`
+	db.QueryRow(q, author).Scan(&id)
+	return id
+}
+
+// AuthorAliases returns the canonical authors by their alias names
+func (db *DB) AuthorAliases() (map[string]*model.Author, error) {
+	aliases := make(map[string]*model.Author)
+	rows, err := db.Query(`SELECT alias, name, sort FROM author_aliases`)
+	if err != nil {
+		return aliases, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var alias string
+		a := &model.Author{}
+		if err := rows.Scan(&alias, &a.Name, &a.Sort); err != nil {
+			return aliases, err
+		}
+		aliases[alias] = a
+	}
+	return aliases, rows.Err()
+}
+
+// AddAuthorAlias makes books of the author with alias name to be indexed with the canonical author
+func (db *DB) AddAuthorAlias(alias string, a *model.Author) error {
+	_, err := db.Exec(`INSERT OR REPLACE INTO author_aliases (alias, name, sort) VALUES (?, ?, ?)`, alias, a.Name, a.Sort)
+	return err
+}
+
+// MergeAuthors moves books of the author to the canonical author and removes the author,
+// its name is kept as the alias of the canonical author. It returns the number of moved books
+func (db *DB) MergeAuthors(from, to int64) (int64, error) {
+	if from == to {
+		return 0, fmt.Errorf("author %d cannot be merged with itself", from)
+	}
+	src, dst := db.AuthorByID(from), db.AuthorByID(to)
+	switch {
+	case src == nil:
+		return 0, fmt.Errorf("author %d not found", from)
+	case dst == nil:
+		return 0, fmt.Errorf("author %d not found", to)
+	}
+	db.writer.Lock()
+	defer db.writer.Unlock()
+	tx, err := db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	var moved int64
+	res, err := tx.Exec(`UPDATE books_authors SET author_id=?1 WHERE author_id=?2 AND book_id NOT IN (SELECT book_id FROM books_authors WHERE author_id=?1)`, to, from)
+	if err == nil {
+		moved, err = res.RowsAffected()
+	}
+	if err != nil {
+		return 0, err
+	}
+	for _, q := range []struct {
+		query string
+		args  []any
+	}{
+		{`DELETE FROM books_authors WHERE author_id=?`, []any{from}},
+		{`INSERT INTO authors_fts (authors_fts, rowid, sort) VALUES ('delete', ?, ?)`, []any{from, src.Sort}},
+		{`DELETE FROM authors WHERE id=?`, []any{from}},
+		{`UPDATE author_aliases SET name=?, sort=? WHERE name=?`, []any{dst.Name, dst.Sort, src.Name}},
+		{`INSERT OR REPLACE INTO author_aliases (alias, name, sort) VALUES (?, ?, ?)`, []any{src.Name, dst.Name, dst.Sort}},
+		{`DELETE FROM author_aliases WHERE alias=?`, []any{dst.Name}},
+	} {
+		if _, err := tx.Exec(q.query, q.args...); err != nil {
+			return 0, err
+		}
+	}
+	return moved, tx.Commit()
+}
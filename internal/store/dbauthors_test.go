@@ -0,0 +1,110 @@
+package store
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vinser/flibgolite/internal/core/model"
+)
+
+// testDB returns new empty database of library 1
+func testDB(t *testing.T) *DB {
+	db, err := NewDB(filepath.Join(t.TempDir(), "books.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+	db.InitDB()
+	return db.ForLibrary(1)
+}
+
+// addBook indexes the book of the authors and returns its id
+func addBook(t *testing.T, db *DB, file string, authors ...string) int64 {
+	b := &model.Book{File: file, Title: file, Language: &model.Language{Code: "en"}, Serie: &model.Serie{}}
+	for _, name := range authors {
+		b.Authors = append(b.Authors, &model.Author{Name: name, Sort: strings.ToUpper(name)})
+	}
+	tx := db.TxBegin()
+	defer tx.TxEnd()
+	if err := tx.NewBook(b); err != nil {
+		t.Fatal(err)
+	}
+	return b.ID
+}
+
+// bookAuthors returns the names of the book authors
+func bookAuthors(db *DB, bookId int64) string {
+	names := []string{}
+	for _, a := range db.AuthorsByBookId(bookId) {
+		names = append(names, a.Name)
+	}
+	return strings.Join(names, "; ")
+}
+
+func TestMergeAuthors(t *testing.T) {
+	db := testDB(t)
+	alone := addBook(t, db, "alone.fb2", "Tolstoy Lev")
+	both := addBook(t, db, "both.fb2", "Tolstoy Lev", "Lev Tolstoy")
+	other := addBook(t, db, "other.fb2", "Jane Doe", "Лев Толстой")
+	from, to, canonical := db.FindAuthorID("Tolstoy Lev"), db.FindAuthorID("Lev Tolstoy"), db.FindAuthorID("Лев Толстой")
+
+	var testRejects = []struct {
+		name     string
+		from, to int64
+	}{
+		{"itself", from, from},
+		{"missing canonical", from, 999},
+		{"missing author", 999, to},
+	}
+	for _, r := range testRejects {
+		if moved, err := db.MergeAuthors(r.from, r.to); err == nil || moved != 0 {
+			t.Errorf("%s: expecting error, got: %d moved %v", r.name, moved, err)
+		}
+	}
+	if db.AuthorByID(from) == nil || bookAuthors(db, alone) != "Tolstoy Lev" {
+		t.Fatalf("Expecting rejected merge changes nothing, got: %q", bookAuthors(db, alone))
+	}
+
+	// the book of both authors is not linked to the canonical author twice
+	if moved, err := db.MergeAuthors(from, to); err != nil || moved != 1 {
+		t.Fatalf("Expecting 1 book moved, got: %d %v", moved, err)
+	}
+	// the aliases of merged author follow it to the next canonical author
+	if moved, err := db.MergeAuthors(to, canonical); err != nil || moved != 2 {
+		t.Fatalf("Expecting 2 books moved, got: %d %v", moved, err)
+	}
+
+	var testBooks = []struct {
+		id      int64
+		authors string
+	}{
+		{alone, "Лев Толстой"},
+		{both, "Лев Толстой"},
+		{other, "Jane Doe; Лев Толстой"},
+	}
+	for _, b := range testBooks {
+		if authors := bookAuthors(db, b.id); authors != b.authors {
+			t.Errorf("book %d: expecting authors %q, got: %q", b.id, b.authors, authors)
+		}
+	}
+	if db.AuthorByID(from) != nil || db.AuthorByID(to) != nil {
+		t.Errorf("Expecting merged authors removed")
+	}
+	for _, name := range []string{"Tolstoy Lev", "Lev Tolstoy", "Лев Толстой"} {
+		if id := db.FindAuthorID(name); id != canonical {
+			t.Errorf("%s: expecting canonical author %d, got: %d", name, canonical, id)
+		}
+	}
+
+	// books of merged authors indexed again are linked to the canonical author
+	again := addBook(t, db, "again.fb2", "Tolstoy Lev", "Lev Tolstoy")
+	if authors := bookAuthors(db, again); authors != "Лев Толстой" {
+		t.Errorf("Expecting book indexed with canonical author, got: %q", authors)
+	}
+	var n int
+	db.QueryRow(`SELECT count(*) FROM authors`).Scan(&n)
+	if n != 2 {
+		t.Errorf("Expecting 2 authors left, got: %d", n)
+	}
+}
@@ -0,0 +1,156 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"unicode/utf8"
+
+	"github.com/vinser/flibgolite/internal/core/model"
+)
+
+// ContributorsByBookID returns translators, illustrators and editors of the book
+func (db *DB) ContributorsByBookID(bookId int64) []*model.Contributor {
+	contributors := []*model.Contributor{}
+	q := `
+		SELECT c.id, c.name, c.sort, bc.role
+		FROM books_contributors as bc
+		JOIN contributors as c ON c.id=bc.contributor_id
+		WHERE bc.book_id=?
+		ORDER BY bc.id
+	`
+	rows, err := db.Query(q, bookId)
+	if err != nil {
+		return contributors
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c := &model.Contributor{}
+		if err := rows.Scan(&c.ID, &c.Name, &c.Sort, &c.Role); err != nil {
+			return contributors
+		}
+		contributors = append(contributors, c)
+	}
+	return contributors
+}
+
+// ContributorByID returns the contributor or nil if there is no such one
+func (db *DB) ContributorByID(id int64) *model.Contributor {
+	c := &model.Contributor{}
+	err := db.QueryRow(`SELECT id, name, sort FROM contributors WHERE id=?`, id).Scan(&c.ID, &c.Name, &c.Sort)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	return c
+}
+
+// CountContributors returns the number of the library contributors with the role
+func (db *DB) CountContributors(role string) int {
+	var n int
+	q := `SELECT COUNT(*) FROM contributors WHERE ` + db.libraryContributors("contributors.id", role)
+	db.QueryRow(q).Scan(&n)
+	return n
+}
+
+// ListContributors returns the contributors with the role grouped by sort name prefixes one letter longer than prefix,
+// Sort is the group prefix and Count is the number of contributors in the group
+func (db *DB) ListContributors(role, prefix string) []*model.Contributor {
+	prefixLen := utf8.RuneCountInString(prefix) + 1
+	q := fmt.Sprint(`
+		SELECT SUBSTR(sort,1,`, prefixLen, `) as s, COUNT(*)
+		FROM contributors
+		WHERE sort LIKE ? AND `, db.libraryContributors("contributors.id", role), `
+		GROUP BY s
+	`)
+	rows, err := db.Query(q, prefix+"%")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+	contributors := []*model.Contributor{}
+
+	for rows.Next() {
+		c := &model.Contributor{Role: role}
+		if err := rows.Scan(&c.Sort, &c.Count); err != nil {
+			log.Fatal(err)
+		}
+		contributors = append(contributors, c)
+	}
+	if len(contributors) == 1 && contributors[0].Count > 1 {
+		pref := string([]rune(contributors[0].Sort)[:prefixLen])
+		return db.ListContributors(role, pref)
+	}
+	return contributors
+}
+
+// ListContributorsWithTotals returns the contributors with the role and sort name prefix with their book counts
+func (db *DB) ListContributorsWithTotals(role, prefix string) []*model.Contributor {
+	contributors := []*model.Contributor{}
+	q := `
+		SELECT id, name, sort,
+			(
+				SELECT COUNT(*)
+				FROM books_contributors AS bc
+				JOIN books AS b ON b.id = bc.book_id
+				WHERE bc.contributor_id = contributors.id AND bc.role = ? AND ` + db.visibleBooks("b") + `
+			) AS count
+		FROM contributors
+		WHERE sort LIKE ? AND ` + db.libraryContributors("contributors.id", role) + `
+		ORDER BY sort
+	`
+	rows, err := db.Query(q, role, prefix+"%")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c := &model.Contributor{Role: role}
+		if err := rows.Scan(&c.ID, &c.Name, &c.Sort, &c.Count); err != nil {
+			log.Fatal(err)
+		}
+		if c.Count > 0 {
+			contributors = append(contributors, c)
+		}
+	}
+	return contributors
+}
+
+// ListContributorBooks returns the books page of the contributor with the role
+func (db *DB) ListContributorBooks(id int64, role string, limit, offset int) []*model.Book {
+	q := `
+		SELECT b.id, b.file, b.archive, b.size, b.format, b.title, b.year, b.plot, b.cover, ifnull(s.name, ''), b.serie_num, ifnull(l.code, ''), b.library_id
+		FROM books_contributors as bc
+		JOIN books as b ON b.id=bc.book_id
+		LEFT JOIN series as s ON b.serie_id=s.id
+		JOIN languages as l ON b.language_id=l.id
+		WHERE bc.contributor_id=? AND bc.role=? AND ` + db.visibleBooks("b") + `
+		ORDER BY b.sort
+	`
+	rows, err := db.pageQuery(q, limit, offset, id, role)
+	if err != nil {
+		log.Println("DB page query error: ", err.Error())
+		return []*model.Book{}
+	}
+	defer rows.Close()
+	books := []*model.Book{}
+
+	for rows.Next() {
+		b := &model.Book{
+			Language: &model.Language{},
+			Serie:    &model.Serie{},
+		}
+		if err = rows.Scan(&b.ID, &b.File, &b.Archive, &b.Size, &b.Format, &b.Title, &b.Year, &b.Plot, &b.Cover, &b.Serie.Name, &b.SerieNum, &b.Language.Code, &b.Library); err != nil {
+			log.Fatal(err)
+		}
+		books = append(books, b)
+	}
+	return books
+}
+
+// libraryContributors returns the condition selecting the contributors with the role of the handle library books,
+// id is contributor id column, role is one of model contributor roles
+func (db *DB) libraryContributors(id, role string) string {
+	return fmt.Sprintf("%s IN (SELECT bc.contributor_id FROM books_contributors AS bc JOIN books AS b ON b.id=bc.book_id WHERE bc.role='%s' AND %s)", id, role, db.inLibrary("b"))
+}
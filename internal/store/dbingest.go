@@ -0,0 +1,72 @@
+package store
+
+import (
+	"github.com/vinser/flibgolite/internal/core/model"
+	"github.com/vinser/flibgolite/internal/hash"
+)
+
+// IngestStatuses returns a page of rejected files records with the state, hash.Unique selects all states
+func (db *DB) IngestStatuses(state hash.BookState, limit, offset int) ([]*model.IngestStatus, error) {
+	statuses := []*model.IngestStatus{}
+	q := `SELECT id, file, archive, state, error, updated FROM ingest_status AS s WHERE (state=? OR ?=0) AND ` + db.inLibrary("s") + ` ORDER BY archive, file LIMIT ? OFFSET ?`
+	err := db.Select(&statuses, q, int64(state), int64(state), limit, offset)
+	return statuses, err
+}
+
+// FileIngestStatuses returns the records of the rejected stock file or archive entry
+func (db *DB) FileIngestStatuses(file, archive string) ([]*model.IngestStatus, error) {
+	statuses := []*model.IngestStatus{}
+	q := `SELECT id, file, archive, state, error, updated FROM ingest_status AS s WHERE file=? AND archive=? AND ` + db.inLibrary("s")
+	err := db.Select(&statuses, q, file, archive)
+	return statuses, err
+}
+
+// IngestStatusCount returns the number of rejected files records with the state, hash.Unique counts all states
+func (db *DB) IngestStatusCount(state hash.BookState) int64 {
+	var count int64
+	db.QueryRow(`SELECT count(*) FROM ingest_status AS s WHERE (state=? OR ?=0) AND `+db.inLibrary("s"), int64(state), int64(state)).Scan(&count)
+	return count
+}
+
+// IngestStateCounts returns the numbers of rejected files records by state
+func (db *DB) IngestStateCounts() (map[hash.BookState]int64, error) {
+	counts := map[hash.BookState]int64{}
+	rows, err := db.Query(`SELECT state, count(*) FROM ingest_status AS s WHERE ` + db.inLibrary("s") + ` GROUP BY state`)
+	if err != nil {
+		return counts, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var state, count int64
+		if err := rows.Scan(&state, &count); err != nil {
+			return counts, err
+		}
+		counts[hash.BookState(state)] = count
+	}
+	return counts, rows.Err()
+}
+
+// DeleteIngestStatuses removes records of rejected files, e.g. deleted from the stock
+func (db *DB) DeleteIngestStatuses(statuses []*model.IngestStatus) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, s := range statuses {
+		if _, err := tx.Exec(`DELETE FROM ingest_status WHERE id=?`, s.ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// RequeueIngestStatuses removes records of rejected files with the state, hash.Unique removes all,
+// so the files are processed again by the next scan
+func (db *DB) RequeueIngestStatuses(state hash.BookState) (int64, error) {
+	res, err := db.Exec(`DELETE FROM ingest_status AS s WHERE (state=? OR ?=0) AND `+db.inLibrary("s"), int64(state), int64(state))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -48,10 +48,11 @@ func (db *DB) GetUserByUsername(username string) (user.User, error) {
 
 // Books
 
+// FindBookById returns the book of the handle library, nil if there is no such book
 func (db *DB) FindBookById(id int64) *model.Book {
 	b := &model.Book{}
-	q := `SELECT file, archive, format, title, cover FROM books WHERE id=?`
-	err := db.QueryRow(q, id).Scan(&b.File, &b.Archive, &b.Format, &b.Title, &b.Cover)
+	q := `SELECT b.file, b.archive, b.format, b.title, b.cover, b.library_id FROM books AS b WHERE b.id=? AND ` + db.inLibrary("b")
+	err := db.QueryRow(q, id).Scan(&b.File, &b.Archive, &b.Format, &b.Title, &b.Cover, &b.Library)
 	if err == sql.ErrNoRows {
 		return nil
 	}
@@ -60,7 +61,7 @@ func (db *DB) FindBookById(id int64) *model.Book {
 
 func (db *DB) CountLanguageBooks(languageCode string) int64 {
 	var c int64 = 0
-	q := `SELECT count(*) FROM languages as l, books as b WHERE l.code=? AND b.language_id=l.ID`
+	q := `SELECT count(*) FROM languages as l, books as b WHERE l.code=? AND b.language_id=l.ID AND ` + db.visibleBooks("b")
 	err := db.QueryRow(q, languageCode).Scan(&c)
 	if err == sql.ErrNoRows {
 		return 0
@@ -80,14 +81,14 @@ func (db *DB) ListAuthors(prefix, abc string) []*model.Author {
 			q = `
 			SELECT id, name, SUBSTR(sort,1,1) as s, COUNT(*) 
 			FROM authors 
-			WHERE s IN(` + abc + `) 
+			WHERE s IN(` + abc + `) AND ` + db.libraryAuthors("authors.id") + `
 			GROUP BY s
 		`
 		} else {
 			q = `
 			SELECT id, name, SUBSTR(sort,1,1) as s, COUNT(*) 
 			FROM authors 
-			WHERE sort NOT LIKE '[author not specified]' 
+			WHERE sort NOT LIKE '[author not specified]' AND ` + db.libraryAuthors("authors.id") + `
 			GROUP BY s
 			`
 		}
@@ -96,7 +97,7 @@ func (db *DB) ListAuthors(prefix, abc string) []*model.Author {
 		q = fmt.Sprint(`
 			SELECT id, name, SUBSTR(sort,1,`, fmt.Sprint(prefixLen), `) as s, COUNT(*)
 			FROM authors 
-			WHERE sort LIKE ? 
+			WHERE sort LIKE ? AND `, db.libraryAuthors("authors.id"), `
 			GROUP BY s
 			`)
 		rows, err = db.Query(q, prefix+"%")
@@ -121,6 +122,14 @@ func (db *DB) ListAuthors(prefix, abc string) []*model.Author {
 	return authors
 }
 
+// libraryAuthors returns the condition selecting the authors of the handle library books, id is author id column
+func (db *DB) libraryAuthors(id string) string {
+	if db.Library == AllLibraries {
+		return "1"
+	}
+	return fmt.Sprintf("%s IN (SELECT ba.author_id FROM books_authors AS ba JOIN books AS b ON b.id=ba.book_id WHERE b.library_id=%d)", id, db.Library)
+}
+
 func (db *DB) AuthorNotSpecifiedId() int64 {
 	q := `SELECT id FROM authors WHERE sort LIKE '[author not specified]'`
 	var id int64
@@ -137,11 +146,12 @@ func (db *DB) ListAuthorWithTotals(prefix string) []*model.Author {
 		SELECT id, name, sort, 
 			(
 				SELECT COUNT(*) 
-				FROM books_authors 
-				WHERE author_id = authors.id
+				FROM books_authors AS ba
+				JOIN books AS b ON b.id = ba.book_id
+				WHERE ba.author_id = authors.id AND ` + db.visibleBooks("b") + `
 			) AS count
 		FROM authors
-		WHERE sort LIKE ?
+		WHERE sort LIKE ? AND ` + db.libraryAuthors("authors.id") + `
 		ORDER BY sort
 	`
 	rows, err := db.Query(q, prefix+"%")
@@ -168,25 +178,26 @@ func (db *DB) ListAuthorBooks(authorId, serieId int64, limit, offset int) []*mod
 	)
 	if serieId == 0 {
 		q = `
-		SELECT b.id, b.file, b.archive, b.size, b.format, b.title, b.year, b.plot, b.cover, ifnull(s.name, ''), b.serie_num, ifnull(l.code, '') 
+		SELECT b.id, b.file, b.archive, b.size, b.format, b.title, b.year, b.plot, b.cover, ifnull(s.name, ''), b.serie_num, ifnull(l.code, ''), b.library_id
 		FROM books as b 
 		JOIN books_authors as ba ON b.id=ba.book_id 
 		LEFT JOIN series as s ON b.serie_id=s.id
 		JOIN languages as l ON b.language_id=l.id
-		WHERE ba.author_id=?  
+		WHERE ba.author_id=? AND ` + db.visibleBooks("b") + `
 		ORDER BY b.sort
 		`
 		rows, err = db.pageQuery(q, limit, offset, authorId)
 	} else {
 		q = `
-		SELECT b.id, b.file, b.archive, b.size, b.format, b.title, b.year, b.plot, b.cover, s.name, b.serie_num, ifnull(l.code, '') 
+		SELECT b.id, b.file, b.archive, b.size, b.format, b.title, b.year, b.plot, b.cover, s.name, b.serie_num, ifnull(l.code, ''), b.library_id
 		FROM books as b
 		JOIN books_authors as ba ON b.id=ba.book_id
-		JOIN series as s ON b.serie_id=s.id
+		JOIN books_series as bs ON b.id=bs.book_id
+		JOIN series as s ON bs.serie_id=s.id
 		JOIN languages as l ON b.language_id=l.id
-		WHERE ba.author_id=? AND b.serie_id=?
+		WHERE ba.author_id=? AND bs.serie_id=? AND ` + db.visibleBooks("b") + `
 		GROUP BY b.title 
-		ORDER BY b.serie_num
+		ORDER BY bs.sort_num, bs.num, b.sort
 		`
 		rows, err = db.pageQuery(q, limit, offset, authorId, serieId)
 	}
@@ -201,7 +212,7 @@ func (db *DB) ListAuthorBooks(authorId, serieId int64, limit, offset int) []*mod
 			Language: &model.Language{},
 			Serie:    &model.Serie{},
 		}
-		if err = rows.Scan(&b.ID, &b.File, &b.Archive, &b.Size, &b.Format, &b.Title, &b.Year, &b.Plot, &b.Cover, &b.Serie.Name, &b.SerieNum, &b.Language.Code); err != nil {
+		if err = rows.Scan(&b.ID, &b.File, &b.Archive, &b.Size, &b.Format, &b.Title, &b.Year, &b.Plot, &b.Cover, &b.Serie.Name, &b.SerieNum, &b.Language.Code, &b.Library); err != nil {
 			log.Fatal(err)
 		}
 		books = append(books, b)
@@ -214,12 +225,13 @@ func (db *DB) ListAuthorBooks(authorId, serieId int64, limit, offset int) []*mod
 func (db *DB) AuthorBookSeries(authorId int64) []*model.Serie {
 	series := []*model.Serie{}
 	q := `
-		SELECT b.serie_id, s.name
+		SELECT bs.serie_id, s.name
 		FROM books_authors as ba 
 		JOIN books as b ON b.id=ba.book_id
-		JOIN series as s ON s.id=b.serie_id
-		WHERE ba.author_id=? AND b.serie_id!=0
-		GROUP BY b.serie_id
+		JOIN books_series as bs ON bs.book_id=b.id
+		JOIN series as s ON s.id=bs.serie_id
+		WHERE ba.author_id=? AND ` + db.inLibrary("b") + `
+		GROUP BY bs.serie_id
 	`
 	rows, err := db.Query(q, authorId)
 	if err != nil {
@@ -276,12 +288,12 @@ func (db *DB) AuthorsByBookId(bookId int64) []*model.Author {
 
 func (db *DB) PageGenreBooks(genreCode string, limit, offset int) []*model.Book {
 	q := `
-		SELECT b.id, b.file, b.archive, b.size, b.format, b.title, b.sort, b.year, b.plot, b.cover,  ifnull(s.name, ''), b.serie_num, ifnull(l.code, '') 
+		SELECT b.id, b.file, b.archive, b.size, b.format, b.title, b.sort, b.year, b.plot, b.cover,  ifnull(s.name, ''), b.serie_num, ifnull(l.code, ''), b.library_id
 		FROM books_genres AS bg
 		JOIN books AS b ON bg.book_id = b.id
 		LEFT JOIN series AS s ON b.serie_id = s.id
 		LEFT JOIN languages AS l ON b.language_id = l.id
-		WHERE bg.genre_code = ? 
+		WHERE bg.genre_code = ? AND ` + db.visibleBooks("b") + `
 		ORDER BY b.sort
 		`
 	rows, err := db.pageQuery(q, limit, offset, genreCode)
@@ -296,7 +308,7 @@ func (db *DB) PageGenreBooks(genreCode string, limit, offset int) []*model.Book
 			Language: &model.Language{},
 			Serie:    &model.Serie{},
 		}
-		if err = rows.Scan(&b.ID, &b.File, &b.Archive, &b.Size, &b.Format, &b.Title, &b.Sort, &b.Year, &b.Plot, &b.Cover, &b.Serie.Name, &b.SerieNum, &b.Language.Code); err != nil {
+		if err = rows.Scan(&b.ID, &b.File, &b.Archive, &b.Size, &b.Format, &b.Title, &b.Sort, &b.Year, &b.Plot, &b.Cover, &b.Serie.Name, &b.SerieNum, &b.Language.Code, &b.Library); err != nil {
 			log.Fatal(err)
 		}
 		books = append(books, b)
@@ -306,7 +318,7 @@ func (db *DB) PageGenreBooks(genreCode string, limit, offset int) []*model.Book
 
 func (db *DB) CountGenreBooks(genreCode string) int64 {
 	var c int64 = 0
-	q := `SELECT count(*) FROM books_genres as bg WHERE bg.genre_code=?`
+	q := `SELECT count(*) FROM books_genres as bg JOIN books as b ON b.id=bg.book_id WHERE bg.genre_code=? AND ` + db.visibleBooks("b")
 	err := db.QueryRow(q, genreCode).Scan(&c)
 	if err == sql.ErrNoRows {
 		return 0
@@ -318,12 +330,13 @@ func (db *DB) CountGenreBooks(genreCode string) int64 {
 
 func (db *DB) ListSerieBooks(id int64, limit, offset int) []*model.Book {
 	q := `
-		SELECT b.id, b.file, b.archive, b.size, b.format, b.title, b.year, b.plot, b.cover, s.name, b.serie_num, ifnull(l.code, '') 
-		FROM books as b 
-		JOIN series as s ON s.id=b.serie_id
+		SELECT b.id, b.file, b.archive, b.size, b.format, b.title, b.year, b.plot, b.cover, s.name, b.serie_num, ifnull(l.code, ''), b.library_id
+		FROM books_series as bs
+		JOIN books as b ON b.id=bs.book_id
+		JOIN series as s ON s.id=bs.serie_id
 		JOIN languages as l ON b.language_id=l.id
-		WHERE b.serie_id=?
-		ORDER BY b.serie_num
+		WHERE bs.serie_id=? AND ` + db.visibleBooks("b") + `
+		ORDER BY bs.sort_num, bs.num, b.sort
 	`
 	rows, err := db.pageQuery(q, limit, offset, id)
 	if err != nil {
@@ -337,7 +350,7 @@ func (db *DB) ListSerieBooks(id int64, limit, offset int) []*model.Book {
 			Language: &model.Language{},
 			Serie:    &model.Serie{},
 		}
-		if err = rows.Scan(&b.ID, &b.File, &b.Archive, &b.Size, &b.Format, &b.Title, &b.Year, &b.Plot, &b.Cover, &b.Serie.Name, &b.SerieNum, &b.Language.Code); err != nil {
+		if err = rows.Scan(&b.ID, &b.File, &b.Archive, &b.Size, &b.Format, &b.Title, &b.Year, &b.Plot, &b.Cover, &b.Serie.Name, &b.SerieNum, &b.Language.Code, &b.Library); err != nil {
 			log.Fatal(err)
 		}
 		books = append(books, b)
@@ -357,9 +370,10 @@ func (db *DB) ListSeries(prefix, lang, abc string) []*model.Serie {
 		FROM series
 		WHERE SUBSTR(name, 1, 1) IN(` + abc + `)
 		  AND EXISTS (
-			  SELECT 1 FROM books AS b
+			  SELECT 1 FROM books_series AS bs
+			  JOIN books AS b ON b.id = bs.book_id
 			  JOIN languages AS l ON l.id = b.language_id 
-			  WHERE b.serie_id = series.id AND l.code LIKE ?
+			  WHERE bs.serie_id = series.id AND l.code LIKE ? AND ` + db.inLibrary("b") + `
 		  )
 		GROUP BY p
 		`)
@@ -370,9 +384,10 @@ func (db *DB) ListSeries(prefix, lang, abc string) []*model.Serie {
 		FROM series
 		WHERE name LIKE ?
 		  AND EXISTS (
-			  SELECT 1 FROM books AS b
+			  SELECT 1 FROM books_series AS bs
+			  JOIN books AS b ON b.id = bs.book_id
 			  JOIN languages AS l ON l.id = b.language_id 
-			  WHERE b.serie_id = series.id AND l.code LIKE ?
+			  WHERE bs.serie_id = series.id AND l.code LIKE ? AND ` + db.inLibrary("b") + `
 		  )
 		GROUP BY p
 		`
@@ -405,9 +420,10 @@ func (db *DB) ListSeriesWithTotals(prefix, lang string) []*model.Serie {
 	SELECT s.id, s.name, 
 		(
 			SELECT COUNT(b.id) 
-			FROM books AS b 
+			FROM books_series AS bs
+			JOIN books AS b ON b.id = bs.book_id
 			JOIN languages AS l ON l.id = b.language_id 
-			WHERE b.serie_id = s.id AND l.code LIKE ?
+			WHERE bs.serie_id = s.id AND l.code LIKE ? AND ` + db.visibleBooks("b") + `
 		) AS count
 	FROM series AS s
 	WHERE s.name LIKE ?
@@ -441,20 +457,62 @@ func (db *DB) SerieByID(serieId int64) *model.Serie {
 	return serie
 }
 
-func (db *DB) SerieByBookID(bookId int64) *model.Serie {
-	serie := &model.Serie{}
-	q := `SELECT s.id, s.name FROM books as b JOIN series as s ON s.id=b.serie_id WHERE b.id=?`
-	err := db.QueryRow(q, bookId).Scan(&serie.ID, &serie.Name)
-	if err == sql.ErrNoRows {
-		return nil
+// LoadBookPublication fills in the book ISBN, publisher and the original of translated book
+func (db *DB) LoadBookPublication(b *model.Book) {
+	q := `SELECT ifnull(isbn, ''), ifnull(publisher, ''), ifnull(city, ''), ifnull(src_lang, ''), ifnull(src_title, '') FROM books WHERE id=?`
+	db.QueryRow(q, b.ID).Scan(&b.ISBN, &b.Publisher, &b.City, &b.SrcLang, &b.SrcTitle)
+}
+
+// BookPages returns the number of page images of comics, 0 if it is not known
+func (db *DB) BookPages(bookId int64) int {
+	pages := 0
+	db.QueryRow(`SELECT ifnull(pages, 0) FROM books WHERE id=?`, bookId).Scan(&pages)
+	return pages
+}
+
+// SetBookPages stores the number of page images of comics indexed before pages were counted
+func (db *DB) SetBookPages(bookId int64, pages int) error {
+	_, err := db.Exec(`UPDATE books SET pages=? WHERE id=?`, pages, bookId)
+	return err
+}
+
+// BookSeries returns all the series the book is part of with its numbers in them
+func (db *DB) BookSeries(bookId int64) []*model.BookSerie {
+	series := []*model.BookSerie{}
+	q := `
+		SELECT s.id, s.name, bs.role, bs.num
+		FROM books_series as bs
+		JOIN series as s ON s.id=bs.serie_id
+		WHERE bs.book_id=?
+		ORDER BY bs.id
+	`
+	rows, err := db.Query(q, bookId)
+	if err != nil {
+		return series
 	}
-	return serie
+	defer rows.Close()
+
+	for rows.Next() {
+		s := &model.BookSerie{}
+		if err := rows.Scan(&s.ID, &s.Name, &s.Role, &s.Number); err != nil {
+			return series
+		}
+		series = append(series, s)
+	}
+	return series
+}
+
+// CountBooks returns the number of the handle library books shown in feeds
+func (db *DB) CountBooks() int64 {
+	var c int64 = 0
+	db.QueryRow(`SELECT count(*) FROM books as b WHERE ` + db.visibleBooks("b")).Scan(&c)
+	return c
 }
 
 // Latest
 func (db *DB) LatestBooksCount(days int) int64 {
 	var c int64 = 0
-	q := `SELECT count(*) as c FROM books WHERE updated > ?`
+	q := `SELECT count(*) as c FROM books as b WHERE b.updated > ? AND ` + db.visibleBooks("b")
 	err := db.QueryRow(q, time.Now().Unix()-int64(days*24*60*60)).Scan(&c)
 	if err == sql.ErrNoRows {
 		return 0
@@ -464,11 +522,11 @@ func (db *DB) LatestBooksCount(days int) int64 {
 
 func (db *DB) PageLatestBooks(days, limit, offset int) []*model.Book {
 	q := `
-	SELECT b.id, b.file, b.archive, b.size, b.format, b.title, b.year, b.plot, b.cover, ifnull(s.name, ''), b.serie_num, ifnull(l.code, '') 
+	SELECT b.id, b.file, b.archive, b.size, b.format, b.title, b.year, b.plot, b.cover, ifnull(s.name, ''), b.serie_num, ifnull(l.code, ''), b.library_id
 	FROM books as b
 	LEFT JOIN series as s ON b.serie_id=s.id
 	JOIN languages as l ON b.language_id=l.id
-	WHERE b.updated > ? 
+	WHERE b.updated > ? AND ` + db.visibleBooks("b") + `
 	ORDER BY b.id DESC
 	`
 	rows, err := db.pageQuery(q, limit, offset, time.Now().Unix()-int64(days*24*60*60))
@@ -483,7 +541,7 @@ func (db *DB) PageLatestBooks(days, limit, offset int) []*model.Book {
 			Language: &model.Language{},
 			Serie:    &model.Serie{},
 		}
-		if err := rows.Scan(&b.ID, &b.File, &b.Archive, &b.Size, &b.Format, &b.Title, &b.Year, &b.Plot, &b.Cover, &b.Serie.Name, &b.SerieNum, &b.Language.Code); err != nil {
+		if err := rows.Scan(&b.ID, &b.File, &b.Archive, &b.Size, &b.Format, &b.Title, &b.Year, &b.Plot, &b.Cover, &b.Serie.Name, &b.SerieNum, &b.Language.Code, &b.Library); err != nil {
 			log.Fatal(err)
 		}
 		books = append(books, b)
@@ -508,7 +566,7 @@ func (db *DB) SearchBooksCountByKeyword(pattern string) int64 {
 
 func (db *DB) searchBooksCount(mode, pattern string) int64 {
 	var c int64 = 0
-	q := `SELECT count(*) as c FROM books_fts WHERE ` + mode + ` MATCH ?`
+	q := `SELECT count(*) as c FROM books_fts WHERE ` + mode + ` MATCH ? AND rowid IN (SELECT b.id FROM books AS b WHERE ` + db.visibleBooks("b") + `)`
 	err := db.QueryRow(q, pattern).Scan(&c)
 	if err == sql.ErrNoRows {
 		return 0
@@ -528,7 +586,7 @@ func (db *DB) pageFoundBooks(mode, pattern string, limit, offset int) []*model.B
 	foundIDs := func(mode, pattern string, limit, offset int) []string {
 		q := `SELECT rowid 
 			FROM books_fts 
-			WHERE ` + mode + ` MATCH ? 
+			WHERE ` + mode + ` MATCH ? AND rowid IN (SELECT b.id FROM books AS b WHERE ` + db.visibleBooks("b") + `)
 			ORDER BY rank 
 			`
 		rows, err := db.pageQuery(q, limit, offset, pattern)
@@ -547,7 +605,7 @@ func (db *DB) pageFoundBooks(mode, pattern string, limit, offset int) []*model.B
 		return foundIDs
 	}(mode, pattern, limit, offset)
 	q := `
-	SELECT b.id, b.file, b.archive, b.size, b.format, b.title, b.year, b.plot, b.cover, ifnull(s.name, ''), b.serie_num, ifnull(l.code, '') 
+	SELECT b.id, b.file, b.archive, b.size, b.format, b.title, b.year, b.plot, b.cover, ifnull(s.name, ''), b.serie_num, ifnull(l.code, ''), b.library_id
 	FROM books as b
 	LEFT JOIN series as s ON b.serie_id=s.id
 	LEFT JOIN languages as l ON b.language_id=l.id
@@ -565,7 +623,7 @@ func (db *DB) pageFoundBooks(mode, pattern string, limit, offset int) []*model.B
 			Language: &model.Language{},
 			Serie:    &model.Serie{},
 		}
-		if err := rows.Scan(&b.ID, &b.File, &b.Archive, &b.Size, &b.Format, &b.Title, &b.Year, &b.Plot, &b.Cover, &b.Serie.Name, &b.SerieNum, &b.Language.Code); err != nil {
+		if err := rows.Scan(&b.ID, &b.File, &b.Archive, &b.Size, &b.Format, &b.Title, &b.Year, &b.Plot, &b.Cover, &b.Serie.Name, &b.SerieNum, &b.Language.Code, &b.Library); err != nil {
 			log.Fatal(err)
 		}
 		booksIdx[b.ID] = b
@@ -581,7 +639,7 @@ func (db *DB) pageFoundBooks(mode, pattern string, limit, offset int) []*model.B
 
 func (db *DB) SearchAuthorsCount(pattern string) int64 {
 	var c int64 = 0
-	q := `SELECT count(*) as c FROM authors_fts WHERE sort MATCH ?`
+	q := `SELECT count(*) as c FROM authors_fts WHERE sort MATCH ? AND ` + db.libraryAuthors("rowid")
 	// err := db.QueryRow(q, pattern).Scan(&c)
 	err := db.QueryRow(q, "^"+pattern).Scan(&c)
 	if err == sql.ErrNoRows {
@@ -595,7 +653,8 @@ func (db *DB) PageFoundAuthors(pattern string, limit, offset int) []*model.Autho
 	SELECT a.id, a.name, a.sort, count(*) as c 
 	FROM authors AS a
 	JOIN books_authors AS ba ON a.id=ba.author_id 
-	WHERE a.id in (SELECT rowid FROM authors_fts WHERE sort MATCH ?)
+	JOIN books AS b ON b.id=ba.book_id
+	WHERE a.id in (SELECT rowid FROM authors_fts WHERE sort MATCH ?) AND ` + db.inLibrary("b") + `
 	GROUP BY a.sort 
 	ORDER BY a.sort 
 	`
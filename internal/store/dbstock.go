@@ -0,0 +1,209 @@
+package store
+
+import (
+	"github.com/vinser/flibgolite/internal/core/model"
+)
+
+// StockBooks returns index records of all stock files and archive entries
+func (db *DB) StockBooks() ([]*model.Book, error) {
+	return db.stockBooks(`1`)
+}
+
+// StockFileBooks returns index records of the single stock file
+func (db *DB) StockFileBooks(file string) ([]*model.Book, error) {
+	return db.stockBooks(`file=? AND archive=''`, file)
+}
+
+func (db *DB) stockBooks(cond string, args ...any) ([]*model.Book, error) {
+	books := []*model.Book{}
+	q := `SELECT id, file, archive, size, crc32, ifnull(sha256, ''), title, plot, keywords, updated FROM books AS b WHERE ` + cond + ` AND ` + db.inLibrary("b")
+	rows, err := db.Query(q, args...)
+	if err != nil {
+		return books, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		b := &model.Book{}
+		if err := rows.Scan(&b.ID, &b.File, &b.Archive, &b.Size, &b.CRC32, &b.SHA256, &b.Title, &b.Plot, &b.Keywords, &b.Updated); err != nil {
+			return books, err
+		}
+		books = append(books, b)
+	}
+	return books, rows.Err()
+}
+
+// DeleteBooks removes books with their authors, contributors, genres and series links and full text search rows
+// Authors, contributors and series left without books are removed too
+func (db *DB) DeleteBooks(books []*model.Book) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, b := range books {
+		q := `INSERT INTO books_fts (books_fts, rowid, title, keywords) VALUES ('delete', ?, ?, ?)`
+		if _, err := tx.Exec(q, b.ID, b.Title, b.Keywords); err != nil {
+			return err
+		}
+		for _, q := range []string{
+			`DELETE FROM books_authors WHERE book_id=?`,
+			`DELETE FROM books_genres WHERE book_id=?`,
+			`DELETE FROM books_series WHERE book_id=?`,
+			`DELETE FROM books_contributors WHERE book_id=?`,
+			`DELETE FROM books_lazy WHERE book_id=?`,
+			`DELETE FROM versions WHERE book_id=?`,
+			`DELETE FROM books WHERE id=?`,
+		} {
+			if _, err := tx.Exec(q, b.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	orphans := []*model.Author{}
+	q := `SELECT id, sort FROM authors WHERE id NOT IN (SELECT author_id FROM books_authors)`
+	if err := tx.Select(&orphans, q); err != nil {
+		return err
+	}
+	for _, a := range orphans {
+		if _, err := tx.Exec(`INSERT INTO authors_fts (authors_fts, rowid, sort) VALUES ('delete', ?, ?)`, a.ID, a.Sort); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM authors WHERE id=?`, a.ID); err != nil {
+			return err
+		}
+	}
+	for _, q := range []string{
+		`DELETE FROM series WHERE id NOT IN (SELECT serie_id FROM books_series)`,
+		`DELETE FROM contributors WHERE id NOT IN (SELECT contributor_id FROM books_contributors)`,
+	} {
+		if _, err := tx.Exec(q); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// LazyBooks returns the books which cover and annotation are not loaded yet
+func (db *DB) LazyBooks() ([]*model.Book, error) {
+	books := []*model.Book{}
+	q := `
+		SELECT b.id, b.file, b.archive, b.format
+		FROM books AS b
+		JOIN books_lazy AS l ON l.book_id=b.id
+		WHERE ` + db.inLibrary("b") + `
+		ORDER BY b.archive, b.file
+	`
+	rows, err := db.Query(q)
+	if err != nil {
+		return books, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		b := &model.Book{}
+		if err := rows.Scan(&b.ID, &b.File, &b.Archive, &b.Format); err != nil {
+			return books, err
+		}
+		books = append(books, b)
+	}
+	return books, rows.Err()
+}
+
+// UpdateLazyBooks stores the book covers, annotations and publication details loaded from the book files
+func (db *DB) UpdateLazyBooks(books []*model.Book) error {
+	db.writer.Lock()
+	defer db.writer.Unlock()
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	q := `UPDATE books SET cover=?, plot=?, isbn=?, publisher=?, city=?, src_lang=?, src_title=?, pages=? WHERE id=?`
+	for _, b := range books {
+		if _, err := tx.Exec(q, b.Cover, b.Plot, b.ISBN, b.Publisher, b.City, b.SrcLang, b.SrcTitle, b.Pages, b.ID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM books_lazy WHERE book_id=?`, b.ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ArchiveBooks calls fn for each indexed book from stock archives, books are ordered by archive
+func (db *DB) ArchiveBooks(fn func(b *model.Book) error) error {
+	return db.eachBook(`b.archive<>'' AND b.updated>0`, fn)
+}
+
+// IndexedBooks calls fn for each indexed book with its authors and genres, books are ordered by archive
+func (db *DB) IndexedBooks(fn func(b *model.Book) error) error {
+	return db.eachBook(`b.updated>0`, fn)
+}
+
+func (db *DB) eachBook(cond string, fn func(b *model.Book) error) error {
+	q := `
+		SELECT b.id, b.file, b.archive, b.size, b.format, b.title, b.keywords, b.serie_num, b.updated, ifnull(l.code, ''), ifnull(s.name, '')
+		FROM books as b
+		LEFT JOIN languages as l ON l.id=b.language_id
+		LEFT JOIN series as s ON s.id=b.serie_id
+		WHERE ` + cond + ` AND ` + db.inLibrary("b") + `
+		ORDER BY b.archive, b.id`
+	rows, err := db.Query(q)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		b := &model.Book{
+			Language: &model.Language{},
+			Serie:    &model.Serie{},
+		}
+		if err := rows.Scan(&b.ID, &b.File, &b.Archive, &b.Size, &b.Format, &b.Title, &b.Keywords, &b.SerieNum, &b.Updated, &b.Language.Code, &b.Serie.Name); err != nil {
+			return err
+		}
+		if b.Authors, err = db.BookAuthors(b.ID); err != nil {
+			return err
+		}
+		if b.Genres, err = db.BookGenres(b.ID); err != nil {
+			return err
+		}
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// BooksWithoutSHA256 returns books indexed before SHA-256 was stored ordered by archive
+func (db *DB) BooksWithoutSHA256() ([]*model.Book, error) {
+	books := []*model.Book{}
+	q := `SELECT id, file, archive FROM books AS b WHERE (sha256 IS NULL OR sha256='') AND ` + db.inLibrary("b") + ` ORDER BY archive, file`
+	rows, err := db.Query(q)
+	if err != nil {
+		return books, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		b := &model.Book{}
+		if err := rows.Scan(&b.ID, &b.File, &b.Archive); err != nil {
+			return books, err
+		}
+		books = append(books, b)
+	}
+	return books, rows.Err()
+}
+
+// UpdateBooksSHA256 stores SHA-256 of the books
+func (db *DB) UpdateBooksSHA256(books []*model.Book) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, b := range books {
+		if _, err := tx.Exec(`UPDATE books SET sha256=? WHERE id=?`, b.SHA256, b.ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
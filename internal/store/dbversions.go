@@ -0,0 +1,134 @@
+package store
+
+import (
+	"log"
+
+	"github.com/vinser/flibgolite/internal/core/model"
+)
+
+// Version is a book record of versions group
+type Version struct {
+	BookID   int64
+	GroupID  int64
+	TitleKey string
+	Plot     string
+}
+
+// VersionCandidates returns books of the transaction library with the author key and title key length in range
+// that can be versions of a new book
+func (tx *TX) VersionCandidates(authorKey string, minTitleLen, maxTitleLen int) ([]*Version, error) {
+	versions := []*Version{}
+	q := `
+		SELECT v.book_id, v.group_id, v.title_key, b.plot
+		FROM versions AS v
+		JOIN books AS b ON b.id=v.book_id
+		WHERE v.author_key=? AND length(v.title_key) BETWEEN ? AND ? AND b.library_id=?
+	`
+	rows, err := tx.Query(q, authorKey, minTitleLen, maxTitleLen, tx.Library)
+	if err != nil {
+		return versions, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		v := &Version{}
+		if err := rows.Scan(&v.BookID, &v.GroupID, &v.TitleKey, &v.Plot); err != nil {
+			return versions, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// NewVersion adds the book to versions group, the book starting a new group is its canonical version
+func (tx *TX) NewVersion(bookID, groupID int64, authorKey, titleKey string) error {
+	q := `INSERT OR REPLACE INTO versions (book_id, group_id, author_key, title_key, canonical) VALUES (?, ?, ?, ?, ?)`
+	_, err := tx.Exec(q, bookID, groupID, authorKey, titleKey, bookID == groupID)
+	return err
+}
+
+// VersionGroupBooks returns the books of versions group with the fields used to pick the canonical one
+func (tx *TX) VersionGroupBooks(groupID int64) ([]*model.Book, error) {
+	books := []*model.Book{}
+	q := `
+		SELECT b.id, b.format, b.size, b.cover, b.updated
+		FROM versions AS v
+		JOIN books AS b ON b.id=v.book_id
+		WHERE v.group_id=?
+	`
+	rows, err := tx.Query(q, groupID)
+	if err != nil {
+		return books, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		b := &model.Book{}
+		if err := rows.Scan(&b.ID, &b.Format, &b.Size, &b.Cover, &b.Updated); err != nil {
+			return books, err
+		}
+		books = append(books, b)
+	}
+	return books, rows.Err()
+}
+
+// SetCanonicalVersion makes the book the only version of the group shown in feeds
+func (tx *TX) SetCanonicalVersion(groupID, bookID int64) error {
+	_, err := tx.Exec(`UPDATE versions SET canonical=(book_id=?) WHERE group_id=?`, bookID, groupID)
+	return err
+}
+
+// OrphanVersionGroups returns versions groups left without canonical version, e.g. after its file was deleted
+func (db *DB) OrphanVersionGroups() []int64 {
+	groups := []int64{}
+	q := `
+		SELECT v.group_id
+		FROM versions AS v
+		JOIN books AS b ON b.id=v.book_id
+		WHERE ` + db.inLibrary("b") + `
+		GROUP BY v.group_id
+		HAVING max(v.canonical)=0
+	`
+	if err := db.Select(&groups, q); err != nil {
+		log.Println(err)
+	}
+	return groups
+}
+
+// CountBookVersions returns the number of versions of the book including itself
+func (db *DB) CountBookVersions(bookID int64) int64 {
+	var c int64 = 0
+	q := `SELECT count(*) FROM versions WHERE group_id=(SELECT group_id FROM versions WHERE book_id=?)`
+	db.QueryRow(q, bookID).Scan(&c)
+	return c
+}
+
+// ListBookVersions returns all versions of the book, the canonical one goes first
+func (db *DB) ListBookVersions(bookID int64) []*model.Book {
+	q := `
+		SELECT b.id, b.file, b.archive, b.size, b.format, b.title, b.year, b.plot, b.cover, ifnull(s.name, ''), b.serie_num, ifnull(l.code, ''), b.library_id
+		FROM versions AS v
+		JOIN books AS b ON b.id=v.book_id
+		LEFT JOIN series AS s ON b.serie_id=s.id
+		LEFT JOIN languages AS l ON b.language_id=l.id
+		WHERE v.group_id=(SELECT group_id FROM versions WHERE book_id=?) AND ` + db.inLibrary("b") + `
+		ORDER BY v.canonical DESC, b.id
+	`
+	rows, err := db.Query(q, bookID)
+	if err != nil {
+		log.Println("DB query error: ", err.Error())
+		return []*model.Book{}
+	}
+	defer rows.Close()
+	books := []*model.Book{}
+	for rows.Next() {
+		b := &model.Book{
+			Language: &model.Language{},
+			Serie:    &model.Serie{},
+		}
+		if err = rows.Scan(&b.ID, &b.File, &b.Archive, &b.Size, &b.Format, &b.Title, &b.Year, &b.Plot, &b.Cover, &b.Serie.Name, &b.SerieNum, &b.Language.Code, &b.Library); err != nil {
+			log.Println(err)
+			return books
+		}
+		books = append(books, b)
+	}
+	return books
+}
@@ -1,8 +1,17 @@
+DROP TABLE IF EXISTS libraries;
+DROP TABLE IF EXISTS versions;
+DROP TABLE IF EXISTS ingest_status;
+DROP TABLE IF EXISTS meta;
+DROP TABLE IF EXISTS books_lazy;
 DROP TABLE IF EXISTS books_fts;
 DROP TABLE IF EXISTS authors_fts;
+DROP TABLE IF EXISTS author_aliases;
 DROP TABLE IF EXISTS books_genres;
+DROP TABLE IF EXISTS books_contributors;
+DROP TABLE IF EXISTS books_series;
 DROP TABLE IF EXISTS books_authors;
 DROP TABLE IF EXISTS books;
 DROP TABLE IF EXISTS series;
+DROP TABLE IF EXISTS contributors;
 DROP TABLE IF EXISTS authors;
 DROP TABLE IF EXISTS languages;
\ No newline at end of file
@@ -19,6 +19,23 @@ CREATE INDEX authots_sort_idx ON authors (sort COLLATE NOCASE);
 DROP TABLE IF EXISTS authors_fts;
 CREATE VIRTUAL TABLE authors_fts USING fts5(sort, content='', tokenize='unicode61 remove_diacritics 2');
 
+DROP TABLE IF EXISTS author_aliases;
+CREATE TABLE author_aliases (
+    alias TEXT PRIMARY KEY,
+    name TEXT,
+    sort TEXT
+);
+CREATE INDEX author_aliases_name_idx ON author_aliases (name);
+
+DROP TABLE IF EXISTS contributors;
+CREATE TABLE contributors (
+    id INTEGER PRIMARY KEY,
+    name TEXT,
+    sort TEXT
+);
+CREATE UNIQUE INDEX contributors_name_idx ON contributors (name);
+CREATE INDEX contributors_sort_idx ON contributors (sort COLLATE NOCASE);
+
 DROP TABLE IF EXISTS books;
 CREATE TABLE books (
     id INTEGER PRIMARY KEY,
@@ -36,10 +53,20 @@ CREATE TABLE books (
     keywords TEXT,
     serie_id INTEGER,
     serie_num INTEGER,
-    updated INTEGER
+    updated INTEGER,
+    sha256 TEXT,
+    lang_confidence REAL DEFAULT 0,
+    library_id INTEGER DEFAULT 0,
+    isbn TEXT DEFAULT '',
+    publisher TEXT DEFAULT '',
+    city TEXT DEFAULT '',
+    src_lang TEXT DEFAULT '',
+    src_title TEXT DEFAULT '',
+    pages INTEGER DEFAULT 0
 );
 -- CREATE UNIQUE INDEX book_crc32_idx ON books (crc32);  -- crc32 is unique?
 CREATE INDEX book_crc32_idx ON books (crc32);
+CREATE INDEX book_sha256_idx ON books (sha256);
 CREATE INDEX book_file_idx ON books (file);
 CREATE INDEX book_archive_idx ON books (archive);
 CREATE INDEX book_title_idx ON books (title);
@@ -47,6 +74,8 @@ CREATE INDEX book_sort_idx ON books (sort COLLATE NOCASE);
 CREATE INDEX book_language_idx ON books (language_id);
 CREATE INDEX book_serie_idx ON books (serie_id);
 CREATE INDEX book_updated_idx ON books (updated);
+CREATE INDEX book_library_idx ON books (library_id);
+CREATE INDEX book_isbn_idx ON books (isbn);
 
 DROP TABLE IF EXISTS books_fts;
 CREATE VIRTUAL TABLE books_fts USING fts5(title, keywords, content='', tokenize='unicode61 remove_diacritics 2');
@@ -58,6 +87,18 @@ CREATE TABLE series (
 );
 CREATE UNIQUE INDEX series_name_idx ON series (name);
 
+DROP TABLE IF EXISTS books_series;
+CREATE TABLE books_series (
+    id INTEGER PRIMARY KEY,
+    book_id INTEGER,
+    serie_id INTEGER,
+    role TEXT,
+    num TEXT,
+    sort_num REAL
+);
+CREATE UNIQUE INDEX books_series_book_serie_idx ON books_series (book_id, serie_id);
+CREATE INDEX books_series_serie_idx ON books_series (serie_id, sort_num);
+
 DROP TABLE IF EXISTS books_authors;
 CREATE TABLE books_authors (
     id INTEGER PRIMARY KEY,
@@ -67,6 +108,16 @@ CREATE TABLE books_authors (
 CREATE INDEX books_authors_book_idx ON books_authors (book_id);
 CREATE INDEX books_authors_author_idx ON books_authors (author_id);
 
+DROP TABLE IF EXISTS books_contributors;
+CREATE TABLE books_contributors (
+    id INTEGER PRIMARY KEY,
+    book_id INTEGER,
+    contributor_id INTEGER,
+    role TEXT
+);
+CREATE UNIQUE INDEX books_contributors_book_idx ON books_contributors (book_id, contributor_id, role);
+CREATE INDEX books_contributors_contributor_idx ON books_contributors (contributor_id, role);
+
 DROP TABLE IF EXISTS books_genres;
 CREATE TABLE books_genres (
     id INTEGER PRIMARY KEY,
@@ -74,4 +125,48 @@ CREATE TABLE books_genres (
     genre_code TEXT
 );
 CREATE INDEX books_genres_genre_code_idx ON books_genres (genre_code);
-CREATE INDEX books_genres_book_idx ON books_genres (book_id);
\ No newline at end of file
+CREATE INDEX books_genres_book_idx ON books_genres (book_id);
+
+DROP TABLE IF EXISTS books_lazy;
+CREATE TABLE books_lazy (
+    book_id INTEGER PRIMARY KEY
+);
+
+DROP TABLE IF EXISTS meta;
+CREATE TABLE meta (
+    key TEXT PRIMARY KEY,
+    value TEXT
+);
+
+DROP TABLE IF EXISTS ingest_status;
+CREATE TABLE ingest_status (
+    id INTEGER PRIMARY KEY,
+    file TEXT,
+    archive TEXT,
+    state INTEGER,
+    error TEXT,
+    updated INTEGER,
+    library_id INTEGER DEFAULT 0
+);
+CREATE UNIQUE INDEX ingest_status_library_file_idx ON ingest_status (library_id, archive, file);
+CREATE INDEX ingest_status_state_idx ON ingest_status (state);
+
+DROP TABLE IF EXISTS versions;
+CREATE TABLE versions (
+    book_id INTEGER PRIMARY KEY,
+    group_id INTEGER,
+    author_key TEXT,
+    title_key TEXT,
+    canonical INTEGER
+);
+CREATE INDEX versions_group_idx ON versions (group_id);
+CREATE INDEX versions_author_key_idx ON versions (author_key);
+CREATE INDEX versions_canonical_idx ON versions (canonical);
+
+DROP TABLE IF EXISTS libraries;
+CREATE TABLE libraries (
+    id INTEGER PRIMARY KEY,
+    name TEXT
+);
+CREATE UNIQUE INDEX libraries_name_idx ON libraries (name);
+INSERT INTO libraries (id, name) VALUES (0, '');
\ No newline at end of file
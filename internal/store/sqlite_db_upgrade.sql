@@ -0,0 +1,66 @@
+CREATE TABLE IF NOT EXISTS books_lazy (
+    book_id INTEGER PRIMARY KEY
+);
+CREATE TABLE IF NOT EXISTS meta (
+    key TEXT PRIMARY KEY,
+    value TEXT
+);
+CREATE TABLE IF NOT EXISTS ingest_status (
+    id INTEGER PRIMARY KEY,
+    file TEXT,
+    archive TEXT,
+    state INTEGER,
+    error TEXT,
+    updated INTEGER
+);
+CREATE INDEX IF NOT EXISTS ingest_status_state_idx ON ingest_status (state);
+INSERT INTO ingest_status (file, archive, state, error, updated) SELECT file, archive, updated, '', 0 FROM books WHERE id IN (SELECT max(id) FROM books WHERE updated < 0 GROUP BY archive, file) AND NOT EXISTS (SELECT 1 FROM ingest_status s WHERE s.archive IS books.archive AND s.file IS books.file);
+DELETE FROM books WHERE updated < 0;
+CREATE TABLE IF NOT EXISTS versions (
+    book_id INTEGER PRIMARY KEY,
+    group_id INTEGER,
+    author_key TEXT,
+    title_key TEXT,
+    canonical INTEGER
+);
+CREATE INDEX IF NOT EXISTS versions_group_idx ON versions (group_id);
+CREATE INDEX IF NOT EXISTS versions_author_key_idx ON versions (author_key);
+CREATE INDEX IF NOT EXISTS versions_canonical_idx ON versions (canonical);
+CREATE TABLE IF NOT EXISTS libraries (
+    id INTEGER PRIMARY KEY,
+    name TEXT
+);
+CREATE UNIQUE INDEX IF NOT EXISTS libraries_name_idx ON libraries (name);
+INSERT OR IGNORE INTO libraries (id, name) VALUES (0, '');
+CREATE TABLE IF NOT EXISTS author_aliases (
+    alias TEXT PRIMARY KEY,
+    name TEXT,
+    sort TEXT
+);
+CREATE INDEX IF NOT EXISTS author_aliases_name_idx ON author_aliases (name);
+CREATE TABLE IF NOT EXISTS books_series (
+    id INTEGER PRIMARY KEY,
+    book_id INTEGER,
+    serie_id INTEGER,
+    role TEXT,
+    num TEXT,
+    sort_num REAL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS books_series_book_serie_idx ON books_series (book_id, serie_id);
+CREATE INDEX IF NOT EXISTS books_series_serie_idx ON books_series (serie_id, sort_num);
+INSERT OR IGNORE INTO books_series (book_id, serie_id, role, num, sort_num) SELECT id, serie_id, '', CASE WHEN serie_num > 0 THEN CAST(serie_num AS TEXT) ELSE '' END, serie_num FROM books WHERE serie_id > 0 AND NOT EXISTS (SELECT 1 FROM books_series WHERE book_id=books.id);
+CREATE TABLE IF NOT EXISTS contributors (
+    id INTEGER PRIMARY KEY,
+    name TEXT,
+    sort TEXT
+);
+CREATE UNIQUE INDEX IF NOT EXISTS contributors_name_idx ON contributors (name);
+CREATE INDEX IF NOT EXISTS contributors_sort_idx ON contributors (sort COLLATE NOCASE);
+CREATE TABLE IF NOT EXISTS books_contributors (
+    id INTEGER PRIMARY KEY,
+    book_id INTEGER,
+    contributor_id INTEGER,
+    role TEXT
+);
+CREATE UNIQUE INDEX IF NOT EXISTS books_contributors_book_idx ON books_contributors (book_id, contributor_id, role);
+CREATE INDEX IF NOT EXISTS books_contributors_contributor_idx ON books_contributors (contributor_id, role);
\ No newline at end of file
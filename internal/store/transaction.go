@@ -2,6 +2,11 @@ package store
 
 import (
 	"database/sql"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/vinser/flibgolite/internal/core/model"
 	"github.com/vinser/flibgolite/internal/hash"
@@ -11,13 +16,18 @@ import (
 func (tx *TX) PrepareStatements() {
 	tx.Stmt["selectIdFromLanguages"] = tx.mustPrepare(`SELECT id FROM languages WHERE code=?`)
 	tx.Stmt["insertIntoLanguages"] = tx.mustPrepare(`INSERT INTO languages (code, name) VALUES (?, ?)`)
-	tx.Stmt["insertIntoBooks"] = tx.mustPrepare(`INSERT INTO books (file, crc32, archive, size, format, title, sort, year, language_id, plot, cover, keywords, serie_id, serie_num, updated) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
-	tx.Stmt["selectIdFromAuthors"] = tx.mustPrepare(`SELECT id FROM authors WHERE name=?`)
+	tx.Stmt["insertIntoBooks"] = tx.mustPrepare(`INSERT INTO books (file, crc32, archive, size, format, title, sort, year, language_id, plot, cover, keywords, serie_id, serie_num, updated, sha256, lang_confidence, library_id, isbn, publisher, city, src_lang, src_title, pages) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	tx.Stmt["selectIdFromAuthors"] = tx.mustPrepare(`SELECT id FROM authors WHERE name=ifnull((SELECT name FROM author_aliases WHERE alias=?1), ?1)`)
+	tx.Stmt["selectFromAuthorAliases"] = tx.mustPrepare(`SELECT name, sort FROM author_aliases WHERE alias=?`)
 	tx.Stmt["insertIntoAuthors"] = tx.mustPrepare(`INSERT INTO authors (name, sort) VALUES (?, ?)`)
 	tx.Stmt["insertIntoBooksAuthors"] = tx.mustPrepare(`INSERT INTO books_authors (book_id, author_id) VALUES (?, ?)`)
+	tx.Stmt["selectIdFromContributors"] = tx.mustPrepare(`SELECT id FROM contributors WHERE name=?`)
+	tx.Stmt["insertIntoContributors"] = tx.mustPrepare(`INSERT INTO contributors (name, sort) VALUES (?, ?)`)
+	tx.Stmt["insertIntoBooksContributors"] = tx.mustPrepare(`INSERT OR IGNORE INTO books_contributors (book_id, contributor_id, role) VALUES (?, ?, ?)`)
 	tx.Stmt["insertIntoBooksGenres"] = tx.mustPrepare(`INSERT INTO books_genres (book_id, genre_code) VALUES (?, ?)`)
 	tx.Stmt["selectIdFromSeries"] = tx.mustPrepare(`SELECT id FROM series WHERE name=?`)
 	tx.Stmt["insertIntoSeries"] = tx.mustPrepare(`INSERT INTO series (name) VALUES (?)`)
+	tx.Stmt["insertIntoBooksSeries"] = tx.mustPrepare(`INSERT OR IGNORE INTO books_series (book_id, serie_id, role, num, sort_num) VALUES (?, ?, ?, ?, ?)`)
 }
 
 // Books
@@ -26,7 +36,7 @@ func (tx *TX) NewBook(b *model.Book) error {
 
 	languageId := tx.NewLanguage(b.Language)
 	serieId := tx.NewSerie(b.Serie)
-	res, err := tx.Stmt["insertIntoBooks"].Exec(b.File, b.CRC32, b.Archive, b.Size, b.Format, b.Title, b.Sort, b.Year, languageId, b.Plot, b.Cover, b.Keywords, serieId, b.SerieNum, b.Updated)
+	res, err := tx.Stmt["insertIntoBooks"].Exec(b.File, b.CRC32, b.Archive, b.Size, b.Format, b.Title, b.Sort, b.Year, languageId, b.Plot, b.Cover, b.Keywords, serieId, b.SerieNum, b.Updated, b.SHA256, b.Language.Confidence, tx.Library, b.ISBN, b.Publisher, b.City, b.SrcLang, b.SrcTitle, b.Pages)
 	if err != nil {
 		return err
 	}
@@ -35,23 +45,40 @@ func (tx *TX) NewBook(b *model.Book) error {
 	if err != nil {
 		return err
 	}
+	b.ID = bookId
 	q := `INSERT INTO books_fts (rowid, title, keywords) VALUES (?, ?, ?)`
 	_, err = tx.Exec(q, bookId, b.Title, b.Keywords)
 	if err != nil {
 		return err
 	}
 
+	authorIds := []int64{} // aliases of one canonical author are linked once
 	for _, author := range b.Authors {
 		authorId, err := tx.NewAuthor(author)
 		if err != nil {
 			return err
 		}
+		if slices.Contains(authorIds, authorId) {
+			continue
+		}
+		authorIds = append(authorIds, authorId)
 		_, err = tx.Stmt["insertIntoBooksAuthors"].Exec(bookId, authorId)
 		if err != nil {
 			return err
 		}
 	}
 
+	for _, c := range b.Contributors {
+		contributorId, err := tx.NewContributor(&c.Author)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Stmt["insertIntoBooksContributors"].Exec(bookId, contributorId, c.Role)
+		if err != nil {
+			return err
+		}
+	}
+
 	for _, genre := range b.Genres {
 		_, err = tx.Stmt["insertIntoBooksGenres"].Exec(bookId, genre)
 		if err != nil {
@@ -59,16 +86,42 @@ func (tx *TX) NewBook(b *model.Book) error {
 		}
 	}
 
+	series := b.Series
+	if serieId != 0 && !slices.ContainsFunc(series, func(s *model.BookSerie) bool { return s.Name == b.Serie.Name }) {
+		main := &model.BookSerie{Serie: *b.Serie}
+		if b.SerieNum > 0 {
+			main.Number = strconv.Itoa(b.SerieNum)
+		}
+		series = append([]*model.BookSerie{main}, series...)
+	}
+	for _, s := range series {
+		id := tx.NewSerie(&s.Serie)
+		if id == 0 {
+			continue
+		}
+		_, err = tx.Stmt["insertIntoBooksSeries"].Exec(bookId, id, s.Role, s.Number, serieNumberSort(s.Number))
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-// RecordBookState records book state in database
-func (tx *TX) RecordBookState(b *model.Book, s hash.BookState) error {
-	_, err := tx.Stmt["insertIntoBooks"].Exec(b.File, b.CRC32, b.Archive, b.Size, b.Format, b.Title, b.Sort, b.Year, 0, b.Plot, b.Cover, b.Keywords, 0, b.SerieNum, int64(s))
-	if err != nil {
+// NewLazyBook adds a new book which cover and annotation are loaded from the book file later
+func (tx *TX) NewLazyBook(b *model.Book) error {
+	if err := tx.NewBook(b); err != nil {
 		return err
 	}
-	return nil
+	_, err := tx.Exec(`INSERT INTO books_lazy (book_id) VALUES (?)`, b.ID)
+	return err
+}
+
+// RecordBookState records the state and the error of rejected book file in ingest status
+func (tx *TX) RecordBookState(b *model.Book, s hash.BookState) error {
+	q := `INSERT OR REPLACE INTO ingest_status (file, archive, state, error, updated, library_id) VALUES (?, ?, ?, ?, ?, ?)`
+	_, err := tx.Exec(q, b.File, b.Archive, int64(s), b.Error, time.Now().UnixNano(), tx.Library)
+	return err
 }
 
 // Languages
@@ -108,6 +161,41 @@ func (tx *TX) NewSerie(s *model.Serie) int64 {
 	return id
 }
 
+// serieNumberSort returns the book number in series to sort the series books by,
+// fractional and roman numbers are recognized, the leading digits are taken from the other numbers like 2a
+func serieNumberSort(num string) float64 {
+	num = strings.TrimSpace(num)
+	if n, err := strconv.ParseFloat(strings.Replace(num, ",", ".", 1), 64); err == nil && !math.IsInf(n, 0) && !math.IsNaN(n) {
+		return n
+	}
+	if n := romanNumber(num); n > 0 {
+		return float64(n)
+	}
+	digits := num[:len(num)-len(strings.TrimLeft(num, "0123456789"))]
+	n, _ := strconv.Atoi(digits)
+	return float64(n)
+}
+
+// romanNumber converts roman number to integer, 0 if it is not a roman number
+func romanNumber(s string) int {
+	values := map[rune]int{'I': 1, 'V': 5, 'X': 10, 'L': 50, 'C': 100, 'D': 500, 'M': 1000}
+	n, prev := 0, 0
+	runes := []rune(strings.ToUpper(s))
+	for i := len(runes) - 1; i >= 0; i-- {
+		v, ok := values[runes[i]]
+		if !ok {
+			return 0
+		}
+		if v < prev {
+			n -= v
+		} else {
+			n += v
+			prev = v
+		}
+	}
+	return n
+}
+
 // FindSerie finds existing series by name
 func (tx *TX) FindSerie(s *model.Serie) int64 {
 	var id int64 = 0
@@ -119,8 +207,13 @@ func (tx *TX) FindSerie(s *model.Serie) int64 {
 }
 
 // Authors
-// NewAuthor adds a new author to the database or returns existing one
+// NewAuthor adds a new author to the database or returns existing one,
+// the author with alias name is replaced by its canonical author
 func (tx *TX) NewAuthor(a *model.Author) (int64, error) {
+	err := tx.Stmt["selectFromAuthorAliases"].QueryRow(a.Name).Scan(&a.Name, &a.Sort)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
 	id := tx.FindAuthor(a)
 	if id != 0 {
 		return id, nil
@@ -138,7 +231,7 @@ func (tx *TX) NewAuthor(a *model.Author) (int64, error) {
 	return id, nil
 }
 
-// FindAuthor finds existing author by name
+// FindAuthor finds existing author by name, alias name is resolved to its canonical author
 func (tx *TX) FindAuthor(a *model.Author) int64 {
 	var id int64 = 0
 	err := tx.Stmt["selectIdFromAuthors"].QueryRow(a.Name).Scan(&id)
@@ -147,3 +240,21 @@ func (tx *TX) FindAuthor(a *model.Author) int64 {
 	}
 	return id
 }
+
+// Contributors
+// NewContributor adds a new contributor to the database or returns existing one
+func (tx *TX) NewContributor(c *model.Author) (int64, error) {
+	var id int64
+	err := tx.Stmt["selectIdFromContributors"].QueryRow(c.Name).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+	res, err := tx.Stmt["insertIntoContributors"].Exec(c.Name, c.Sort)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
@@ -0,0 +1,55 @@
+package store
+
+import "testing"
+
+func TestSerieNumberSort(t *testing.T) {
+	var testNumbers = []struct {
+		num  string
+		sort float64
+	}{
+		{"", 0},
+		{"3", 3},
+		{" 12 ", 12},
+		{"2.5", 2.5},
+		{"2,5", 2.5},
+		{"IV", 4},
+		{"xii", 12},
+		{"MCMXC", 1990},
+		{"2a", 2},
+		{"10-11", 10},
+		{"Inf", 0},
+		{"NaN", 0},
+		{"1e400", 1},
+		{"Том 2", 0},
+	}
+
+	for _, n := range testNumbers {
+		if sort := serieNumberSort(n.num); sort != n.sort {
+			t.Errorf("%q: expecting %v, got: %v", n.num, n.sort, sort)
+		}
+	}
+}
+
+func TestRomanNumber(t *testing.T) {
+	var testNumbers = []struct {
+		roman string
+		n     int
+	}{
+		{"I", 1},
+		{"III", 3},
+		{"IX", 9},
+		{"XIV", 14},
+		{"xl", 40},
+		{"MMXXIV", 2024},
+		{"", 0},
+		{"IIV", 3},
+		{"X1", 0},
+		{"Ⅻ", 0},
+	}
+
+	for _, r := range testNumbers {
+		if n := romanNumber(r.roman); n != r.n {
+			t.Errorf("%q: expecting %d, got: %d", r.roman, r.n, n)
+		}
+	}
+}